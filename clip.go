@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	game "github.com/lwayneh/dem-replay/match"
+	"github.com/lwayneh/dem-replay/render"
+	xdraw "golang.org/x/image/draw"
+)
+
+// exportClipCommand renders a round or a range of ticks into an animated GIF
+// or a sequence of PNG files without opening a window.
+func exportClipCommand(args []string) error {
+	flags := flag.NewFlagSet("export-clip", flag.ExitOnError)
+	configFlags(flags)
+	round := flags.Int("round", 0, "Number of the round to export")
+	from := flags.String("from", "", "Round timer to start at, e.g. 1:30 (start of the round if empty)")
+	to := flags.String("to", "", "Round timer to end at, e.g. 0:40 (end of the round if empty). The round timer stops at the bomb plant, so leave it empty to clip past the plant")
+	fromTick := flags.Int("fromtick", 0, "Ingame tick to start at, instead of a round")
+	toTick := flags.Int("totick", 0, "Ingame tick to end at, instead of a round")
+	fps := flags.Float64("fps", 16, "Frames per second of the clip")
+	scale := flags.Float64("scale", 1, "Scale of the clip, e.g. 0.5 for half the size")
+	format := flags.String("format", "", "gif or png (a sequence of files in a directory), from the output name if empty")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: ./dem-replay export-clip [flags] [path to demo, - to read from stdin] [output .gif or directory]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errors.New("export-clip needs a demo and an output")
+	}
+	if *fps <= 0 || *scale <= 0 {
+		return errors.New("fps and scale have to be positive")
+	}
+	out := flags.Arg(1)
+	if *format == "" {
+		*format = "png"
+		if strings.EqualFold(filepath.Ext(out), ".gif") {
+			*format = "gif"
+		}
+	}
+	if *format != "gif" && *format != "png" {
+		return fmt.Errorf("unknown clip format %q", *format)
+	}
+
+	match, scene, err := openScene(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	timeline := match.Timeline()
+
+	var start, end int
+	if *round > 0 {
+		start, end, err = clipRound(match, *round, *from, *to)
+		if err != nil {
+			return err
+		}
+	} else {
+		start, end = 0, match.StateCount()-1
+		if *fromTick > 0 {
+			start = timeline.FrameOfTick(*fromTick)
+		}
+		if *toTick > 0 {
+			end = timeline.FrameOfTick(*toTick)
+		}
+	}
+	if end < start {
+		return errors.New("the clip ends before it starts")
+	}
+
+	width := float64(render.Width) * *scale
+	height := float64(render.Height) * *scale
+	bounds := image.Rect(0, 0, int(width), int(height))
+
+	var file *os.File
+	var encoder *render.GIFEncoder
+	switch *format {
+	case "gif":
+		file, err = os.Create(out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		encoder = render.NewGIFEncoder(file, bounds.Dx(), bounds.Dy())
+	case "png":
+		if err := os.MkdirAll(out, 0755); err != nil {
+			return err
+		}
+	}
+
+	backend := render.NewImage(render.Width, render.Height, loadFont(conf.FontPath))
+	step := time.Duration(float64(time.Second) / *fps)
+	i := 0
+	for elapsed := timeline.Time(start); elapsed <= timeline.Time(end); elapsed += step {
+		frame, fraction := timeline.FramePosition(elapsed)
+		scene.Draw(backend, frame, fraction)
+		var img image.Image = backend.RGBA()
+		if *scale != 1 {
+			scaled := image.NewRGBA(bounds)
+			xdraw.ApproxBiLinear.Scale(scaled, bounds, img, img.Bounds(), draw.Src, nil)
+			img = scaled
+		}
+
+		switch *format {
+		case "gif":
+			if err := encoder.Encode(img, gifDelay(i, *fps)); err != nil {
+				return err
+			}
+		case "png":
+			err := writePNG(filepath.Join(out, fmt.Sprintf("frame-%05d.png", i)), img)
+			if err != nil {
+				return err
+			}
+		}
+		i++
+	}
+
+	if encoder != nil {
+		if err := encoder.Close(); err != nil {
+			return err
+		}
+		return file.Close()
+	}
+	return nil
+}
+
+// gifDelay returns how many hundredths of a second the frame with the index
+// is shown at the frame rate. GIF delays are whole hundredths, so the delays
+// of consecutive frames differ to keep the clip at the right speed, e.g. 6,
+// 7, 6, 6 at 16 frames per second.
+func gifDelay(i int, fps float64) int {
+	delay := int(math.Round(float64(i+1)*100/fps) - math.Round(float64(i)*100/fps))
+	if delay < 2 {
+		// browsers play shorter delays at 10 frames per second
+		delay = 2
+	}
+	return delay
+}
+
+// clipRound returns the first and last frame of a clip of the round between
+// the round timers from and to. Both are read on the round timer, so a clip
+// can only end after the bomb plant with an empty to.
+func clipRound(match *game.Match, round int, from, to string) (start, end int, err error) {
+	timeline := match.Timeline()
+	start, end, ok := match.RoundFrames(round)
+	if !ok {
+		return 0, 0, fmt.Errorf("there is no round %d", round)
+	}
+	if from != "" {
+		remaining, err := parseClock(from)
+		if err != nil {
+			return 0, 0, err
+		}
+		if start, ok = timeline.FrameOfRemaining(round, remaining); !ok {
+			return 0, 0, fmt.Errorf("the round timer of round %d never shows %v before the round ends or the bomb is planted", round, from)
+		}
+	}
+	if to != "" {
+		remaining, err := parseClock(to)
+		if err != nil {
+			return 0, 0, err
+		}
+		if end, ok = timeline.FrameOfRemaining(round, remaining); !ok {
+			return 0, 0, fmt.Errorf("the round timer of round %d never shows %v before the round ends or the bomb is planted", round, to)
+		}
+	}
+	return start, end, nil
+}
+
+// parseClock parses a round timer like 1:30.
+func parseClock(clock string) (time.Duration, error) {
+	parts := strings.Split(clock, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("round timer %q is not minutes:seconds", clock)
+	}
+	minutes, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("round timer %q is not minutes:seconds", clock)
+	}
+	seconds, err := strconv.Atoi(parts[1])
+	if err != nil || seconds >= 60 {
+		return 0, fmt.Errorf("round timer %q is not minutes:seconds", clock)
+	}
+	return time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second, nil
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/faiface/pixel"
+	"github.com/golang/geo/r2"
 	"github.com/golang/geo/r3"
 	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
 	event "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
@@ -28,7 +29,7 @@ type OverviewState struct {
 	IngameTick            int
 	Players               []Player
 	Grenades              []common.GrenadeProjectile
-	Infernos              []common.Inferno
+	Infernos              []Inferno
 	Bomb                  common.Bomb
 	TeamCounterTerrorists Team
 	TeamTerrorists        Team
@@ -41,6 +42,7 @@ type Player struct {
 	common.Player
 	Health         int
 	ViewDirectionX float32
+	ViewDirectionY float32
 	Money          int
 	Kills          int
 	Deaths         int
@@ -49,11 +51,19 @@ type Player struct {
 	Helmet         bool
 	Kit            bool
 	ActiveWeapon   *common.Equipment
+	Grenades       []common.EquipmentType
 	FlashRemaining time.Duration
 	ClanName       string
 	ShortName      string
 }
 
+// Inferno contains the area covered by the fires of a molotov or incendiary
+// grenade.
+type Inferno struct {
+	UniqueID   int64
+	ConvexHull []r2.Point
+}
+
 // Team extends the TeamState type from the parser
 type Team struct {
 	common.TeamState
@@ -67,20 +77,166 @@ type Clan struct {
 	ClanName string
 }
 
-// GrenadeEffect extends the GrenadeEvent type from the parser by the Lifetime
-// variable that is used to draw the effect.
+// GrenadeEffect extends the GrenadeEvent type from the parser by the frames
+// the effect is visible in, from StartFrame up to EndFrame (exclusive).
 type GrenadeEffect struct {
 	event.GrenadeEvent
-	Lifetime int
+	StartFrame int
+	EndFrame   int
 }
 
 // Kill contains all information that is displayed on the killfeed.
 type Kill struct {
-	KillerName string
-	KillerTeam common.Team
-	VictimName string
-	VictimTeam common.Team
-	Weapon     string
+	Frame             int
+	Tick              int
+	KillerName        string
+	KillerTeam        common.Team
+	KillerSteamID     uint64
+	KillerPosition    r3.Vector
+	VictimName        string
+	VictimTeam        common.Team
+	VictimSteamID     uint64
+	VictimPosition    r3.Vector
+	AssisterName      string
+	AssisterTeam      common.Team
+	AssisterSteamID   uint64
+	Weapon            string
+	IsHeadshot        bool
+	PenetratedObjects int
+	IsFlashAssist     bool
+	ThroughSmoke      bool
+	NoScope           bool
+	AttackerBlind     bool
+}
+
+// IsWallbang returns true if the bullet penetrated an object before the kill.
+func (k Kill) IsWallbang() bool {
+	return k.PenetratedObjects > 0
+}
+
+// Damage contains a single instance of damage a player took.
+type Damage struct {
+	Frame           int
+	Tick            int
+	AttackerName    string
+	AttackerTeam    common.Team
+	AttackerSteamID uint64
+	VictimName      string
+	VictimTeam      common.Team
+	VictimSteamID   uint64
+	Weapon          string
+	HitGroup        event.HitGroup
+	HealthDamage    int
+	// HealthDamageTaken is HealthDamage capped at the health the victim had left.
+	HealthDamageTaken int
+	ArmorDamage       int
+}
+
+// SamePlayer returns true if two players of events are the same player. All
+// bots have the Steam ID 0, so they are told apart by their names. Compare
+// players with SamePlayer instead of their Steam IDs.
+func SamePlayer(steamIDA uint64, nameA string, steamIDB uint64, nameB string) bool {
+	if steamIDA == 0 && steamIDB == 0 {
+		return nameA == nameB
+	}
+	return steamIDA == steamIDB
+}
+
+// BombEventType corresponds to a step in the lifecycle of the bomb.
+type BombEventType int
+
+// Possible values for BombEventType type.
+const (
+	BombPickup BombEventType = iota
+	BombDropped
+	BombPlantBegin
+	BombPlantAborted
+	BombPlanted
+	BombDefuseStart
+	BombDefuseAborted
+	BombDefused
+	BombExplode
+)
+
+// BombEvent contains a single step in the lifecycle of the bomb.
+type BombEvent struct {
+	Frame         int
+	Tick          int
+	Type          BombEventType
+	PlayerName    string
+	PlayerTeam    common.Team
+	PlayerSteamID uint64
+	Position      r3.Vector
+	// Site is 'A' or 'B' for plants, defuses and explosions and 0 otherwise.
+	Site rune
+	// HasKit is set for BombDefuseStart events.
+	HasKit bool
+}
+
+// TrajectoryPoint is the position of a grenade at a frame.
+type TrajectoryPoint struct {
+	Frame    int
+	Position r3.Vector
+}
+
+// GrenadeHit contains the damage a grenade dealt to a player.
+type GrenadeHit struct {
+	PlayerName    string
+	PlayerTeam    common.Team
+	PlayerSteamID uint64
+	HealthDamage  int
+}
+
+// FlashedPlayer contains a player that was blinded by a flashbang.
+type FlashedPlayer struct {
+	PlayerName    string
+	PlayerTeam    common.Team
+	PlayerSteamID uint64
+	Duration      time.Duration
+}
+
+// Grenade contains the lifecycle of a thrown grenade from the throw to the
+// detonation and the expiry of its effect.
+// DetonateFrame, DetonateTick and ExpireFrame are -1 if the grenade never
+// detonated or expired, e.g. at the end of the demo.
+type Grenade struct {
+	UniqueID            int64
+	EntityID            int
+	Type                common.EquipmentType
+	ThrowerName         string
+	ThrowerTeam         common.Team
+	ThrowerSteamID      uint64
+	ThrowFrame          int
+	ThrowTick           int
+	ThrowPosition       r3.Vector
+	ThrowViewDirectionX float32
+	ThrowViewDirectionY float32
+	Trajectory          []TrajectoryPoint
+	DetonateFrame       int
+	DetonateTick        int
+	DetonatePosition    r3.Vector
+	ExpireFrame         int
+	Hits                []GrenadeHit
+	Flashed             []FlashedPlayer
+	// Extinguished is set for molotovs and incendiaries that were put out by
+	// a smoke.
+	Extinguished bool
+}
+
+// IsTeamFlash returns true if the flashed player is a teammate of the thrower.
+func (g *Grenade) IsTeamFlash(p FlashedPlayer) bool {
+	return p.PlayerTeam == g.ThrowerTeam && !g.IsSelfFlash(p)
+}
+
+// IsSelfFlash returns true if the flashed player is the thrower.
+func (g *Grenade) IsSelfFlash(p FlashedPlayer) bool {
+	return SamePlayer(p.PlayerSteamID, p.PlayerName, g.ThrowerSteamID, g.ThrowerName)
+}
+
+// InFlight returns true if the grenade was thrown but did not detonate yet
+// at the specified frame.
+func (g *Grenade) InFlight(frame int) bool {
+	return g.ThrowFrame <= frame && (g.DetonateFrame == -1 || frame < g.DetonateFrame)
 }
 
 // Timer contains the time remaining in the current phase of the round.
@@ -89,8 +245,44 @@ type Timer struct {
 	Phase         Phase
 }
 
+// RoundEndReason describes how a round was won.
+type RoundEndReason int
+
+// Possible values for RoundEndReason type.
+const (
+	RoundEndReasonOther RoundEndReason = iota
+	RoundEndReasonElimination
+	RoundEndReasonBombExploded
+	RoundEndReasonBombDefused
+	RoundEndReasonTimeExpired
+	RoundEndReasonSurrender
+	RoundEndReasonDraw
+)
+
+// Round contains the key frames and the outcome of a single round.
+// Frames of events that did not happen in the round are -1.
+type Round struct {
+	Number           int
+	StartFrame       int
+	FreezeEndFrame   int
+	PlantFrame       int
+	EndFrame         int
+	OfficialEndFrame int
+	Winner           common.Team
+	EndReason        RoundEndReason
+	// Score after the round
+	ScoreCT int
+	ScoreT  int
+	// Equipment value of each team at the end of the freezetime
+	EquipmentValueCT int
+	EquipmentValueT  int
+}
+
 // Shot contains information about a shot from a weapon.
 type Shot struct {
+	Tick           int
+	StartFrame     int
+	EndFrame       int
 	Position       r3.Vector
 	ViewDirectionX float32
 	IsAwpShot      bool
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/lwayneh/dem-replay/live"
+	game "github.com/lwayneh/dem-replay/match"
+)
+
+// Config contains information the application requires in order to run
+type Config struct {
+	// Path to font file (.ttf)
+	FontPath string
+
+	// Path to overview directory
+	OverviewDir string
+
+	// Fallback GOTV Framerate
+	FrameRate float64
+
+	// Fallback Gameserver Tickrate
+	TickRate float64
+
+	// Path to the parsed match cache directory, caching is disabled if empty
+	CacheDir string
+
+	// Number of states kept per second of the demo, all states are kept if 0
+	StatesPerSecond float64
+
+	// Address of the live state websocket of the viewer, disabled if empty
+	LiveAddr string
+
+	// Number of states sent per second on the live state websocket
+	LiveRate float64
+}
+
+// DefaultConfig contains standard parameters for the application.
+var DefaultConfig = Config{
+	FrameRate: -1,
+	TickRate:  -1,
+	LiveRate:  live.DefaultRate,
+}
+
+const fontName string = "DejaVuSans.ttf"
+
+var conf = DefaultConfig
+
+func init() {
+	userHomeDir, err := os.UserHomeDir()
+	if err != nil {
+		log.Fatalln("trying to get user home directory:", err)
+	}
+	conf.FontPath = filepath.Join(userHomeDir, "dem-replay", fontName)
+	conf.OverviewDir = filepath.Join(userHomeDir, "dem-replay")
+	if userCacheDir, err := os.UserCacheDir(); err == nil {
+		conf.CacheDir = filepath.Join(userCacheDir, "dem-replay")
+	}
+	configFlags(flag.CommandLine)
+}
+
+// configFlags adds the flags of the configuration to the flag set. The flags
+// default to the current configuration, so subcommands keep the flags given
+// before them.
+func configFlags(flags *flag.FlagSet) {
+	flags.Float64Var(&conf.FrameRate, "framerate", conf.FrameRate, "Fallback GOTV Framerate")
+	flags.Float64Var(&conf.TickRate, "tickrate", conf.TickRate, "Fallback Gameserver Tickrate")
+	flags.StringVar(&conf.FontPath, "fontpath", conf.FontPath, "Path to font file (.ttf)")
+	flags.StringVar(&conf.OverviewDir, "overviewdir", conf.OverviewDir, "Path to overview directory")
+	flags.StringVar(&conf.CacheDir, "cachedir", conf.CacheDir, "Path to parsed match cache directory (empty to disable)")
+	flags.Float64Var(&conf.StatesPerSecond, "statespersecond", conf.StatesPerSecond, "Number of states kept per second of the demo (0 to keep all)")
+}
+
+// commands are the subcommands that run without a window, by their names.
+// They don't need OpenGL and are the only ones in headless builds.
+var commands = map[string]func(args []string) error{
+	"render":      renderCommand,
+	"export":      exportCommand,
+	"export-html": exportHTMLCommand,
+	"export-clip": exportClipCommand,
+	"serve":       serveCommand,
+}
+
+func main() {
+	flag.Parse()
+	if command, ok := commands[flag.Arg(0)]; ok {
+		if err := command(flag.Args()[1:]); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
+	runViewer()
+}
+
+// Helper for parsing a demo from a file or, if the file name is "-", stdin.
+// Compressed demos and zip archives are detected automatically, matches
+// exported to JSON are loaded without parsing.
+func openMatch(ctx context.Context, demoFileName string, opts game.Options) (*game.Match, error) {
+	if isJSONExport(demoFileName) {
+		if opts.Progress != nil {
+			close(opts.Progress)
+		}
+		file, err := os.Open(demoFileName)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return game.ReadJSON(bufio.NewReader(file))
+	}
+	if demoFileName == "-" {
+		return game.NewMatchReader(ctx, os.Stdin, opts)
+	}
+	return game.NewMatchContext(ctx, demoFileName, opts)
+}
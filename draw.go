@@ -1,20 +1,20 @@
+//go:build !headless
+// +build !headless
+
 package main
 
 import (
-	"fmt"
+	"image"
 	"image/color"
 	_ "image/jpeg"
 	_ "image/png"
 	"math"
-	"sort"
-	"strconv"
-	"strings"
-	"time"
 
 	"github.com/faiface/pixel"
 	"github.com/faiface/pixel/imdraw"
 	"github.com/faiface/pixel/pixelgl"
 	"github.com/faiface/pixel/text"
+	"github.com/golang/geo/r2"
 	"github.com/golang/geo/r3"
 	ocom "github.com/lwayneh/dem-replay/common"
 	"github.com/lwayneh/dem-replay/match"
@@ -24,400 +24,137 @@ import (
 	"golang.org/x/image/colornames"
 )
 
-const (
-	radiusPlayer float64 = 10
-	radiusSmoke  float64 = 25
-)
-
 var (
 	colorTerror  = colornames.Darkorange
 	colorCounter = colornames.Dodgerblue
-	colorMoney   = colornames.Forestgreen
-	rifleLine    = pixel.V(13, 13)
-	awpLine      = pixel.V(20, 20)
-	shotLength   = pixel.V(1000, 1000)
-	halfSecond   = float64(0.5)
-	flashed      = time.Duration(halfSecond) * time.Second
-	teamOne      ocom.Clan
-	teamTwo      ocom.Clan
-	playerNames  map[string]string
 )
 
-func drawPlayer(imd *imdraw.IMDraw, canvas *pixelgl.Canvas, player *ocom.Player, game *match.Match, txt *text.Text, mat *pixel.Matrix) {
-	txt.Clear()
-	imd.SetMatrix(pixel.IM)
-	flash := imdraw.New(nil)
-	teamOne, teamTwo = match.GetTeamTags()
-	var color color.RGBA
-	if player.Team == common.TeamTerrorists {
-		color = colorTerror
-	} else {
-		color = colorCounter
-	}
-
-	if player.Health > 0 {
-		pos := player.LastAlivePosition
-		viewAngle := degreeToRad(float64(player.ViewDirectionX)) - .7
-		imd.Color = color
-		exact := position(&pos, game)
-		imd.Push(exact)
-		imd.Circle(radiusPlayer, 1.5)
-		fmt.Fprintln(txt, shortName(player, teamOne, teamTwo))
-
-		txtMat := pixel.IM.Scaled(txt.Dot, .25)
-		txtMat = txtMat.Moved(exact.Sub(txt.Dot))
-		txt.Draw(canvas, txtMat)
-
-		if player.FlashRemaining > flashed {
-			fade := (player.FlashRemaining.Seconds() * 255) / 5.5
-			flash.SetColorMask(pixel.Alpha(fade / 255))
-			flash.Push(exact)
-			flash.Circle(radiusPlayer-1, 0)
-			flash.SetMatrix(pixel.IM.Moved(exact))
-			flash.Draw(canvas)
-
-		}
-
-		drawWeapon(imd, player, viewAngle, exact, canvas)
-		if player.IsDefusing || player.IsPlanting {
-			imd.Color = colornames.Turquoise
-			imd.Push(exact)
-			imd.Circle(radiusPlayer, 0)
-		}
-
-		for _, w := range player.Weapons() {
-			if w.Type == common.EqBomb {
-				imd.Color = colornames.Salmon
-				imd.Push(exact)
-				imd.Circle(radiusPlayer-5, 0)
-			}
-		}
+// canvasBackend is a render.Backend drawing onto a canvas of the window, so
+// the window shows the same scene as rendered images.
+type canvasBackend struct {
+	canvas *pixelgl.Canvas
+	imd    *imdraw.IMDraw
+	txt    *text.Text
+	// size of the font of the atlas, text is scaled from it
+	fontSize float64
+	sprites  map[image.Image]*pixel.Sprite
+}
 
+func newCanvasBackend(canvas *pixelgl.Canvas, atlas *text.Atlas, fontSize float64) *canvasBackend {
+	imd := imdraw.New(nil)
+	imd.Precision = 64
+	return &canvasBackend{
+		canvas:   canvas,
+		imd:      imd,
+		txt:      text.New(pixel.ZV, atlas),
+		fontSize: fontSize,
+		sprites:  make(map[image.Image]*pixel.Sprite),
 	}
-	drawTimer(txt, canvas, game.States[curFrame].Timer)
-
 }
 
-func degreeToRad(degree float64) (rad float64) {
-	return degree * (math.Pi / 180)
+// vec converts a point of the backend, with y growing downwards, to the
+// canvas, with y growing upwards.
+func (b *canvasBackend) vec(p r2.Point) pixel.Vec {
+	return pixel.V(p.X, b.canvas.Bounds().H()-p.Y)
 }
 
-func drawBomb(sprites map[string]*pixel.Sprite, bomb *common.Bomb, match *match.Match, canvas *pixelgl.Canvas) {
-	var bombSprite *pixel.Sprite
-	pos := bomb.Position()
-	exact := position(&pos, match)
+// shape draws the shape pushed by push in the color. Every shape is drawn
+// right away, so shapes, images and text overlap in the order they are drawn.
+func (b *canvasBackend) shape(c color.Color, push func(imd *imdraw.IMDraw)) {
+	b.imd.Clear()
+	b.imd.Color = c
+	push(b.imd)
+	b.imd.Draw(b.canvas)
+}
 
-	if match.States[curFrame].Timer.Phase == ocom.PhasePlanted {
-		bombSprite = sprites["bombRed"]
-		bombSprite.Draw(canvas, pixel.IM.Scaled(pixel.ZV, .5).Moved(exact))
-	} else {
-		if bomb.Carrier == nil {
-			bombSprite = sprites["bombCarry"]
-			bombSprite.Draw(canvas, pixel.IM.Scaled(pixel.ZV, .5).Moved(exact))
-		}
-	}
+func (b *canvasBackend) Bounds() r2.Rect {
+	bounds := b.canvas.Bounds()
+	return r2.RectFromPoints(r2.Point{}, r2.Point{X: bounds.W(), Y: bounds.H()})
+}
 
+func (b *canvasBackend) Clear(c color.Color) {
+	b.canvas.Clear(c)
 }
 
-func drawKills(match *match.Match, sprites map[string]*pixel.Sprite, txt *text.Text, canvas *pixelgl.Canvas, overview *pixel.Sprite) {
-	feedX := float64(mapXOffset) + overview.Frame().W() + 3
-	feedV := pixel.V(feedX, 400)
-	txt.Orig = feedV
-	killMat := pixel.IM.Scaled(txt.Orig, .25)
-	kills := match.Killfeed[curFrame]
-	txt.LineHeight = txt.Atlas().LineHeight() * 2
-
-	for _, kill := range kills {
-		attacker := playerFromName(kill.KillerName, match)
-		victim := playerFromName(kill.VictimName, match)
-		attackerName := shortName(&attacker, teamOne, teamTwo)
-		victimName := shortName(&victim, teamOne, teamTwo)
-		weapon := kill.Weapon
-		dot := txt.Dot
-		fmt.Fprintln(txt, attackerName)
-		txt.Dot = dot.Add(pixel.V(700, 0))
-		fmt.Fprintln(txt, victimName)
-		dot.Y = (dot.Y * .25) + 300
-
-		if sprites[weapon] != nil {
-
-			if weapon == "Knife" {
-				sprites[weapon].Draw(canvas, pixel.IM.Scaled(pixel.ZV, .3).Moved(dot.Add(pixel.V(135, 0))))
-			} else {
-				sprites[weapon].Draw(canvas, pixel.IM.Scaled(pixel.ZV, .6).Moved(dot.Add(pixel.V(135, 0))))
-			}
-		}
+func (b *canvasBackend) Image(img image.Image, center r2.Point, scale float64) {
+	sprite, ok := b.sprites[img]
+	if !ok {
+		picture := pixel.PictureDataFromImage(img)
+		sprite = pixel.NewSprite(picture, picture.Bounds())
+		b.sprites[img] = sprite
 	}
-
-	txt.Draw(canvas, killMat)
-	txt.Clear()
+	sprite.Draw(b.canvas, pixel.IM.Scaled(pixel.ZV, scale).Moved(b.vec(center)))
 }
 
-func drawInfoBars(match *match.Match, canvas *pixelgl.Canvas, sprites map[string]*pixel.Sprite, txtInfo *text.Text) {
-	imdInfo := imdraw.New(nil)
-	var cts, ts []ocom.Player
-	for _, player := range match.States[curFrame].Players {
-		if player.Team == common.TeamCounterTerrorists {
-			cts = append(cts, player)
-
-		} else {
-			ts = append(ts, player)
-		}
-	}
-	sort.Slice(cts, func(i, j int) bool { return cts[i].SteamID64 < cts[j].SteamID64 })
-	sort.Slice(ts, func(i, j int) bool { return ts[i].SteamID64 < ts[j].SteamID64 })
-	drawInfoBar(imdInfo, cts, canvas, sprites, txtInfo, colorCounter)
-	drawInfoBar(imdInfo, ts, canvas, sprites, txtInfo, colorTerror)
+func (b *canvasBackend) Circle(center r2.Point, radius, thickness float64, c color.Color) {
+	b.shape(c, func(imd *imdraw.IMDraw) {
+		imd.Push(b.vec(center))
+		imd.Circle(radius, thickness)
+	})
+}
 
+func (b *canvasBackend) Arc(center r2.Point, radius, start, end, thickness float64, c color.Color) {
+	// the angles of imdraw are counted counterclockwise from 3 o'clock
+	b.shape(c, func(imd *imdraw.IMDraw) {
+		imd.Push(b.vec(center))
+		imd.CircleArc(radius, math.Pi/2-start, math.Pi/2-end, thickness)
+	})
 }
 
-func drawInfoBar(imd *imdraw.IMDraw, players []ocom.Player, canvas *pixelgl.Canvas, sprites map[string]*pixel.Sprite,
-	txt *text.Text, color color.Color) {
-	var pos pixel.Vec
-	kit := sprites["defuser"]
-	armor := sprites["armor"]
-	helmet := sprites["armor_helmet"]
-	ctPos := pixel.V(0, canvas.Bounds().Max.Y)
-	tPos := pixel.V(mapXOffset+float64(mapOverviewWidth), canvas.Bounds().Max.Y-mapYOffset)
-	if len(players) > 0 {
-		if players[0].Team == common.TeamCounterTerrorists {
-			pos = ctPos
-		} else {
-			pos = tPos
-		}
+func (b *canvasBackend) Line(points []r2.Point, thickness float64, c color.Color) {
+	if thickness <= 0 {
+		thickness = 1
 	}
-	txt.Orig = pixel.V(0, canvas.Bounds().Max.Y-50)
-	infoMat := pixel.IM
-	imd.Color = color
-	txt.Color = color
-	infoMat = infoMat.Scaled(pos, .3)
-	txt.Dot.X = pos.X
-	txt.Dot = txt.Dot.Add(pixel.V(0, -10))
-	txt.LineHeight = txt.Atlas().LineHeight() * 1.5
-	var yOffset float64
-	dot := txt.Dot
-	for _, player := range players {
-
-		if player.Health > 0 {
-			hpX := pos.X + float64(player.Health)*(mapXOffset/100)
-			imd.Push(pixel.V(hpX, canvas.Bounds().Max.Y-yOffset))
-			imd.Push(pixel.V(pos.X, canvas.Bounds().Max.Y-yOffset))
-			imd.Color = color
-			imd.Line(3)
-			txt.Color = colornames.Ghostwhite
-			fmt.Fprintln(txt, shortName(&player, teamOne, teamTwo))
-			txt.Dot = dot.Add(pixel.V(800, 0))
-			if player.Health < 75 && player.Health >= 50 {
-				txt.Color = colornames.Yellow
-			}
-			if player.Health < 50 && player.Health >= 30 {
-				txt.Color = colornames.Darkorange
-			}
-			if player.Health < 30 {
-				txt.Color = colornames.Red
-			}
-			fmt.Fprintln(txt, "HP:", player.Health)
-			txt.LineHeight = txt.Atlas().LineHeight() * 1.5
-			txt.Dot = dot.Add(pixel.V(0, -80))
-			txt.Color = colornames.Greenyellow
-			fmt.Fprintln(txt, "$", player.Money)
-			txt.Dot = dot.Add(pixel.V(0, -160))
-			txt.Color = colornames.Ghostwhite
-			fmt.Fprintln(txt, "K:", player.Kills, "A:", player.Assists, "D:", player.Deaths)
-
-			if player.Armor > 0 && player.Helmet {
-				helmet.Draw(canvas, pixel.IM.Moved(pixel.V(pos.X+170, canvas.Bounds().Max.Y-yOffset-60)))
-			} else if player.Armor > 0 {
-				armor.Draw(canvas, pixel.IM.Moved(pixel.V(pos.X+170, canvas.Bounds().Max.Y-yOffset-60)))
-			}
-			if player.Kit {
-				kit.Draw(canvas, pixel.IM.Moved(pixel.V(pos.X+135, canvas.Bounds().Max.Y-yOffset-60)))
-			}
-			var nadeCounter float64
-			weapons := player.Weapons()
-			sort.Slice(weapons, func(i, j int) bool { return weapons[i].Type < weapons[j].Type })
-			for _, w := range weapons {
-				if w.Class() == common.EqClassSMG || w.Class() == common.EqClassHeavy || w.Class() == common.EqClassRifle {
-					weapon := w.String()
-					if sprites[weapon] != nil {
-						sprites[weapon].Draw(canvas, pixel.IM.Scaled(pixel.ZV, .6).Moved(pixel.V(pos.X+230, canvas.Bounds().Max.Y-yOffset-40)))
-					}
-				}
-				if w.Class() == common.EqClassPistols {
-					weapon := w.String()
-					if sprites[weapon] != nil {
-						sprites[weapon].Draw(canvas, pixel.IM.Scaled(pixel.ZV, .6).Moved(pixel.V(pos.X+250, canvas.Bounds().Max.Y-yOffset-60)))
-					}
-				}
-				if w.Class() == common.EqClassGrenade {
-					var nadeSprite *pixel.Sprite
-					switch w.Type {
-					case common.EqDecoy:
-						nadeSprite = sprites["Decoy Grenade"]
-					case common.EqMolotov:
-						nadeSprite = sprites["molotov"]
-					case common.EqIncendiary:
-						nadeSprite = sprites["molotov"]
-					case common.EqFlash:
-						nadeSprite = sprites["Flashbang"]
-					case common.EqSmoke:
-						nadeSprite = sprites["Smoke Grenade"]
-					case common.EqHE:
-						nadeSprite = sprites["HE Grenade"]
-					}
-
-					for i := 0; i < player.AmmoLeft[w.AmmoType()]; i++ {
-						nadeSprite.Draw(canvas, pixel.IM.Moved(pixel.V(pos.X+10+nadeCounter*35, canvas.Bounds().Max.Y-yOffset-90)))
-						nadeCounter++
-					}
-
-				}
-				if w.Class() == common.EqClassEquipment {
-					if w.Type == common.EqBomb {
-						sprites["bombCarry"].Draw(canvas, pixel.IM.Scaled(pixel.ZV, .6).Moved(pixel.V(pos.X+170, canvas.Bounds().Max.Y-yOffset-30)))
-					}
-				}
-			}
-
-		}
-
-		if player.Health < 1 {
-			txt.Color = pixel.Alpha(.5)
-			dot := txt.Dot
-			fmt.Fprintln(txt, shortName(&player, teamOne, teamTwo))
-			txt.Dot = dot.Add(pixel.V(800, 0))
-			fmt.Fprintln(txt, "HP:", player.Health)
-			txt.Dot = dot.Add(pixel.V(0, -80))
-			fmt.Fprintln(txt, "$", player.Money)
-			txt.Dot = dot.Add(pixel.V(0, -160))
-			fmt.Fprintln(txt, "K:", player.Kills, "A:", player.Assists, "D:", player.Deaths)
+	b.shape(c, func(imd *imdraw.IMDraw) {
+		for _, p := range points {
+			imd.Push(b.vec(p))
 		}
-		dot = dot.Add(pixel.V(0, -370))
-		txt.Dot = dot
-
-		yOffset += infoBarHeight
-	}
-
-	imd.Draw(canvas)
-	txt.Draw(canvas, infoMat)
-	txt.Clear()
+		imd.Line(thickness)
+	})
 }
 
-func drawWeapon(imd *imdraw.IMDraw, player *ocom.Player, viewAngle float64, exact pixel.Vec, canvas *pixelgl.Canvas) {
-
-	gunline := pixel.V(0, 0)
-	imd.SetMatrix(pixel.IM.Rotated(exact, viewAngle))
-	var color color.RGBA
-
-	if player.ActiveWeapon.Type.Class() == common.EqClassGrenade {
-
-		switch player.ActiveWeapon.Type {
-		case common.EqDecoy:
-			color = colornames.Saddlebrown
-		case common.EqMolotov:
-			color = colornames.Orangered
-		case common.EqIncendiary:
-			color = colornames.Orangered
-		case common.EqFlash:
-			color = colornames.Floralwhite
-		case common.EqSmoke:
-			color = colornames.Darkgray
-		case common.EqHE:
-			color = colornames.Lawngreen
+func (b *canvasBackend) Polygon(points []r2.Point, c color.Color) {
+	b.shape(c, func(imd *imdraw.IMDraw) {
+		for _, p := range points {
+			imd.Push(b.vec(p))
 		}
-
-		imd.Color = color
-		imd.Push(exact.Add(pixel.V(radiusPlayer-2, radiusPlayer-2)))
-		imd.Circle(3, 0)
-
-	} else {
-		imd.EndShape = imdraw.SharpEndShape
-		if player.ActiveWeapon.Type == common.EqAWP {
-			gunline = awpLine
-			imd.Color = colornames.Darkturquoise
-
-		} else {
-			gunline = rifleLine
-			imd.Color = colornames.Crimson
-
-		}
-		imd.Push(exact.Add(pixel.V(radiusPlayer-2, radiusPlayer-2)))
-		imd.Push(exact.Add(gunline))
-		imd.Line(3.5)
-	}
-
+		imd.Polygon(0)
+	})
 }
 
-func drawTimer(txt *text.Text, canvas *pixelgl.Canvas, timer ocom.Timer) {
-	txt.Clear()
-	if timer.Phase == ocom.PhaseWarmup {
-		fmt.Fprintln(txt, "Warm Up")
-	} else {
-		minutes := int(timer.TimeRemaining.Minutes())
-		seconds := int(timer.TimeRemaining.Seconds()) - 60*minutes
-		timeString := fmt.Sprintf("%d:%2d", minutes, seconds)
-		var color = colornames.Floralwhite
-		if timer.Phase == ocom.PhasePlanted {
-			color = colornames.Red
-		} else if timer.Phase == ocom.PhaseRestart {
-			color = colornames.Greenyellow
-		} else {
-			color = colornames.Floralwhite
-		}
-		txt.Color = color
-		fmt.Fprintln(txt, timeString)
-	}
+func (b *canvasBackend) Rect(rect r2.Rect, thickness float64, c color.Color) {
+	b.shape(c, func(imd *imdraw.IMDraw) {
+		imd.Push(b.vec(rect.Lo()), b.vec(rect.Hi()))
+		imd.Rectangle(thickness)
+	})
+}
 
-	winMinX := canvas.Bounds().Min.X
-	winMinY := canvas.Bounds().Min.Y
-	timerPos := pixel.V(winMinX+10, winMinY+300)
-	timeMat := pixel.IM.Scaled(txt.Dot, .4)
-	timeMat = timeMat.Moved(timerPos.Sub(txt.Dot))
-
-	txt.Draw(canvas, timeMat)
-	txt.Color = colornames.Floralwhite
-	txt.Clear()
-
-	// Draw menu icon
-	if !loadCtrl {
-		leftCorner := canvas.Bounds().Min
-		leftOffset := canvas.Bounds().Center().Sub(leftCorner)
-		menu := controls["barsHorizontal"]
-		menu.SetOffset(pixel.V(-leftOffset.X+20, -leftOffset.Y+20))
-		centerMat := pixel.IM.Scaled(pixel.ZV, menu.Scale)
-		centerMat = centerMat.Moved(canvas.Bounds().Center())
-		centerMat = centerMat.Moved(menu.Offset)
-		menu.Sprite.Draw(canvas, centerMat)
-	}
+func (b *canvasBackend) Text(dot r2.Point, size float64, c color.Color, s string) r2.Point {
+	b.txt.Clear()
+	b.txt.Orig = b.vec(dot)
+	b.txt.Dot = b.txt.Orig
+	b.txt.Color = c
+	b.txt.WriteString(s)
+	scale := size / b.fontSize
+	b.txt.Draw(b.canvas, pixel.IM.Scaled(b.txt.Orig, scale))
+	return r2.Point{X: dot.X + (b.txt.Dot.X-b.txt.Orig.X)*scale, Y: dot.Y}
 }
 
-func drawGrenade(imd *imdraw.IMDraw, grenade *common.GrenadeProjectile, match *match.Match) {
-	imd.SetMatrix(pixel.IM)
-	//gPath gets a list of positions of the grenade projectile
-	gPath := grenade.Trajectory
-	//pos gets the last position from the list of positions in gPath
-	pos := gPath[len(gPath)-1]
+func (b *canvasBackend) TextWidth(size float64, s string) float64 {
+	return b.txt.BoundsOf(s).W() * size / b.fontSize
+}
 
-	exact := position(&pos, match)
-	var color = colornames.Floralwhite
-
-	switch grenade.WeaponInstance.Type {
-	case common.EqDecoy:
-		color = colornames.Saddlebrown
-	case common.EqMolotov:
-		color = colornames.Orangered
-	case common.EqIncendiary:
-		color = colornames.Orangered
-	case common.EqFlash:
-		color = colornames.Floralwhite
-	case common.EqSmoke:
-		color = colornames.Darkgray
-	case common.EqHE:
-		color = colornames.Lawngreen
-	}
-	imd.Color = color
-	imd.Push(exact.Add(pixel.V(radiusPlayer-2, radiusPlayer-2)))
-	imd.Circle(3, 0)
+// drawMenuIcon draws the icon that shows the playback controls in the bottom
+// left corner while they are hidden.
+func drawMenuIcon(canvas *pixelgl.Canvas) {
+	leftCorner := canvas.Bounds().Min
+	leftOffset := canvas.Bounds().Center().Sub(leftCorner)
+	menu := controls["barsHorizontal"]
+	menu.SetOffset(pixel.V(-leftOffset.X+20, -leftOffset.Y+20))
+	centerMat := pixel.IM.Scaled(pixel.ZV, menu.Scale)
+	centerMat = centerMat.Moved(canvas.Bounds().Center())
+	centerMat = centerMat.Moved(menu.Offset)
+	menu.Sprite.Draw(canvas, centerMat)
 }
 
 func drawGrenadeEffect(effect *ocom.GrenadeEffect, match *match.Match,
@@ -455,14 +192,14 @@ func drawGrenadeEffect(effect *ocom.GrenadeEffect, match *match.Match,
 
 }
 
-func drawInferno(imd *imdraw.IMDraw, inferno *common.Inferno, match *match.Match, parts map[string]*part.Particles,
+func drawInferno(inferno *ocom.Inferno, match *match.Match, parts map[string]*part.Particles,
 	batches map[string]*pixel.Batch, canvas *pixelgl.Canvas, dt *float64) {
 
 	fireB := batches["fire"]
 	fireP := parts["fire"]
 	fireB.Clear()
 
-	hull := inferno.Fires().ConvexHull2D()
+	hull := inferno.ConvexHull
 	coordinates := make([]pixel.Vec, 0)
 
 	for _, v := range hull {
@@ -516,25 +253,6 @@ func indexOf(element pixel.Vec, data []pixel.Vec) int {
 	return -1
 }
 
-func drawShot(imd *imdraw.IMDraw, canvas *pixelgl.Canvas, shot *ocom.Shot, match *match.Match) {
-	pos := shot.Position
-	shooter := position(&pos, match)
-	viewAngle := degreeToRad(float64(shot.ViewDirectionX)) - .7
-	color := colornames.Floralwhite
-
-	if shot.IsAwpShot {
-		color = colornames.Crimson
-	}
-	imd.Color = color
-	target := shooter.Add(shotLength)
-
-	imd.SetMatrix(pixel.IM.Rotated(shooter, viewAngle))
-	imd.Push(shooter.Add(pixel.V(radiusPlayer+1, radiusPlayer+1)))
-	imd.Push(target)
-	imd.Line(1)
-
-}
-
 func drawControls(c *pixelgl.Canvas, match *match.Match, win *pixelgl.Window, spriteList map[string]*pixel.Sprite) {
 	leftCorner := c.Bounds().Min
 	leftOffset := c.Bounds().Center().Sub(leftCorner)
@@ -551,7 +269,7 @@ func drawControls(c *pixelgl.Canvas, match *match.Match, win *pixelgl.Window, sp
 	for i, img := range spriteList {
 		var mask color.Color
 		if i == "Pause" {
-			if paused {
+			if session.Paused() {
 				ctrl = play
 			} else {
 				continue
@@ -560,7 +278,7 @@ func drawControls(c *pixelgl.Canvas, match *match.Match, win *pixelgl.Window, sp
 			ctrl = controls[i]
 		}
 		if i == "Play" {
-			if paused {
+			if session.Paused() {
 				continue
 			}
 		}
@@ -581,51 +299,10 @@ func drawControls(c *pixelgl.Canvas, match *match.Match, win *pixelgl.Window, sp
 
 }
 
-func drawScore(match *match.Match, txt *text.Text, canvas *pixelgl.Canvas) {
-	imd := imdraw.New(nil)
-	ctScore := match.States[curFrame].TeamCounterTerrorists.Score
-	tScore := match.States[curFrame].TeamTerrorists.Score
-	ctName := match.States[curFrame].TeamCounterTerrorists.ClanName
-	tName := match.States[curFrame].TeamTerrorists.ClanName
-	txt.Color = colornames.White
-	tScoreString := strconv.Itoa(tScore)
-	ctScoreString := strconv.Itoa(ctScore)
-	var message string
-	message = ctName + ":" + ctScoreString + " - " + tName + ":" + tScoreString
-	ctmessage := ctName + ":" + ctScoreString + "  "
-	tmessage := "  " + tName + ":" + tScoreString
-	topCenter := canvas.Bounds().Center().Add(pixel.V(0, canvas.Bounds().H()/2))
-	width := txt.BoundsOf(message).W()
-	scoreMin := pixel.V(topCenter.X-(width/4), topCenter.Y-40)
-	scoreMax := pixel.V(topCenter.X+(width/4), topCenter.Y-2)
-	rect := pixel.R(scoreMin.X, scoreMin.Y, scoreMax.X, scoreMax.Y)
-	imd.Color = color.RGBA{85, 90, 99, 230}
-	imd.Push(rect.Min, rect.Max)
-	imd.Rectangle(0)
-	imd.Color = colornames.White
-	imd.Push(rect.Min.Add(pixel.V(-1, -1)), rect.Max.Add(pixel.V(1, 1)))
-	imd.Rectangle(1)
-
-	scoreMat := pixel.IM.Scaled(txt.Dot, .5)
-	txt.Dot = rect.Center()
-	txt.Dot.X = txt.Dot.X * 2
-	txt.Dot.X -= txt.BoundsOf(message).W() / 2
-	nextDot := txt.Dot
-	txt.Color = colornames.Dodgerblue
-	fmt.Fprintln(txt, ctmessage)
-	txt.Dot = nextDot
-	txt.Dot.X = nextDot.X + txt.BoundsOf(ctmessage).W()
-	txt.Color = colornames.Darkorange
-	fmt.Fprintln(txt, tmessage)
-	imd.Draw(canvas)
-	txt.Draw(canvas, scoreMat)
-	txt.Clear()
-}
-
 func drawFrameBar(canvas *pixelgl.Canvas, game *match.Match, txt *text.Text) {
 	imdRounds := imdraw.New(nil)
-	totalFrames := float64(match.TotalFrames)
-	currentFrame := float64(curFrame)
+	totalFrames := float64(game.TotalFrames)
+	currentFrame := float64(session.Frame())
 	watchedPercent := (currentFrame / (totalFrames / 100))
 	imd := imdraw.New(nil)
 	minX := canvas.Bounds().Min.X + 3
@@ -646,62 +323,25 @@ func drawFrameBar(canvas *pixelgl.Canvas, game *match.Match, txt *text.Text) {
 	imd.Line(4)
 	imd.Draw(canvas)
 
-	rounds := game.RoundStarts
-	var ctScoreOld, tScoreOld, ctScore, tScore int
-	var previousState ocom.OverviewState
-
-	for i, round := range rounds {
-		roundState := game.States[round]
-
-		if i == 0 {
-			ctScoreOld = 0
-			tScoreOld = 0
-		} else {
-			previousState = game.States[rounds[i-1]]
-			ctScoreOld = previousState.TeamCounterTerrorists.Score
-			tScoreOld = previousState.TeamTerrorists.Score
+	for _, round := range game.Rounds {
+		if round.EndFrame == -1 {
+			continue
 		}
-		ctScore = roundState.TeamCounterTerrorists.Score
-		tScore = roundState.TeamTerrorists.Score
-		if ctScore > ctScoreOld || tScore > tScoreOld {
-			framePos := float64(round) / (totalFrames / 100)
-			frameToBar := (playBar.W() / 100) * framePos
-			kMin := pixel.V(frameToBar, minY+1)
-			kMax := pixel.V(frameToBar, maxY-1)
-
-			if ctScore > ctScoreOld {
-				imdRounds.Color = colorCounter
-			}
-			if tScore > tScoreOld {
-				imdRounds.Color = colorTerror
-			}
-			imdRounds.Push(kMin)
-			imdRounds.Push(kMax)
-			imdRounds.Line(3)
+		switch round.Winner {
+		case common.TeamCounterTerrorists:
+			imdRounds.Color = colorCounter
+		case common.TeamTerrorists:
+			imdRounds.Color = colorTerror
+		default:
+			continue
 		}
+		framePos := float64(round.EndFrame) / (totalFrames / 100)
+		frameToBar := (playBar.W() / 100) * framePos
+		kMin := pixel.V(frameToBar, minY+1)
+		kMax := pixel.V(frameToBar, maxY-1)
+		imdRounds.Push(kMin)
+		imdRounds.Push(kMax)
+		imdRounds.Line(3)
 	}
 	imdRounds.Draw(canvas)
 }
-
-func shortName(player *ocom.Player, teamOne ocom.Clan, teamTwo ocom.Clan) string {
-
-	if player.ClanName == teamOne.ClanName {
-		return strings.Replace(player.Name, teamOne.Tag, "", 1)
-	}
-	if player.ClanName == teamTwo.ClanName {
-		return strings.Replace(player.Name, teamTwo.Tag, "", 1)
-	}
-	return player.Name
-}
-
-func playerFromName(name string, match *match.Match) ocom.Player {
-	var player ocom.Player
-	players := match.States[curFrame].Players
-	for _, p := range players {
-		if p.Name == name {
-			player = p
-		}
-	}
-
-	return player
-}
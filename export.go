@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	game "github.com/lwayneh/dem-replay/match"
+)
+
+// exportCommand writes the parsed match in a format other tools can read.
+func exportCommand(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	configFlags(flags)
+	format := flags.String("format", "json", "Format of the export, only json is supported")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: ./dem-replay export [flags] [path to demo, - to read from stdin] [output file, - to write to stdout]")
+		fmt.Fprintln(flags.Output(), "Use -statespersecond to keep fewer samples and reduce the size of the export.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errors.New("export needs a demo and an output")
+	}
+	if *format != "json" {
+		return fmt.Errorf("unknown export format %q", *format)
+	}
+
+	opts := game.Options{
+		FallbackFrameRate: conf.FrameRate,
+		FallbackTickRate:  conf.TickRate,
+		CacheDir:          conf.CacheDir,
+		StatesPerSecond:   conf.StatesPerSecond,
+	}
+	match, err := openMatch(context.Background(), flags.Arg(0), opts)
+	if err != nil {
+		return fmt.Errorf("trying to parse demo file: %w", err)
+	}
+
+	if flags.Arg(1) == "-" {
+		return writeJSON(os.Stdout, match)
+	}
+	file, err := os.Create(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(file, match); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func writeJSON(w io.Writer, match *game.Match) error {
+	buffered := bufio.NewWriter(w)
+	if err := match.WriteJSON(buffered); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// isJSONExport returns true if the file name looks like a match exported
+// with the export command.
+func isJSONExport(fileName string) bool {
+	return strings.HasSuffix(strings.ToLower(fileName), ".json")
+}
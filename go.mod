@@ -6,6 +6,7 @@ require (
 	github.com/faiface/pixel v0.10.0
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
 	github.com/golang/geo v0.0.0-20200730024412-e86565bf3f35
+	github.com/gorilla/websocket v1.5.0
 	github.com/markus-wa/demoinfocs-golang/v2 v2.3.0
 	golang.org/x/image v0.0.0-20200801110659-972c09e46d76
 )
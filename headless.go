@@ -0,0 +1,22 @@
+//go:build headless
+// +build headless
+
+package main
+
+import (
+	"log"
+	"sort"
+)
+
+// Builds with the headless tag, go build -tags headless, leave out the viewer
+// and only run the subcommands. They don't need cgo, OpenGL or a display.
+
+// runViewer fails, there is no viewer to run.
+func runViewer() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	log.Fatalln("built without the viewer, run one of the subcommands:", names)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/lwayneh/dem-replay/htmlreplay"
+	game "github.com/lwayneh/dem-replay/match"
+)
+
+// htmlStatesPerSecond is the sampling rate of HTML replays unless
+// -statespersecond is given. The player interpolates between the samples.
+const htmlStatesPerSecond = 16
+
+// exportHTMLCommand writes a single HTML file that replays the match or one
+// of its rounds in a browser.
+func exportHTMLCommand(args []string) error {
+	flags := flag.NewFlagSet("export-html", flag.ExitOnError)
+	configFlags(flags)
+	round := flags.Int("round", 0, "Number of the round to export, the whole match if 0")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: ./dem-replay export-html [flags] [path to demo, - to read from stdin] [output .html]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errors.New("export-html needs a demo and an output file")
+	}
+
+	opts := game.Options{
+		FallbackFrameRate: conf.FrameRate,
+		FallbackTickRate:  conf.TickRate,
+		CacheDir:          conf.CacheDir,
+		StatesPerSecond:   conf.StatesPerSecond,
+	}
+	if opts.StatesPerSecond == 0 {
+		opts.StatesPerSecond = htmlStatesPerSecond
+	}
+	match, err := openMatch(context.Background(), flags.Arg(0), opts)
+	if err != nil {
+		return fmt.Errorf("trying to parse demo file: %w", err)
+	}
+	overview, err := loadOverview(match.MapName)
+	if err != nil {
+		return err
+	}
+
+	teamOne, teamTwo := match.GetTeamTags()
+	title := fmt.Sprintf("%v vs %v on %v", teamOne.ClanName, teamTwo.ClanName, match.MapName)
+	start, end := 0, match.StateCount()
+	if *round > 0 {
+		var ok bool
+		start, end, ok = match.RoundFrames(*round)
+		if !ok {
+			return fmt.Errorf("there is no round %d", *round)
+		}
+		// RoundFrames returns the last frame of the round
+		end++
+		title = fmt.Sprintf("%v, round %d", title, *round)
+	}
+
+	file, err := os.Create(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	buffered := bufio.NewWriter(file)
+	err = htmlreplay.Write(buffered, match, overview, start, end, title)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
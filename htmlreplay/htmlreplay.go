@@ -0,0 +1,120 @@
+// Package htmlreplay writes matches into single HTML files that replay them
+// in a browser. The overview, the match data and the player are embedded, so
+// the files work offline and can be shared like any other document.
+package htmlreplay
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"image"
+	"image/jpeg"
+	"io"
+
+	ocom "github.com/lwayneh/dem-replay/common"
+	"github.com/lwayneh/dem-replay/match"
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	meta "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/metadata"
+)
+
+// overviewQuality is the JPEG quality of the embedded overview.
+const overviewQuality = 85
+
+// ErrUnknownMap is returned for matches on maps without overview metadata.
+var ErrUnknownMap = errors.New("no overview metadata for map")
+
+var page = template.Must(template.New("page").Parse(pageTemplate))
+
+// pageData fills the page template.
+type pageData struct {
+	Title string
+	// PosX, PosY and Scale map world to overview coordinates.
+	PosX  float64
+	PosY  float64
+	Scale float64
+	// Constants shared with the Go code, by their names in the player.
+	Equipment map[string]int
+	Teams     map[string]int
+	Phases    map[string]int
+	Weapons   map[int]string
+	// KillfeedSeconds is how long kills stay on the killfeed.
+	KillfeedSeconds float64
+	// Overview is a base64 encoded JPEG, Match a base64 encoded, gzipped
+	// JSON document as written by match.WriteJSONFrames.
+	Overview string
+	Match    string
+}
+
+// Write writes a page replaying the frames of the match from start up to end
+// (exclusive) on the overview image of its map.
+func Write(w io.Writer, m *match.Match, overview image.Image, start, end int, title string) error {
+	mapMeta, ok := meta.MapNameToMap[m.MapName]
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrUnknownMap, m.MapName)
+	}
+
+	var overviewData bytes.Buffer
+	enc := base64.NewEncoder(base64.StdEncoding, &overviewData)
+	if err := jpeg.Encode(enc, overview, &jpeg.Options{Quality: overviewQuality}); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+
+	var matchData bytes.Buffer
+	enc = base64.NewEncoder(base64.StdEncoding, &matchData)
+	zw := gzip.NewWriter(enc)
+	if err := m.WriteJSONFrames(zw, start, end); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+
+	data := pageData{
+		Title: title,
+		PosX:  mapMeta.PZero.X,
+		PosY:  mapMeta.PZero.Y,
+		Scale: mapMeta.Scale,
+		Equipment: map[string]int{
+			"decoy":      int(common.EqDecoy),
+			"molotov":    int(common.EqMolotov),
+			"incendiary": int(common.EqIncendiary),
+			"flash":      int(common.EqFlash),
+			"smoke":      int(common.EqSmoke),
+			"he":         int(common.EqHE),
+		},
+		Teams: map[string]int{
+			"t":  int(common.TeamTerrorists),
+			"ct": int(common.TeamCounterTerrorists),
+		},
+		Phases: map[string]int{
+			"freezetime": int(ocom.PhaseFreezetime),
+			"planted":    int(ocom.PhasePlanted),
+			"warmup":     int(ocom.PhaseWarmup),
+		},
+		Weapons:         weaponNames(),
+		KillfeedSeconds: match.KillfeedDuration.Seconds(),
+		Overview:        overviewData.String(),
+		Match:           matchData.String(),
+	}
+	return page.Execute(w, data)
+}
+
+// weaponNames returns the names of all known equipment types.
+func weaponNames() map[int]string {
+	names := make(map[int]string)
+	for eq := common.EqUnknown + 1; eq <= common.EqHE; eq++ {
+		if name := eq.String(); name != "" {
+			names[int(eq)] = name
+		}
+	}
+	return names
+}
@@ -0,0 +1,417 @@
+package htmlreplay
+
+// pageTemplate is the replay page. The player draws the samples of the match
+// onto a canvas and interpolates the players between them.
+const pageTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { margin: 0; background: #111; color: #ddd; font: 14px sans-serif; }
+#main { display: flex; gap: 12px; padding: 12px; }
+#map { background: #000; max-height: calc(100vh - 90px); max-width: 100%; aspect-ratio: 1; }
+#side { min-width: 280px; }
+#header { font-size: 18px; margin-bottom: 8px; }
+#timer.planted { color: #f44; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 12px; }
+td { padding: 2px 4px; white-space: nowrap; }
+tr.dead { opacity: .4; }
+.ct { color: #5b9bd5; }
+.t { color: #e8a33d; }
+.hp { width: 60px; height: 6px; background: #333; }
+.hp div { height: 100%; background: #4c4; }
+#killfeed div { margin-bottom: 2px; }
+#controls { display: flex; align-items: center; gap: 8px; padding: 0 12px 12px; }
+#scrub { flex: 1; }
+#message { padding: 12px; }
+</style>
+</head>
+<body>
+<div id="message">Loading replay…</div>
+<div id="main" hidden>
+  <canvas id="map"></canvas>
+  <div id="side">
+    <div id="header"><span id="score"></span> · <span id="round"></span> · <span id="timer"></span></div>
+    <table id="ct"></table>
+    <table id="t"></table>
+    <div id="killfeed"></div>
+  </div>
+</div>
+<div id="controls" hidden>
+  <button id="play" title="Space">Play</button>
+  <button id="previous" title="Q">&#x23EE;</button>
+  <select id="rounds"></select>
+  <button id="next" title="E">&#x23ED;</button>
+  <input id="scrub" type="range" min="0" value="0">
+  <select id="speed">
+    <option value="0.5">0.5×</option>
+    <option value="1" selected>1×</option>
+    <option value="2">2×</option>
+    <option value="4">4×</option>
+    <option value="8">8×</option>
+  </select>
+</div>
+<script>
+"use strict";
+const MAP = {x: {{.PosX}}, y: {{.PosY}}, scale: {{.Scale}}};
+const EQ = {{.Equipment}};
+const TEAM = {{.Teams}};
+const PHASE = {{.Phases}};
+const WEAPONS = {{.Weapons}};
+const KILLFEED_SECONDS = {{.KillfeedSeconds}};
+const OVERVIEW = {{.Overview}};
+const MATCH = {{.Match}};
+
+const SEEK_SECONDS = 5;
+const SMOKE_RADIUS = 144;
+const COLORS = {ct: "#5b9bd5", t: "#e8a33d"};
+
+const canvas = document.getElementById("map");
+const ctx = canvas.getContext("2d");
+let match, overview;
+let time = 0, playing = false, speed = 1, last = null, drawnFrame = -1;
+
+function $(id) { return document.getElementById(id); }
+
+async function decode(data) {
+  const bytes = Uint8Array.from(atob(data), function (c) { return c.charCodeAt(0); });
+  const stream = new Blob([bytes]).stream().pipeThrough(new DecompressionStream("gzip"));
+  return JSON.parse(await new Response(stream).text());
+}
+
+function loadImage(src) {
+  return new Promise(function (resolve, reject) {
+    const img = new Image();
+    img.onload = function () { resolve(img); };
+    img.onerror = reject;
+    img.src = src;
+  });
+}
+
+function screen(x, y) {
+  return [(x - MAP.x) / MAP.scale, (MAP.y - y) / MAP.scale];
+}
+
+function teamClass(team) {
+  return team === TEAM.ct ? "ct" : team === TEAM.t ? "t" : "";
+}
+
+function clock(ms) {
+  const seconds = Math.max(0, Math.ceil(ms / 1000));
+  return Math.floor(seconds / 60) + ":" + String(seconds % 60).padStart(2, "0");
+}
+
+function escapeHTML(s) {
+  const div = document.createElement("div");
+  div.textContent = s;
+  return div.innerHTML;
+}
+
+function lastFrame() {
+  return match.samples.length - 1;
+}
+
+function frameAt(t) {
+  return Math.min(lastFrame(), Math.max(0, Math.floor(t * match.frameRate)));
+}
+
+function roundAt(frame) {
+  let index = -1;
+  match.rounds.forEach(function (round, i) {
+    if (round.startFrame <= frame) {
+      index = i;
+    }
+  });
+  return index;
+}
+
+function seek(t) {
+  time = Math.min(lastFrame() / match.frameRate, Math.max(0, t));
+  drawnFrame = -1;
+}
+
+function jumpToRound(index) {
+  if (index >= 0 && index < match.rounds.length) {
+    seek(Math.max(0, match.rounds[index].startFrame) / match.frameRate);
+  }
+}
+
+function setPlaying(p) {
+  playing = p;
+  if (playing && frameAt(time) >= lastFrame()) {
+    seek(0);
+  }
+  $("play").textContent = playing ? "Pause" : "Play";
+}
+
+function lerpAngle(a, b, f) {
+  let d = ((b - a) % 360 + 540) % 360 - 180;
+  return a + d * f;
+}
+
+function playerKey(p) {
+  return p.steamId + "/" + p.name;
+}
+
+function drawEffects(frame) {
+  for (const e of match.grenadeEffects) {
+    if (e.startFrame > frame || frame >= e.endFrame) {
+      continue;
+    }
+    const [x, y] = screen(e.position.x, e.position.y);
+    ctx.beginPath();
+    if (e.type === EQ.smoke) {
+      ctx.fillStyle = "rgba(200, 200, 200, 0.6)";
+      ctx.arc(x, y, SMOKE_RADIUS / MAP.scale, 0, 2 * Math.PI);
+      ctx.fill();
+    } else if (e.type === EQ.flash) {
+      ctx.fillStyle = "rgba(255, 255, 255, 0.8)";
+      ctx.arc(x, y, 8, 0, 2 * Math.PI);
+      ctx.fill();
+    } else if (e.type === EQ.he) {
+      ctx.strokeStyle = "rgba(255, 60, 0, 0.9)";
+      ctx.lineWidth = 3;
+      ctx.arc(x, y, 350 / MAP.scale, 0, 2 * Math.PI);
+      ctx.stroke();
+    } else if (e.type === EQ.decoy) {
+      ctx.strokeStyle = "rgba(255, 255, 255, 0.6)";
+      ctx.lineWidth = 2;
+      ctx.arc(x, y, 6, 0, 2 * Math.PI);
+      ctx.stroke();
+    }
+  }
+}
+
+function drawInfernos(sample) {
+  ctx.fillStyle = "rgba(255, 90, 0, 0.5)";
+  for (const inferno of sample.infernos) {
+    ctx.beginPath();
+    inferno.hull.forEach(function (p, i) {
+      const [x, y] = screen(p.x, p.y);
+      if (i === 0) {
+        ctx.moveTo(x, y);
+      } else {
+        ctx.lineTo(x, y);
+      }
+    });
+    ctx.closePath();
+    ctx.fill();
+  }
+}
+
+function drawShots(frame) {
+  ctx.lineWidth = 1;
+  for (const shot of match.shots) {
+    if (shot.startFrame > frame || frame >= shot.endFrame) {
+      continue;
+    }
+    const [x, y] = screen(shot.position.x, shot.position.y);
+    const yaw = shot.viewX * Math.PI / 180;
+    const length = shot.awp ? 600 : 300;
+    ctx.strokeStyle = shot.awp ? "rgba(255, 255, 255, 0.9)" : "rgba(255, 255, 150, 0.6)";
+    ctx.beginPath();
+    ctx.moveTo(x, y);
+    ctx.lineTo(x + Math.cos(yaw) * length, y - Math.sin(yaw) * length);
+    ctx.stroke();
+  }
+}
+
+function drawPlayers(sample, next, fraction) {
+  const following = new Map();
+  for (const p of next.players) {
+    following.set(playerKey(p), p);
+  }
+  for (const p of sample.players) {
+    let x = p.x, y = p.y, yaw = p.viewX;
+    const n = following.get(playerKey(p));
+    if (n && p.health > 0 && n.health > 0) {
+      x += (n.x - x) * fraction;
+      y += (n.y - y) * fraction;
+      yaw = lerpAngle(yaw, n.viewX, fraction);
+    }
+    const [sx, sy] = screen(x, y);
+    const color = COLORS[teamClass(p.team)] || "#aaa";
+    if (p.health <= 0) {
+      ctx.strokeStyle = color;
+      ctx.lineWidth = 2;
+      ctx.beginPath();
+      ctx.moveTo(sx - 5, sy - 5);
+      ctx.lineTo(sx + 5, sy + 5);
+      ctx.moveTo(sx + 5, sy - 5);
+      ctx.lineTo(sx - 5, sy + 5);
+      ctx.stroke();
+      continue;
+    }
+    const angle = yaw * Math.PI / 180;
+    ctx.strokeStyle = "#fff";
+    ctx.lineWidth = 2;
+    ctx.beginPath();
+    ctx.moveTo(sx, sy);
+    ctx.lineTo(sx + Math.cos(angle) * 18, sy - Math.sin(angle) * 18);
+    ctx.stroke();
+    ctx.fillStyle = p.flashMs > 0 ? "#fff" : color;
+    ctx.beginPath();
+    ctx.arc(sx, sy, 8, 0, 2 * Math.PI);
+    ctx.fill();
+    if (p.hasBomb) {
+      ctx.fillStyle = "#f33";
+      ctx.fillRect(sx - 3, sy - 3, 6, 6);
+    }
+    ctx.fillStyle = "#fff";
+    ctx.font = "12px sans-serif";
+    ctx.textAlign = "center";
+    ctx.fillText(p.name, sx, sy - 12);
+  }
+}
+
+function drawGrenades(sample) {
+  for (const g of sample.grenades) {
+    const [x, y] = screen(g.x, g.y);
+    ctx.fillStyle = g.type === EQ.smoke ? "#ccc" : g.type === EQ.flash ? "#fff" : g.type === EQ.he ? "#f60" :
+      g.type === EQ.molotov || g.type === EQ.incendiary ? "#f90" : "#999";
+    ctx.beginPath();
+    ctx.arc(x, y, 4, 0, 2 * Math.PI);
+    ctx.fill();
+  }
+}
+
+function drawBomb(sample) {
+  if (sample.players.some(function (p) { return p.hasBomb; })) {
+    return;
+  }
+  const [x, y] = screen(sample.bomb.x, sample.bomb.y);
+  ctx.fillStyle = "#f33";
+  ctx.fillRect(x - 5, y - 5, 10, 10);
+}
+
+function updatePanel(frame, sample) {
+  const planted = sample.phase === PHASE.planted;
+  $("score").innerHTML = '<span class="ct">' + escapeHTML(sample.clanNameCT || "CT") + " " + sample.scoreCT +
+    '</span> : <span class="t">' + sample.scoreT + " " + escapeHTML(sample.clanNameT || "T") + "</span>";
+  const round = roundAt(frame);
+  $("round").textContent = round >= 0 ? "Round " + match.rounds[round].number : "Warmup";
+  $("timer").textContent = sample.phase === PHASE.warmup ? "Warmup" : clock(sample.remainingMs);
+  $("timer").className = planted ? "planted" : "";
+  if (round >= 0) {
+    $("rounds").value = round;
+  }
+
+  for (const team of ["ct", "t"]) {
+    const rows = sample.players.filter(function (p) { return teamClass(p.team) === team; }).map(function (p) {
+      return "<tr" + (p.health > 0 ? "" : ' class="dead"') + '><td class="' + team + '">' + escapeHTML(p.name) +
+        (p.hasBomb ? " 💣" : "") + (p.kit ? " ✂" : "") + '</td><td><div class="hp"><div style="width: ' +
+        Math.max(0, p.health) + '%"></div></div></td><td>' + p.health + "</td><td>$" + p.money + "</td><td>" +
+        p.kills + "/" + p.deaths + "</td><td>" + escapeHTML(WEAPONS[p.activeWeapon] || "") + "</td></tr>";
+    });
+    $(team).innerHTML = rows.join("");
+  }
+
+  const visible = KILLFEED_SECONDS * match.frameRate;
+  const kills = match.kills.filter(function (k) { return k.frame <= frame && frame < k.frame + visible; });
+  $("killfeed").innerHTML = kills.slice(-6).map(function (k) {
+    return '<div><span class="' + teamClass(k.killer.team) + '">' + escapeHTML(k.killer.name) + "</span> [" +
+      escapeHTML(k.weapon) + (k.headshot ? ", HS" : "") + '] <span class="' + teamClass(k.victim.team) + '">' +
+      escapeHTML(k.victim.name) + "</span></div>";
+  }).join("");
+}
+
+function draw() {
+  const frame = frameAt(time);
+  const sample = match.samples[frame];
+  const next = match.samples[Math.min(frame + 1, lastFrame())];
+  const fraction = Math.min(1, Math.max(0, time * match.frameRate - frame));
+
+  ctx.drawImage(overview, 0, 0, canvas.width, canvas.height);
+  drawEffects(frame);
+  drawInfernos(sample);
+  drawShots(frame);
+  drawPlayers(sample, next, fraction);
+  drawGrenades(sample);
+  drawBomb(sample);
+
+  if (frame !== drawnFrame) {
+    updatePanel(frame, sample);
+    $("scrub").value = frame;
+    drawnFrame = frame;
+  }
+}
+
+function animate(now) {
+  if (playing && last !== null) {
+    time += (now - last) / 1000 * speed;
+    if (frameAt(time) >= lastFrame()) {
+      seek(lastFrame() / match.frameRate);
+      setPlaying(false);
+    }
+  }
+  last = now;
+  draw();
+  requestAnimationFrame(animate);
+}
+
+function setupControls() {
+  $("scrub").max = lastFrame();
+  $("rounds").innerHTML = match.rounds.map(function (round, i) {
+    return '<option value="' + i + '">Round ' + round.number + "</option>";
+  }).join("");
+
+  $("play").onclick = function () { setPlaying(!playing); };
+  $("previous").onclick = function () { jumpToRound(roundAt(frameAt(time)) - 1); };
+  $("next").onclick = function () { jumpToRound(roundAt(frameAt(time)) + 1); };
+  $("rounds").onchange = function (e) { jumpToRound(Number(e.target.value)); };
+  $("scrub").oninput = function (e) { seek(Number(e.target.value) / match.frameRate); };
+  $("speed").onchange = function (e) { speed = Number(e.target.value); };
+  document.addEventListener("keydown", function (e) {
+    if (e.target.tagName === "SELECT" || e.target.tagName === "INPUT") {
+      return;
+    }
+    switch (e.key) {
+    case " ":
+      setPlaying(!playing);
+      break;
+    case "ArrowLeft":
+      seek(time - SEEK_SECONDS);
+      break;
+    case "ArrowRight":
+      seek(time + SEEK_SECONDS);
+      break;
+    case "q":
+      $("previous").onclick();
+      break;
+    case "e":
+      $("next").onclick();
+      break;
+    default:
+      return;
+    }
+    e.preventDefault();
+  });
+}
+
+async function main() {
+  if (typeof DecompressionStream === "undefined") {
+    $("message").textContent = "This browser can't unpack the replay, please open it in a current version of Chrome, Firefox, Edge or Safari.";
+    return;
+  }
+  try {
+    [match, overview] = await Promise.all([decode(MATCH), loadImage("data:image/jpeg;base64," + OVERVIEW)]);
+  } catch (err) {
+    $("message").textContent = "Loading the replay failed: " + err;
+    return;
+  }
+  canvas.width = overview.naturalWidth;
+  canvas.height = overview.naturalHeight;
+  setupControls();
+  $("message").hidden = true;
+  $("main").hidden = false;
+  $("controls").hidden = false;
+  requestAnimationFrame(animate);
+}
+
+main();
+</script>
+</body>
+</html>
+`
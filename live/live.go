@@ -0,0 +1,262 @@
+// Package live streams the state of a viewer session over a websocket, so
+// browser overlays and second screens can follow the playback position of
+// the viewer. Clients can also control playback over the same connection.
+//
+// The server sends text messages with a JSON object of type "state" whenever
+// the playback position or state changes, at most at the rate of the stream.
+// A client may lower or raise the rate with the rate query parameter of the
+// connection, e.g. ws://localhost:8081/?rate=4.
+//
+// Clients send commands as JSON objects:
+//
+//	{"command": "play"}
+//	{"command": "pause"}
+//	{"command": "toggle"}
+//	{"command": "seek", "tick": 12345}
+//	{"command": "seek", "frame": 500}
+//	{"command": "seek", "fraction": 0.5}
+//	{"command": "seek", "round": 12}
+//	{"command": "speed", "speed": 2}
+//	{"command": "nextRound"}
+//	{"command": "previousRound"}
+//
+// Commands that can't be applied are answered with a message of type
+// "error".
+//
+// Browsers only connect from pages served by the host of the stream itself.
+// Handshakes with the Origin of any other page are rejected, so websites open
+// in the browser can't control the viewer. Clients that aren't browsers send
+// no Origin and are accepted. The stream has to be reached by a loopback
+// address, localhost or the host it listens on; handshakes naming any other
+// host are rejected, which stops DNS rebinding.
+package live
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/lwayneh/dem-replay/match"
+	"github.com/lwayneh/dem-replay/playback"
+	"github.com/lwayneh/dem-replay/viewer"
+)
+
+const (
+	// DefaultRate is the default number of states sent per second.
+	DefaultRate = 10
+	// MaxRate is the highest rate clients may ask for.
+	MaxRate = 60
+)
+
+// Stream serves the state of a session to websocket clients.
+type Stream struct {
+	session *viewer.Session
+	rate    float64
+	hosts   hostAllowlist
+}
+
+// New returns a stream of the session sending at most rate states per
+// second, DefaultRate if rate isn't positive. addr is the address the stream
+// is served on.
+func New(session *viewer.Session, rate float64, addr string) *Stream {
+	if rate <= 0 {
+		rate = DefaultRate
+	}
+	if rate > MaxRate {
+		rate = MaxRate
+	}
+	return &Stream{session: session, rate: rate, hosts: newHostAllowlist(addr)}
+}
+
+// stateMessage is the state of the session sent to clients.
+type stateMessage struct {
+	Type       string  `json:"type"`
+	Frame      int     `json:"frame"`
+	Round      int     `json:"round"`
+	Paused     bool    `json:"paused"`
+	Speed      float64 `json:"speed"`
+	Reverse    bool    `json:"reverse"`
+	PositionMs int64   `json:"positionMs"`
+	DurationMs int64   `json:"durationMs"`
+	// Sample and Killfeed use the schema of match.WriteJSON.
+	Sample   match.JSONSample `json:"sample"`
+	Killfeed []match.JSONKill `json:"killfeed"`
+}
+
+// errorMessage answers a command that couldn't be applied.
+type errorMessage struct {
+	Type  string `json:"type"`
+	Error string `json:"error"`
+}
+
+// command is a message of a client.
+type command struct {
+	Command  string   `json:"command"`
+	Tick     *int     `json:"tick"`
+	Frame    *int     `json:"frame"`
+	Fraction *float64 `json:"fraction"`
+	Round    *int     `json:"round"`
+	Speed    float64  `json:"speed"`
+}
+
+// playbackState is what decides whether clients need a new state.
+type playbackState struct {
+	frame   int
+	paused  bool
+	speed   float64
+	reverse bool
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Stream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rate := s.rate
+	if value := r.URL.Query().Get("rate"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 0 || parsed > MaxRate {
+			http.Error(w, fmt.Sprintf("rate must be a number between 0 and %v", MaxRate), http.StatusBadRequest)
+			return
+		}
+		rate = parsed
+	}
+
+	c, err := upgrade(w, r, s.hosts)
+	if err != nil {
+		return
+	}
+	defer c.close(websocket.CloseNormalClosure)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.readCommands(c)
+	}()
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+	defer ticker.Stop()
+	last := playbackState{frame: -1}
+	for {
+		current := s.playbackState()
+		if current != last {
+			if err := s.send(c, s.stateMessage(current)); err != nil {
+				return
+			}
+			last = current
+		}
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+	}
+}
+
+func (s *Stream) playbackState() playbackState {
+	playhead := s.session.Playhead()
+	return playbackState{
+		frame:   s.session.Frame(),
+		paused:  playhead.Paused(),
+		speed:   playhead.Speed(),
+		reverse: playhead.Reverse(),
+	}
+}
+
+func (s *Stream) stateMessage(state playbackState) stateMessage {
+	m := s.session.Match()
+	timeline := m.Timeline()
+	round := 0
+	if r := m.RoundAt(state.frame); r != nil {
+		round = r.Number
+	}
+	return stateMessage{
+		Type:       "state",
+		Frame:      state.frame,
+		Round:      round,
+		Paused:     state.paused,
+		Speed:      state.speed,
+		Reverse:    state.reverse,
+		PositionMs: int64(timeline.Time(state.frame) / time.Millisecond),
+		DurationMs: int64(timeline.Duration() / time.Millisecond),
+		Sample:     m.JSONSample(state.frame),
+		Killfeed:   m.JSONKillfeed(state.frame),
+	}
+}
+
+// readCommands applies the commands of the client until it disconnects.
+func (s *Stream) readCommands(c *conn) {
+	for {
+		data, err := c.readMessage()
+		if err != nil {
+			if err != errClosed {
+				log.Println("reading live stream command:", err)
+			}
+			return
+		}
+		var cmd command
+		if err = json.Unmarshal(data, &cmd); err != nil {
+			err = fmt.Errorf("invalid command: %w", err)
+		} else {
+			err = s.apply(cmd)
+		}
+		if err != nil {
+			if err := s.send(c, errorMessage{Type: "error", Error: err.Error()}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// apply applies the command to the session.
+func (s *Stream) apply(cmd command) error {
+	m := s.session.Match()
+	playhead := s.session.Playhead()
+	switch cmd.Command {
+	case "play":
+		playhead.Play()
+	case "pause":
+		playhead.Pause()
+	case "toggle":
+		s.session.Handle(viewer.TogglePause)
+	case "nextRound":
+		s.session.Handle(viewer.NextRound)
+	case "previousRound":
+		s.session.Handle(viewer.PreviousRound)
+	case "speed":
+		if cmd.Speed < playback.MinSpeed || cmd.Speed > playback.MaxSpeed {
+			return fmt.Errorf("speed must be between %v and %v", playback.MinSpeed, playback.MaxSpeed)
+		}
+		playhead.SetSpeed(cmd.Speed)
+	case "seek":
+		switch {
+		case cmd.Tick != nil:
+			playhead.SeekFrame(m.Timeline().FrameOfTick(*cmd.Tick))
+		case cmd.Frame != nil:
+			playhead.SeekFrame(*cmd.Frame)
+		case cmd.Fraction != nil:
+			s.session.SeekFraction(*cmd.Fraction)
+		case cmd.Round != nil:
+			start, _, ok := m.RoundFrames(*cmd.Round)
+			if !ok {
+				return fmt.Errorf("there is no round %d", *cmd.Round)
+			}
+			playhead.SeekFrame(start)
+		default:
+			return errors.New("seek needs a tick, frame, fraction or round")
+		}
+	default:
+		return fmt.Errorf("unknown command %q", cmd.Command)
+	}
+	return nil
+}
+
+func (s *Stream) send(c *conn, message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return c.writeText(data)
+}
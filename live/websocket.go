@@ -0,0 +1,148 @@
+package live
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxMessageSize is the largest message accepted from clients. Commands are
+// far smaller.
+const maxMessageSize = 64 << 10
+
+// writeTimeout is how long writing a message may take before the client is
+// considered gone.
+const writeTimeout = 10 * time.Second
+
+var (
+	errHost = errors.New("websocket handshake for another host")
+	// errClosed is returned by readMessage once the client closed the
+	// connection.
+	errClosed = errors.New("websocket closed")
+)
+
+// upgrader keeps the default origin check, which rejects handshakes with the
+// Origin of another host. Browsers let any page open websockets to any host,
+// so without it every page open in the browser could control the viewer.
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// conn is the server side of a websocket connection. Reading is only done by
+// one goroutine, writing is safe for concurrent use.
+type conn struct {
+	ws *websocket.Conn
+
+	writeMu sync.Mutex
+	closed  bool
+}
+
+// upgrade completes the websocket handshake of the request and takes over
+// its connection. Handshakes are only accepted for the hosts in allowed.
+func upgrade(w http.ResponseWriter, r *http.Request, allowed hostAllowlist) (*conn, error) {
+	if !allowed.contains(r.Host) {
+		http.Error(w, "websocket connections to other hosts are not allowed", http.StatusForbidden)
+		return nil, errHost
+	}
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+	ws.SetReadLimit(maxMessageSize)
+	return &conn{ws: ws}, nil
+}
+
+// hostAllowlist holds the host names the stream may be reached by besides
+// the loopback ones.
+//
+// The Origin check alone does not protect against DNS rebinding: a page of
+// an attacker's domain that resolves to 127.0.0.1 has the same origin as the
+// host it sends the handshake to. Its Host header still names that domain.
+type hostAllowlist []string
+
+// newHostAllowlist allows the host of the listen address, unless it listens
+// on all interfaces.
+func newHostAllowlist(addr string) hostAllowlist {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		return nil
+	}
+	return hostAllowlist{host}
+}
+
+// contains reports whether the Host header of a request names a loopback
+// host or one of the allowed hosts. The port is ignored.
+func (l hostAllowlist) contains(hostHeader string) bool {
+	host, _, err := net.SplitHostPort(hostHeader)
+	if err != nil {
+		host = hostHeader
+	}
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return true
+	}
+	for _, allowed := range l {
+		if strings.EqualFold(host, strings.Trim(allowed, "[]")) {
+			return true
+		}
+	}
+	return false
+}
+
+// readMessage returns the next text message. Pings are answered while
+// waiting for it. It returns errClosed once the client closed the
+// connection.
+func (c *conn) readMessage() ([]byte, error) {
+	op, message, err := c.ws.ReadMessage()
+	if err != nil {
+		if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+			c.close(websocket.CloseNormalClosure)
+			return nil, errClosed
+		}
+		if err == websocket.ErrReadLimit {
+			c.close(websocket.CloseMessageTooBig)
+		}
+		return nil, err
+	}
+	if op != websocket.TextMessage {
+		c.close(websocket.CloseUnsupportedData)
+		return nil, errors.New("websocket message is not text")
+	}
+	return message, nil
+}
+
+// writeText sends the data as a text message.
+func (c *conn) writeText(data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return errClosed
+	}
+	c.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return c.ws.WriteMessage(websocket.TextMessage, data)
+}
+
+// close sends a close frame with the status code and closes the connection.
+// Calling it again has no effect.
+func (c *conn) close(code int) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(writeTimeout))
+	c.ws.Close()
+}
@@ -0,0 +1,214 @@
+package live
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// serve starts a server that upgrades every request with the handler and
+// returns the websocket URL of the server.
+func serve(t *testing.T, allowed hostAllowlist, handle func(*conn)) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrade(w, r, allowed)
+		if err != nil {
+			return
+		}
+		handle(c)
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// dial connects to the server and fails the test if the handshake fails.
+func dial(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return ws
+}
+
+// closeCode returns the status code of the close frame the client received,
+// or -1 if it got no close frame.
+func closeCode(ws *websocket.Conn) int {
+	for {
+		if _, _, err := ws.ReadMessage(); err != nil {
+			if closeErr, ok := err.(*websocket.CloseError); ok {
+				return closeErr.Code
+			}
+			return -1
+		}
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	long := bytes.Repeat([]byte("a"), maxMessageSize)
+	messages := make(chan []byte, 4)
+	errs := make(chan error, 1)
+	url := serve(t, nil, func(c *conn) {
+		for {
+			message, err := c.readMessage()
+			if err != nil {
+				errs <- err
+				return
+			}
+			messages <- message
+		}
+	})
+
+	ws := dial(t, url)
+	for _, message := range [][]byte{[]byte(`{"command":"play"}`), long} {
+		if err := ws.WriteMessage(websocket.TextMessage, message); err != nil {
+			t.Fatal(err)
+		}
+		if got := <-messages; !bytes.Equal(got, message) {
+			t.Fatalf("got message of %d bytes %.20q, want %d bytes %.20q", len(got), got, len(message), message)
+		}
+	}
+	ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	if err := <-errs; err != errClosed {
+		t.Fatalf("got %v after a close frame, want %v", err, errClosed)
+	}
+	if code := closeCode(ws); code != websocket.CloseNormalClosure {
+		t.Errorf("got close code %d, want %d", code, websocket.CloseNormalClosure)
+	}
+}
+
+func TestReadMessageErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		op      int
+		message []byte
+		code    int
+	}{
+		{"binary", websocket.BinaryMessage, []byte{1, 2}, websocket.CloseUnsupportedData},
+		{"too big", websocket.TextMessage, make([]byte, maxMessageSize+1), websocket.CloseMessageTooBig},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			url := serve(t, nil, func(c *conn) {
+				if _, err := c.readMessage(); err == nil {
+					t.Error("read a message that should have been rejected")
+				}
+			})
+			ws := dial(t, url)
+			ws.WriteMessage(test.op, test.message)
+			if code := closeCode(ws); code != test.code {
+				t.Errorf("got close code %d, want %d", code, test.code)
+			}
+		})
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	url := serve(t, nil, func(c *conn) {
+		c.writeText([]byte("hello"))
+		c.close(websocket.CloseNormalClosure)
+		if err := c.writeText([]byte("late")); err != errClosed {
+			t.Errorf("got %v writing to a closed connection, want %v", err, errClosed)
+		}
+	})
+	ws := dial(t, url)
+	op, message, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op != websocket.TextMessage || string(message) != "hello" {
+		t.Errorf("got message %q of type %d, want the text hello", message, op)
+	}
+	if code := closeCode(ws); code != websocket.CloseNormalClosure {
+		t.Errorf("got close code %d, want %d", code, websocket.CloseNormalClosure)
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	url := serve(t, hostAllowlist{"viewer.lan"}, func(c *conn) {
+		c.writeText([]byte("hello"))
+		c.close(websocket.CloseNormalClosure)
+	})
+	port := url[strings.LastIndex(url, ":"):]
+
+	accepted := []http.Header{
+		// no origin
+		{},
+		{"Origin": {"http://127.0.0.1" + port}},
+		{"Host": {"localhost" + port}, "Origin": {"http://localhost" + port}},
+		{"Host": {"viewer.lan" + port}},
+		{"Host": {"[::1]" + port}},
+	}
+	for _, header := range accepted {
+		ws, resp, err := websocket.DefaultDialer.Dial(url, header)
+		if err != nil {
+			t.Errorf("header %v: %v", header, err)
+			continue
+		}
+		if resp.StatusCode != http.StatusSwitchingProtocols {
+			t.Errorf("header %v: got status %v", header, resp.Status)
+		}
+		ws.Close()
+	}
+
+	rejected := []struct {
+		name   string
+		header http.Header
+	}{
+		{"other origin", http.Header{"Origin": {"http://example.com"}}},
+		{"other port", http.Header{"Origin": {"http://127.0.0.1:1"}}},
+		{"null origin", http.Header{"Origin": {"null"}}},
+		// a domain of an attacker that resolves to 127.0.0.1
+		{"rebound host", http.Header{"Host": {"attacker.example" + port}, "Origin": {"http://attacker.example" + port}}},
+		{"rebound host without origin", http.Header{"Host": {"attacker.example" + port}}},
+	}
+	for _, test := range rejected {
+		_, resp, err := websocket.DefaultDialer.Dial(url, test.header)
+		if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+			t.Errorf("%v: got response %v, error %v, want %d", test.name, resp, err, http.StatusForbidden)
+		}
+	}
+
+	resp, err := http.Get("http" + strings.TrimPrefix(url, "ws"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %v without a handshake, want %d", resp.Status, http.StatusBadRequest)
+	}
+}
+
+func TestHostAllowlist(t *testing.T) {
+	tests := []struct {
+		addr string
+		host string
+		want bool
+	}{
+		{"localhost:8081", "localhost:8081", true},
+		{"localhost:8081", "127.0.0.1:8081", true},
+		{"localhost:8081", "127.1.2.3", true},
+		{"localhost:8081", "[::1]:8081", true},
+		{"localhost:8081", "LOCALHOST.:8081", true},
+		{"localhost:8081", "192.168.1.5:8081", false},
+		{"192.168.1.5:8081", "192.168.1.5:8081", true},
+		{"viewer.lan:8081", "Viewer.lan:8081", true},
+		{"[fe80::1]:8081", "[fe80::1]:8081", true},
+		// listening on all interfaces only allows loopback hosts
+		{":8081", "192.168.1.5:8081", false},
+		{"0.0.0.0:8081", "0.0.0.0:8081", false},
+		{":8081", "attacker.example:8081", false},
+	}
+	for _, test := range tests {
+		if got := newHostAllowlist(test.addr).contains(test.host); got != test.want {
+			t.Errorf("listening on %v: contains(%v) = %v, want %v", test.addr, test.host, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package match
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	ocom "github.com/lwayneh/dem-replay/common"
+	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	event "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+)
+
+// Durations of the bomb interactions.
+const (
+	PlantDuration     = 3 * time.Second
+	DefuseDuration    = 10 * time.Second
+	DefuseDurationKit = 5 * time.Second
+)
+
+func registerBombHandlers(parser dem.Parser, match *Match) {
+	record := func(eventType ocom.BombEventType, player *common.Player, site rune, hasKit bool) {
+		bombEvent := ocom.BombEvent{
+			Frame:    match.frame(),
+			Tick:     parser.GameState().IngameTick(),
+			Type:     eventType,
+			Site:     site,
+			Position: parser.GameState().Bomb().Position(),
+			HasKit:   hasKit,
+		}
+		if player != nil {
+			bombEvent.PlayerName = player.Name
+			bombEvent.PlayerTeam = player.Team
+			bombEvent.PlayerSteamID = player.SteamID64
+			bombEvent.Position = player.LastAlivePosition
+		}
+		match.BombEvents = append(match.BombEvents, bombEvent)
+	}
+
+	parser.RegisterEventHandler(func(e event.BombPickup) {
+		record(ocom.BombPickup, e.Player, 0, false)
+	})
+	parser.RegisterEventHandler(func(e event.BombDropped) {
+		record(ocom.BombDropped, e.Player, 0, false)
+	})
+	parser.RegisterEventHandler(func(e event.BombPlantBegin) {
+		record(ocom.BombPlantBegin, e.Player, rune(e.Site), false)
+	})
+	parser.RegisterEventHandler(func(e event.BombPlantAborted) {
+		record(ocom.BombPlantAborted, e.Player, 0, false)
+	})
+	parser.RegisterEventHandler(func(e event.BombPlanted) {
+		record(ocom.BombPlanted, e.Player, rune(e.Site), false)
+	})
+	parser.RegisterEventHandler(func(e event.BombDefuseStart) {
+		record(ocom.BombDefuseStart, e.Player, 0, e.HasKit)
+	})
+	parser.RegisterEventHandler(func(e event.BombDefuseAborted) {
+		record(ocom.BombDefuseAborted, e.Player, 0, false)
+	})
+	parser.RegisterEventHandler(func(e event.BombDefused) {
+		record(ocom.BombDefused, e.Player, rune(e.Site), false)
+	})
+	parser.RegisterEventHandler(func(e event.BombExplode) {
+		record(ocom.BombExplode, e.Player, rune(e.Site), false)
+	})
+}
+
+// roundBombEvents returns the bomb events of the current round up to the
+// specified frame.
+func (m *Match) roundBombEvents(frame int) []ocom.BombEvent {
+	roundStart := 0
+	if round := m.RoundAt(frame); round != nil {
+		roundStart = round.StartFrame
+	}
+	from := sort.Search(len(m.BombEvents), func(i int) bool {
+		return m.BombEvents[i].Frame >= roundStart
+	})
+	to := sort.Search(len(m.BombEvents), func(i int) bool {
+		return m.BombEvents[i].Frame > frame
+	})
+	if to < from {
+		return nil
+	}
+	return m.BombEvents[from:to]
+}
+
+// LastBombEvent returns the latest bomb event of the current round at the
+// specified frame.
+func (m *Match) LastBombEvent(frame int) (ocom.BombEvent, bool) {
+	events := m.roundBombEvents(frame)
+	if len(events) == 0 {
+		return ocom.BombEvent{}, false
+	}
+	return events[len(events)-1], true
+}
+
+// BombAction is a plant or defuse that is going on.
+type BombAction struct {
+	// Start is the BombPlantBegin or BombDefuseStart event of the player.
+	Start ocom.BombEvent
+	// Progress goes from 0 to 1 until the plant or defuse is done.
+	Progress float64
+}
+
+// BombActions returns the plants and defuses that are going on at the
+// specified frame, at most one per player. Several players may defuse at the
+// same time, for example when one of them fakes the defuse.
+func (m *Match) BombActions(frame int) []BombAction {
+	var starts []ocom.BombEvent
+	end := func(e ocom.BombEvent) {
+		for i, start := range starts {
+			if ocom.SamePlayer(start.PlayerSteamID, start.PlayerName, e.PlayerSteamID, e.PlayerName) {
+				starts = append(starts[:i], starts[i+1:]...)
+				return
+			}
+		}
+	}
+	for _, e := range m.roundBombEvents(frame) {
+		switch e.Type {
+		case ocom.BombPlantBegin, ocom.BombDefuseStart:
+			end(e)
+			starts = append(starts, e)
+		case ocom.BombPlantAborted, ocom.BombPlanted, ocom.BombDefuseAborted:
+			end(e)
+		case ocom.BombDefused, ocom.BombExplode:
+			starts = nil
+		}
+	}
+
+	timeline := m.Timeline()
+	actions := make([]BombAction, len(starts))
+	for i, start := range starts {
+		duration := PlantDuration
+		if start.Type == ocom.BombDefuseStart {
+			duration = DefuseDuration
+			if start.HasKit {
+				duration = DefuseDurationKit
+			}
+		}
+		elapsed := timeline.Time(frame) - timeline.Time(start.Frame)
+		actions[i] = BombAction{Start: start, Progress: math.Min(elapsed.Seconds()/duration.Seconds(), 1)}
+	}
+	return actions
+}
@@ -0,0 +1,68 @@
+package match
+
+import (
+	"math"
+	"testing"
+
+	ocom "github.com/lwayneh/dem-replay/common"
+)
+
+func TestBombActions(t *testing.T) {
+	// a frame every tick at 10 ticks per second, so a frame is 100ms
+	b := newStateBuilder()
+	for f := 0; f < 200; f++ {
+		b.append(frameValues{tick: f, bombCarrier: -1})
+	}
+	bomb := func(frame int, eventType ocom.BombEventType, player string, hasKit bool) ocom.BombEvent {
+		return ocom.BombEvent{Frame: frame, Type: eventType, PlayerName: player, HasKit: hasKit}
+	}
+	m := &Match{
+		FrameRate:   10,
+		TickRate:    10,
+		TotalFrames: 200,
+		States:      b.store,
+		Rounds:      []ocom.Round{{Number: 1, StartFrame: 0, EndFrame: -1}},
+		BombEvents: []ocom.BombEvent{
+			bomb(10, ocom.BombPlantBegin, "BotA", false),
+			bomb(20, ocom.BombPlantAborted, "BotA", false),
+			bomb(30, ocom.BombPlantBegin, "BotA", false),
+			bomb(60, ocom.BombPlanted, "BotA", false),
+			// BotB fakes the defuse while BotC defuses with a kit
+			bomb(100, ocom.BombDefuseStart, "BotB", false),
+			bomb(110, ocom.BombDefuseStart, "BotC", true),
+			bomb(130, ocom.BombDefuseAborted, "BotB", false),
+			bomb(160, ocom.BombDefused, "BotC", false),
+		},
+	}
+
+	type progress struct {
+		player   string
+		progress float64
+	}
+	tests := []struct {
+		frame int
+		want  []progress
+	}{
+		{5, nil},
+		{15, []progress{{"BotA", 0.5 / 3}}},
+		{25, nil},
+		{45, []progress{{"BotA", 0.5}}},
+		{60, nil},
+		{105, []progress{{"BotB", 0.05}}},
+		{120, []progress{{"BotB", 0.2}, {"BotC", 0.2}}},
+		{140, []progress{{"BotC", 0.6}}},
+		{170, nil},
+	}
+	for _, test := range tests {
+		actions := m.BombActions(test.frame)
+		if len(actions) != len(test.want) {
+			t.Errorf("frame %d: got %d actions %+v, want %+v", test.frame, len(actions), actions, test.want)
+			continue
+		}
+		for i, want := range test.want {
+			if got := actions[i]; got.Start.PlayerName != want.player || math.Abs(got.Progress-want.progress) > 1e-9 {
+				t.Errorf("frame %d: got %v at %v, want %v at %v", test.frame, got.Start.PlayerName, got.Progress, want.player, want.progress)
+			}
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package match
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+)
+
+// CacheVersion is the version of the on-disk match cache. It has to be
+// increased whenever the layout of Match (or any type it contains) or the
+// parsing logic changes, so outdated cache files are parsed again.
+const CacheVersion = 19
+
+const demoinfocsModule = "github.com/markus-wa/demoinfocs-golang/v2"
+
+// errCacheMismatch is returned when a cache file belongs to another demo, was
+// written by another parser version or parsed with other options.
+var errCacheMismatch = errors.New("cache file does not match demo or parser version")
+
+// cacheHeader precedes the serialized Match in every cache file.
+type cacheHeader struct {
+	Version  int
+	Parser   string
+	DemoHash string
+	Options  cacheOptions
+}
+
+// cacheOptions are the options that change the parsed match. Matches parsed
+// with other options are cached in files of their own.
+type cacheOptions struct {
+	FallbackFrameRate float64
+	FallbackTickRate  float64
+	StatesPerSecond   float64
+}
+
+func newCacheOptions(opts Options) cacheOptions {
+	return cacheOptions{
+		FallbackFrameRate: opts.FallbackFrameRate,
+		FallbackTickRate:  opts.FallbackTickRate,
+		StatesPerSecond:   opts.StatesPerSecond,
+	}
+}
+
+// key returns a short hash of the options for cache file names.
+func (o cacheOptions) key() string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%g/%g/%g", o.FallbackFrameRate, o.FallbackTickRate, o.StatesPerSecond)))
+	return hex.EncodeToString(hash[:4])
+}
+
+// parseFileCached parses the demo at demoFileName unless a valid cache file
+// for its content exists in opts.CacheDir. Freshly parsed matches are written
+// to the cache.
+func parseFileCached(ctx context.Context, demoFileName string, opts Options) (*Match, error) {
+	demoHash, err := hashFile(demoFileName)
+	if err != nil {
+		return nil, err
+	}
+	options := newCacheOptions(opts)
+	cacheFileName := filepath.Join(opts.CacheDir, fmt.Sprintf("%s-%s.cache", demoHash, options.key()))
+
+	match, err := readCacheFile(cacheFileName, demoHash, options)
+	if err == nil {
+		return match, nil
+	}
+	if !os.IsNotExist(err) {
+		log.Println("ignoring match cache:", err)
+	}
+
+	match, err = parseFile(ctx, demoFileName, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeCacheFile(cacheFileName, demoHash, options, match)
+	if err != nil {
+		log.Println("trying to write match cache:", err)
+	}
+	return match, nil
+}
+
+// parserVersion identifies the code that produced a cached match.
+func parserVersion() string {
+	version := "unknown"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == demoinfocsModule {
+				version = dep.Version
+			}
+		}
+	}
+	return fmt.Sprintf("%d/%v", CacheVersion, version)
+}
+
+func hashFile(fileName string) (string, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// readCacheFile reads a match written by writeCacheFile. gob only encodes
+// exported fields, so the equipment of GrenadeEffects loses its unexported
+// unique ID and UniqueID returns 0 for matches read from the cache. It is
+// only used to link events while parsing.
+func readCacheFile(cacheFileName, demoHash string, options cacheOptions) (*Match, error) {
+	file, err := os.Open(cacheFileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	dec := gob.NewDecoder(zr)
+	var header cacheHeader
+	if err := dec.Decode(&header); err != nil {
+		return nil, err
+	}
+	if header.Version != CacheVersion || header.Parser != parserVersion() || header.DemoHash != demoHash || header.Options != options {
+		return nil, errCacheMismatch
+	}
+
+	match := new(Match)
+	if err := dec.Decode(match); err != nil {
+		return nil, err
+	}
+	match.buildIndexes()
+	return match, nil
+}
+
+// writeCacheFile writes the match to a temporary file first, so an
+// interrupted write never leaves a corrupt cache file behind.
+func writeCacheFile(cacheFileName, demoHash string, options cacheOptions, match *Match) error {
+	dir := filepath.Dir(cacheFileName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, "tmp-*.cache")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	zw, err := gzip.NewWriterLevel(tmp, gzip.BestSpeed)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	enc := gob.NewEncoder(zw)
+	header := cacheHeader{
+		Version:  CacheVersion,
+		Parser:   parserVersion(),
+		DemoHash: demoHash,
+		Options:  options,
+	}
+	err = enc.Encode(header)
+	if err == nil {
+		err = enc.Encode(match)
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), cacheFileName)
+}
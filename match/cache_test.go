@@ -0,0 +1,124 @@
+package match
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	ocom "github.com/lwayneh/dem-replay/common"
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	event "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+)
+
+// testMatch builds a small match with states, kills, rounds and grenade
+// effects, like parseDemo does.
+func testMatch() *Match {
+	b := newStateBuilder()
+	for _, values := range testFrames(b, 120) {
+		b.append(values)
+	}
+	m := &Match{
+		MapName:          "de_test",
+		FrameRate:        32,
+		TickRate:         128,
+		FrameRateRounded: 32,
+		States:           b.store,
+		HalfStarts:       []int{0},
+		RoundStarts:      []int{0, 60},
+		Rounds: []ocom.Round{
+			{Number: 1, StartFrame: 0, FreezeEndFrame: 10, PlantFrame: -1, EndFrame: 50, OfficialEndFrame: 55, Winner: common.TeamTerrorists, EndReason: ocom.RoundEndReasonElimination, ScoreT: 1},
+			{Number: 2, StartFrame: 60, FreezeEndFrame: 70, PlantFrame: 80, EndFrame: 110, OfficialEndFrame: -1, Winner: common.TeamCounterTerrorists, EndReason: ocom.RoundEndReasonBombDefused, ScoreCT: 1, ScoreT: 1},
+		},
+		Kills: []ocom.Kill{
+			{Frame: 20, Tick: 80, KillerName: "A", KillerTeam: common.TeamTerrorists, VictimName: "B", VictimTeam: common.TeamCounterTerrorists, Weapon: "AK-47", IsHeadshot: true},
+			{Frame: 90, Tick: 360, KillerName: "C", VictimName: "D", AssisterName: "A", Weapon: "AWP", PenetratedObjects: 1, NoScope: true},
+		},
+		Shots: []ocom.Shot{{Tick: 80, StartFrame: 20, EndFrame: 21}},
+		GrenadeEffects: []ocom.GrenadeEffect{{
+			GrenadeEvent: event.GrenadeEvent{GrenadeType: common.EqSmoke, Grenade: common.NewEquipment(common.EqSmoke), GrenadeEntityID: 7},
+			StartFrame:   30,
+			EndFrame:     90,
+		}},
+		Damage:     make([]ocom.Damage, 0),
+		BombEvents: make([]ocom.BombEvent, 0),
+		Grenades:   make([]ocom.Grenade, 0),
+	}
+	m.TotalFrames = m.States.Len()
+	m.buildIndexes()
+	return m
+}
+
+func TestCacheFileRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "match-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	want := testMatch()
+	options := cacheOptions{FallbackFrameRate: -1, FallbackTickRate: -1, StatesPerSecond: 16}
+	path := filepath.Join(dir, "demo.cache")
+	if err := writeCacheFile(path, "hash", options, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readCacheFile(path, "hash", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.MapName != want.MapName || got.TotalFrames != want.TotalFrames || got.FrameRate != want.FrameRate || got.TickRate != want.TickRate {
+		t.Errorf("got %v with %d frames at %v/%v, want %v with %d frames at %v/%v",
+			got.MapName, got.TotalFrames, got.FrameRate, got.TickRate,
+			want.MapName, want.TotalFrames, want.FrameRate, want.TickRate)
+	}
+	if !reflect.DeepEqual(got.Rounds, want.Rounds) {
+		t.Errorf("got rounds %+v, want %+v", got.Rounds, want.Rounds)
+	}
+	if !reflect.DeepEqual(got.Kills, want.Kills) {
+		t.Errorf("got kills %+v, want %+v", got.Kills, want.Kills)
+	}
+	if !reflect.DeepEqual(got.RoundStarts, want.RoundStarts) || !reflect.DeepEqual(got.HalfStarts, want.HalfStarts) {
+		t.Errorf("got round starts %v and half starts %v", got.RoundStarts, got.HalfStarts)
+	}
+	for frame := 0; frame < want.StateCount(); frame++ {
+		if g, w := comparable(got.States.State(frame)), comparable(want.States.State(frame)); !reflect.DeepEqual(g, w) {
+			t.Fatalf("frame %d:\ngot  %+v\nwant %+v", frame, g, w)
+		}
+	}
+
+	// the indexes are rebuilt after loading
+	if g, w := len(got.KillsAt(25)), len(want.KillsAt(25)); g != w || g == 0 {
+		t.Errorf("got %d kills on the killfeed, want %d", g, w)
+	}
+	effects := got.GrenadeEffectsAt(40)
+	if len(effects) != 1 || effects[0].GrenadeType != common.EqSmoke || effects[0].Grenade.Type != common.EqSmoke {
+		t.Fatalf("got effects %+v", effects)
+	}
+	// gob skips the unexported unique ID of the equipment
+	if id := effects[0].Grenade.UniqueID(); id != 0 {
+		t.Errorf("got unique ID %d after loading, want 0", id)
+	}
+}
+
+func TestCacheFileMismatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "match-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	options := cacheOptions{FallbackFrameRate: -1, FallbackTickRate: -1}
+	path := filepath.Join(dir, "demo.cache")
+	if err := writeCacheFile(path, "hash", options, testMatch()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readCacheFile(path, "other", options); err != errCacheMismatch {
+		t.Errorf("got %v reading the cache of another demo, want %v", err, errCacheMismatch)
+	}
+	options.StatesPerSecond = 8
+	if _, err := readCacheFile(path, "hash", options); err != errCacheMismatch {
+		t.Errorf("got %v reading a cache with other options, want %v", err, errCacheMismatch)
+	}
+}
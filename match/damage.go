@@ -0,0 +1,195 @@
+package match
+
+import (
+	"sort"
+
+	ocom "github.com/lwayneh/dem-replay/common"
+	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	event "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+)
+
+const maxHealth = 100
+
+// PlayerDamage sums up the damage one player dealt to another.
+type PlayerDamage struct {
+	AttackerName    string
+	AttackerTeam    common.Team
+	AttackerSteamID uint64
+	VictimName      string
+	VictimTeam      common.Team
+	VictimSteamID   uint64
+	HealthDamage    int
+	ArmorDamage     int
+	Hits            int
+}
+
+func registerDamageHandlers(parser dem.Parser, match *Match) {
+	// health of every player before the next hit by entity ID, used to cap
+	// the damage. Steam IDs don't work, all bots share the Steam ID 0.
+	health := make(map[int]int)
+
+	parser.RegisterEventHandler(func(event.RoundStart) {
+		health = make(map[int]int)
+	})
+	parser.RegisterEventHandler(func(e event.PlayerHurt) {
+		if e.Player == nil || parser.GameState().IsWarmupPeriod() {
+			return
+		}
+		healthBefore, ok := health[e.Player.EntityID]
+		if !ok {
+			healthBefore = maxHealth
+		}
+		health[e.Player.EntityID] = e.Health
+
+		damage := ocom.Damage{
+			Frame:             match.frame(),
+			Tick:              parser.GameState().IngameTick(),
+			AttackerName:      "World",
+			AttackerTeam:      common.TeamUnassigned,
+			VictimName:        e.Player.Name,
+			VictimTeam:        e.Player.Team,
+			VictimSteamID:     e.Player.SteamID64,
+			HitGroup:          e.HitGroup,
+			HealthDamage:      e.HealthDamage,
+			HealthDamageTaken: e.HealthDamage,
+			ArmorDamage:       e.ArmorDamage,
+		}
+		if damage.HealthDamageTaken > healthBefore {
+			damage.HealthDamageTaken = healthBefore
+		}
+		if e.Attacker != nil {
+			damage.AttackerName = e.Attacker.Name
+			damage.AttackerTeam = e.Attacker.Team
+			damage.AttackerSteamID = e.Attacker.SteamID64
+		}
+		if e.Weapon != nil {
+			damage.Weapon = e.Weapon.Type.String()
+		}
+		match.Damage = append(match.Damage, damage)
+		match.addGrenadeHit(damage)
+	})
+}
+
+// isEnemyDamage returns true for damage that counts towards the ADR.
+func isEnemyDamage(d ocom.Damage) bool {
+	return d.AttackerTeam != common.TeamUnassigned && d.AttackerTeam != d.VictimTeam
+}
+
+// isPlayedRound returns true for rounds that were won by a team, which
+// excludes restarts.
+func isPlayedRound(r ocom.Round) bool {
+	return r.EndFrame != -1 &&
+		(r.Winner == common.TeamTerrorists || r.Winner == common.TeamCounterTerrorists)
+}
+
+// roundEnd returns the last frame that belongs to the round at index i.
+func (m *Match) roundEnd(i int) int {
+	if i+1 < len(m.Rounds) {
+		return m.Rounds[i+1].StartFrame - 1
+	}
+	return m.TotalFrames
+}
+
+// DamageBetween returns the damage players dealt to each other between the
+// frames from and to (both inclusive), ordered by the damage dealt.
+func (m *Match) DamageBetween(from, to int) []PlayerDamage {
+	type pair struct{ attacker, victim string }
+	sums := make(map[pair]*PlayerDamage)
+	for _, d := range m.Damage {
+		if d.Frame < from || d.Frame > to {
+			continue
+		}
+		key := pair{d.AttackerName, d.VictimName}
+		sum, ok := sums[key]
+		if !ok {
+			sum = &PlayerDamage{
+				AttackerName:    d.AttackerName,
+				AttackerTeam:    d.AttackerTeam,
+				AttackerSteamID: d.AttackerSteamID,
+				VictimName:      d.VictimName,
+				VictimTeam:      d.VictimTeam,
+				VictimSteamID:   d.VictimSteamID,
+			}
+			sums[key] = sum
+		}
+		sum.HealthDamage += d.HealthDamageTaken
+		sum.ArmorDamage += d.ArmorDamage
+		sum.Hits++
+	}
+
+	damage := make([]PlayerDamage, 0, len(sums))
+	for _, sum := range sums {
+		damage = append(damage, *sum)
+	}
+	sort.Slice(damage, func(i, j int) bool {
+		if damage[i].HealthDamage != damage[j].HealthDamage {
+			return damage[i].HealthDamage > damage[j].HealthDamage
+		}
+		return damage[i].AttackerName+damage[i].VictimName < damage[j].AttackerName+damage[j].VictimName
+	})
+	return damage
+}
+
+// RoundDamage returns the damage players dealt to each other in the round at
+// index i of Rounds.
+func (m *Match) RoundDamage(i int) []PlayerDamage {
+	if i < 0 || i >= len(m.Rounds) {
+		return nil
+	}
+	return m.DamageBetween(m.Rounds[i].StartFrame, m.roundEnd(i))
+}
+
+// roundTotal sums up the played rounds up to and including a round.
+type roundTotal struct {
+	played int
+	// health damage dealt to enemies by attacker
+	damage map[playerKey]int
+}
+
+// buildRoundTotals sums up the damage dealt to enemies after every round, so
+// ADR does not have to go through all damage.
+func (m *Match) buildRoundTotals() {
+	roundDamage := make([]map[playerKey]int, len(m.Rounds))
+	for _, d := range m.Damage {
+		i := m.RoundIndexAt(d.Frame)
+		if i == -1 || !isPlayedRound(m.Rounds[i]) || !isEnemyDamage(d) {
+			continue
+		}
+		if roundDamage[i] == nil {
+			roundDamage[i] = make(map[playerKey]int)
+		}
+		roundDamage[i][newPlayerKey(d.AttackerSteamID, d.AttackerName)] += d.HealthDamageTaken
+	}
+
+	m.roundTotals = make([]roundTotal, len(m.Rounds))
+	total := roundTotal{damage: make(map[playerKey]int)}
+	for i, round := range m.Rounds {
+		if isPlayedRound(round) {
+			damage := make(map[playerKey]int, len(total.damage))
+			for key, sum := range total.damage {
+				damage[key] = sum
+			}
+			for key, sum := range roundDamage[i] {
+				damage[key] += sum
+			}
+			total = roundTotal{played: total.played + 1, damage: damage}
+		}
+		m.roundTotals[i] = total
+	}
+}
+
+// ADR returns the average damage per round the player dealt to enemies in all
+// rounds that ended before or at the specified frame. Pass TotalFrames to get
+// the ADR of the whole match.
+func (m *Match) ADR(steamID uint64, name string, frame int) float64 {
+	i := m.RoundIndexAt(frame)
+	if i != -1 && (m.Rounds[i].EndFrame == -1 || m.Rounds[i].EndFrame > frame) {
+		i--
+	}
+	if i < 0 || i >= len(m.roundTotals) || m.roundTotals[i].played == 0 {
+		return 0
+	}
+	total := m.roundTotals[i]
+	return float64(total.damage[newPlayerKey(steamID, name)]) / float64(total.played)
+}
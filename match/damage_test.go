@@ -0,0 +1,61 @@
+package match
+
+import (
+	"testing"
+
+	ocom "github.com/lwayneh/dem-replay/common"
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+func hit(frame int, attacker string, steamID uint64, team common.Team, victimTeam common.Team, damage int) ocom.Damage {
+	return ocom.Damage{
+		Frame:             frame,
+		AttackerName:      attacker,
+		AttackerSteamID:   steamID,
+		AttackerTeam:      team,
+		VictimName:        "Victim",
+		VictimTeam:        victimTeam,
+		HealthDamage:      damage,
+		HealthDamageTaken: damage,
+	}
+}
+
+// TestADRBots checks that bots only get the damage they dealt themselves.
+func TestADRBots(t *testing.T) {
+	const ct, tt = common.TeamCounterTerrorists, common.TeamTerrorists
+	m := &Match{
+		TotalFrames: 100,
+		Rounds: []ocom.Round{
+			{Number: 1, StartFrame: 0, EndFrame: 40, Winner: ct},
+			{Number: 2, StartFrame: 50, EndFrame: 90, Winner: tt},
+		},
+		Damage: []ocom.Damage{
+			hit(10, "BotA", 0, ct, tt, 100),
+			hit(20, "BotB", 0, ct, tt, 40),
+			hit(60, "BotA", 0, ct, tt, 60),
+			// damage to teammates doesn't count
+			hit(70, "BotB", 0, ct, ct, 30),
+			hit(70, "Human", 1, tt, ct, 80),
+		},
+	}
+	m.buildIndexes()
+
+	tests := []struct {
+		name    string
+		steamID uint64
+		frame   int
+		want    float64
+	}{
+		{"BotA", 0, 100, 80},
+		{"BotB", 0, 100, 20},
+		{"Human", 1, 100, 40},
+		{"BotC", 0, 100, 0},
+		// only the first round ended
+		{"BotA", 0, 45, 100},
+	}
+	for _, test := range tests {
+		if got := m.ADR(test.steamID, test.name, test.frame); got != test.want {
+			t.Errorf("ADR(%v, %d) = %v, want %v", test.name, test.frame, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package match
+
+import (
+	"math"
+	"time"
+
+	ocom "github.com/lwayneh/dem-replay/common"
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+// KillfeedDuration is how long a kill stays on the killfeed.
+const KillfeedDuration = 10 * time.Second
+
+// buildIndexes indexes the visible frames of all kills, shots, grenade
+// effects, grenades in flight and blinding flashbangs, and sums up the
+// damage and flash statistics. The indexes are not stored with the match and
+// have to be rebuilt whenever a match was parsed or loaded.
+func (m *Match) buildIndexes() {
+	kills := make([]interval, len(m.Kills))
+	for i, kill := range m.Kills {
+		kills[i] = interval{start: kill.Frame, end: m.killfeedEnd(kill), id: i}
+	}
+	m.killIndex = newIntervalTree(kills)
+
+	shots := make([]interval, len(m.Shots))
+	for i, shot := range m.Shots {
+		shots[i] = interval{start: shot.StartFrame, end: shot.EndFrame, id: i}
+	}
+	m.shotIndex = newIntervalTree(shots)
+
+	effects := make([]interval, len(m.GrenadeEffects))
+	for i, effect := range m.GrenadeEffects {
+		effects[i] = interval{start: effect.StartFrame, end: effect.EndFrame, id: i}
+	}
+	m.effectIndex = newIntervalTree(effects)
+
+	flights := make([]interval, len(m.Grenades))
+	flashes := make([]interval, 0)
+	for i, grenade := range m.Grenades {
+		end := grenade.DetonateFrame
+		if end == -1 {
+			end = math.MaxInt32
+		}
+		flights[i] = interval{start: grenade.ThrowFrame, end: end, id: i}
+		if grenade.Type != common.EqFlash || grenade.DetonateFrame == -1 {
+			continue
+		}
+		blindEnd := grenade.DetonateFrame
+		for _, p := range grenade.Flashed {
+			if end := grenade.DetonateFrame + m.durationToFrames(p.Duration); end > blindEnd {
+				blindEnd = end
+			}
+		}
+		if blindEnd > grenade.DetonateFrame {
+			flashes = append(flashes, interval{start: grenade.DetonateFrame, end: blindEnd, id: i})
+		}
+	}
+	m.flightIndex = newIntervalTree(flights)
+	m.flashIndex = newIntervalTree(flashes)
+
+	m.buildRoundTotals()
+	m.buildFlashTotals()
+}
+
+// playerKey identifies a player in maps the way ocom.SamePlayer compares
+// players.
+type playerKey struct {
+	steamID uint64
+	name    string
+}
+
+func newPlayerKey(steamID uint64, name string) playerKey {
+	if steamID != 0 {
+		return playerKey{steamID: steamID}
+	}
+	return playerKey{name: name}
+}
+
+// killfeedEnd returns the first frame the kill is no longer on the killfeed.
+func (m *Match) killfeedEnd(kill ocom.Kill) int {
+	end := m.Timeline().Seek(kill.Frame, KillfeedDuration)
+	if end <= kill.Frame {
+		end = kill.Frame + 1
+	}
+	return end
+}
+
+// KillsAt returns all kills that are on the killfeed at the specified frame,
+// ordered by the frame of the kill.
+func (m *Match) KillsAt(frame int) []ocom.Kill {
+	return m.KillsBetween(frame, frame)
+}
+
+// KillsBetween returns all kills that are on the killfeed at any frame from
+// up to to (both inclusive), ordered by the frame of the kill.
+func (m *Match) KillsBetween(from, to int) []ocom.Kill {
+	ids := m.killIndex.query(from, to)
+	kills := make([]ocom.Kill, len(ids))
+	for i, id := range ids {
+		kills[i] = m.Kills[id]
+	}
+	return kills
+}
+
+// ShotsAt returns all shots that are visible at the specified frame.
+func (m *Match) ShotsAt(frame int) []ocom.Shot {
+	return m.ShotsBetween(frame, frame)
+}
+
+// ShotsBetween returns all shots that are visible at any frame from up to to
+// (both inclusive), ordered by the frame of the shot.
+func (m *Match) ShotsBetween(from, to int) []ocom.Shot {
+	ids := m.shotIndex.query(from, to)
+	shots := make([]ocom.Shot, len(ids))
+	for i, id := range ids {
+		shots[i] = m.Shots[id]
+	}
+	return shots
+}
+
+// GrenadeEffectsAt returns all grenade effects that are visible at the
+// specified frame.
+func (m *Match) GrenadeEffectsAt(frame int) []ocom.GrenadeEffect {
+	return m.GrenadeEffectsBetween(frame, frame)
+}
+
+// GrenadeEffectsBetween returns all grenade effects that are visible at any
+// frame from up to to (both inclusive), ordered by their start.
+func (m *Match) GrenadeEffectsBetween(from, to int) []ocom.GrenadeEffect {
+	ids := m.effectIndex.query(from, to)
+	effects := make([]ocom.GrenadeEffect, len(ids))
+	for i, id := range ids {
+		effects[i] = m.GrenadeEffects[id]
+	}
+	return effects
+}
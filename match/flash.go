@@ -0,0 +1,147 @@
+package match
+
+import (
+	"sort"
+	"time"
+
+	ocom "github.com/lwayneh/dem-replay/common"
+	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	event "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+)
+
+// FlashStats sums up how effective the flashbangs of a player were.
+// Self flashes count neither as enemies nor as teammates flashed.
+type FlashStats struct {
+	PlayerName       string
+	PlayerTeam       common.Team
+	PlayerSteamID    uint64
+	Thrown           int
+	EnemiesFlashed   int
+	TeammatesFlashed int
+	SelfFlashed      int
+	EnemyBlindTime   time.Duration
+	TeamBlindTime    time.Duration
+}
+
+// registerFlashHandlers adds every blinded player to the flashbang that
+// blinded them.
+func registerFlashHandlers(parser dem.Parser, match *Match) {
+	parser.RegisterEventHandler(func(e event.PlayerFlashed) {
+		if e.Player == nil || e.Projectile == nil || parser.GameState().IsWarmupPeriod() {
+			return
+		}
+		i := match.lastGrenade(e.Projectile.UniqueID())
+		if i == -1 {
+			return
+		}
+		duration := e.FlashDuration()
+		if duration <= 0 {
+			return
+		}
+		grenade := &match.Grenades[i]
+		grenade.Flashed = append(grenade.Flashed, ocom.FlashedPlayer{
+			PlayerName:    e.Player.Name,
+			PlayerTeam:    e.Player.Team,
+			PlayerSteamID: e.Player.SteamID64,
+			Duration:      duration,
+		})
+	})
+}
+
+// ActiveFlashes returns the flashbangs that detonated before or at the
+// specified frame and still blind at least one player.
+func (m *Match) ActiveFlashes(frame int) []*ocom.Grenade {
+	ids := m.flashIndex.query(frame, frame)
+	flashes := make([]*ocom.Grenade, len(ids))
+	for i, id := range ids {
+		flashes[i] = &m.Grenades[id]
+	}
+	return flashes
+}
+
+// flashTotal is the flash statistics of a player after one of their
+// flashbangs detonated.
+type flashTotal struct {
+	frame int
+	stats FlashStats
+}
+
+// buildFlashTotals sums up the flash statistics of every player after each of
+// their flashbangs, in the order the flashbangs detonated.
+func (m *Match) buildFlashTotals() {
+	flashes := make([]*ocom.Grenade, 0)
+	for i := range m.Grenades {
+		if m.Grenades[i].Type == common.EqFlash && m.Grenades[i].DetonateFrame != -1 {
+			flashes = append(flashes, &m.Grenades[i])
+		}
+	}
+	sort.SliceStable(flashes, func(i, j int) bool { return flashes[i].DetonateFrame < flashes[j].DetonateFrame })
+
+	m.flashTotals = make(map[playerKey][]flashTotal)
+	for _, grenade := range flashes {
+		key := newPlayerKey(grenade.ThrowerSteamID, grenade.ThrowerName)
+		totals := m.flashTotals[key]
+		sum := FlashStats{
+			PlayerName:    grenade.ThrowerName,
+			PlayerTeam:    grenade.ThrowerTeam,
+			PlayerSteamID: grenade.ThrowerSteamID,
+		}
+		if len(totals) > 0 {
+			sum = totals[len(totals)-1].stats
+		}
+		sum.Thrown++
+		for _, p := range grenade.Flashed {
+			switch {
+			case grenade.IsSelfFlash(p):
+				sum.SelfFlashed++
+			case grenade.IsTeamFlash(p):
+				sum.TeammatesFlashed++
+				sum.TeamBlindTime += p.Duration
+			default:
+				sum.EnemiesFlashed++
+				sum.EnemyBlindTime += p.Duration
+			}
+		}
+		m.flashTotals[key] = append(totals, flashTotal{frame: grenade.DetonateFrame, stats: sum})
+	}
+}
+
+// flashTotalAt returns the last of the totals that were reached before or at
+// the specified frame.
+func flashTotalAt(totals []flashTotal, frame int) (FlashStats, bool) {
+	i := sort.Search(len(totals), func(i int) bool { return totals[i].frame > frame })
+	if i == 0 {
+		return FlashStats{}, false
+	}
+	return totals[i-1].stats, true
+}
+
+// FlashStats returns the flash statistics of all players that threw a
+// flashbang which detonated before or at the specified frame, ordered by the
+// number of enemies flashed. Pass TotalFrames to get the stats of the whole
+// match.
+func (m *Match) FlashStats(frame int) []FlashStats {
+	stats := make([]FlashStats, 0, len(m.flashTotals))
+	for _, totals := range m.flashTotals {
+		if sum, ok := flashTotalAt(totals, frame); ok {
+			stats = append(stats, sum)
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].EnemiesFlashed != stats[j].EnemiesFlashed {
+			return stats[i].EnemiesFlashed > stats[j].EnemiesFlashed
+		}
+		return stats[i].PlayerName < stats[j].PlayerName
+	})
+	return stats
+}
+
+// FlashStatsOf returns the flash statistics of the player up to the specified
+// frame.
+func (m *Match) FlashStatsOf(steamID uint64, name string, frame int) FlashStats {
+	if sum, ok := flashTotalAt(m.flashTotals[newPlayerKey(steamID, name)], frame); ok {
+		return sum
+	}
+	return FlashStats{PlayerName: name, PlayerSteamID: steamID}
+}
@@ -0,0 +1,56 @@
+package match
+
+import (
+	"testing"
+	"time"
+
+	ocom "github.com/lwayneh/dem-replay/common"
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+func flashbang(thrower string, steamID uint64, team common.Team, flashed ...ocom.FlashedPlayer) ocom.Grenade {
+	return ocom.Grenade{
+		Type:           common.EqFlash,
+		ThrowerName:    thrower,
+		ThrowerTeam:    team,
+		ThrowerSteamID: steamID,
+		DetonateFrame:  1,
+		ExpireFrame:    -1,
+		Flashed:        flashed,
+	}
+}
+
+func blinded(name string, steamID uint64, team common.Team) ocom.FlashedPlayer {
+	return ocom.FlashedPlayer{PlayerName: name, PlayerSteamID: steamID, PlayerTeam: team, Duration: time.Second}
+}
+
+// TestFlashStatsBots checks that the flashbangs of bots are counted for the
+// bot that threw them.
+func TestFlashStatsBots(t *testing.T) {
+	const ct, tt = common.TeamCounterTerrorists, common.TeamTerrorists
+	m := &Match{Grenades: []ocom.Grenade{
+		flashbang("BotA", 0, ct, blinded("BotB", 0, ct), blinded("BotC", 0, tt)),
+		flashbang("BotB", 0, ct, blinded("BotB", 0, ct)),
+		flashbang("Human", 1, tt, blinded("Human", 1, tt), blinded("BotA", 0, ct)),
+	}}
+	m.buildIndexes()
+
+	tests := []struct {
+		name    string
+		steamID uint64
+		want    FlashStats
+	}{
+		{"BotA", 0, FlashStats{PlayerName: "BotA", PlayerTeam: ct, Thrown: 1, EnemiesFlashed: 1, TeammatesFlashed: 1, EnemyBlindTime: time.Second, TeamBlindTime: time.Second}},
+		{"BotB", 0, FlashStats{PlayerName: "BotB", PlayerTeam: ct, Thrown: 1, SelfFlashed: 1}},
+		{"Human", 1, FlashStats{PlayerName: "Human", PlayerTeam: tt, PlayerSteamID: 1, Thrown: 1, EnemiesFlashed: 1, SelfFlashed: 1, EnemyBlindTime: time.Second}},
+		{"BotC", 0, FlashStats{PlayerName: "BotC"}},
+	}
+	for _, test := range tests {
+		if got := m.FlashStatsOf(test.steamID, test.name, 1); got != test.want {
+			t.Errorf("FlashStatsOf(%v) = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+	if got := len(m.FlashStats(1)); got != 3 {
+		t.Errorf("got stats of %d throwers, want 3", got)
+	}
+}
@@ -0,0 +1,190 @@
+package match
+
+import (
+	"sort"
+
+	ocom "github.com/lwayneh/dem-replay/common"
+	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	event "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+)
+
+// registerGrenadeHandlers records the lifecycle of every thrown grenade.
+// Grenade events are linked to the throw by the entity id of the projectile,
+// which is only reused after the projectile was destroyed.
+func registerGrenadeHandlers(parser dem.Parser, match *Match) {
+	match.activeGrenades = make(map[int]int)
+
+	parser.RegisterEventHandler(func(e event.GrenadeProjectileThrow) {
+		projectile := e.Projectile
+		grenade := ocom.Grenade{
+			UniqueID:      projectile.UniqueID(),
+			EntityID:      projectile.Entity.ID(),
+			ThrowFrame:    match.frame(),
+			ThrowTick:     parser.GameState().IngameTick(),
+			ThrowPosition: projectile.Position(),
+			DetonateFrame: -1,
+			DetonateTick:  -1,
+			ExpireFrame:   -1,
+		}
+		if projectile.WeaponInstance != nil {
+			grenade.Type = projectile.WeaponInstance.Type
+		}
+		if thrower := projectile.Thrower; thrower != nil {
+			grenade.ThrowerName = thrower.Name
+			grenade.ThrowerTeam = thrower.Team
+			grenade.ThrowerSteamID = thrower.SteamID64
+			grenade.ThrowPosition = thrower.LastAlivePosition
+			grenade.ThrowViewDirectionX = thrower.ViewDirectionX()
+			grenade.ThrowViewDirectionY = thrower.ViewDirectionY()
+		}
+		grenade.Trajectory = []ocom.TrajectoryPoint{{
+			Frame:    grenade.ThrowFrame,
+			Position: projectile.Position(),
+		}}
+		match.Grenades = append(match.Grenades, grenade)
+		match.activeGrenades[grenade.EntityID] = len(match.Grenades) - 1
+	})
+
+	detonate := func(e event.GrenadeEvent) {
+		if grenade := match.activeGrenade(e.GrenadeEntityID); grenade != nil && grenade.DetonateFrame == -1 {
+			grenade.DetonateFrame = match.frame()
+			grenade.DetonateTick = parser.GameState().IngameTick()
+			grenade.DetonatePosition = e.Position
+		}
+	}
+	parser.RegisterEventHandler(func(e event.HeExplode) {
+		detonate(e.GrenadeEvent)
+	})
+	parser.RegisterEventHandler(func(e event.FlashExplode) {
+		detonate(e.GrenadeEvent)
+	})
+	parser.RegisterEventHandler(func(e event.SmokeStart) {
+		detonate(e.GrenadeEvent)
+	})
+	parser.RegisterEventHandler(func(e event.DecoyStart) {
+		detonate(e.GrenadeEvent)
+	})
+
+	// molotovs and incendiaries detonate when the projectile is destroyed
+	parser.RegisterEventHandler(func(e event.GrenadeProjectileDestroy) {
+		id := e.Projectile.Entity.ID()
+		grenade := match.activeGrenade(id)
+		if grenade == nil {
+			return
+		}
+		frame := match.frame()
+		if grenade.DetonateFrame == -1 {
+			grenade.DetonateFrame = frame
+			grenade.DetonateTick = parser.GameState().IngameTick()
+			grenade.DetonatePosition = e.Projectile.Position()
+		}
+		// smokes, decoys and infernos expire with their effect
+		if grenade.ExpireFrame == -1 {
+			grenade.ExpireFrame = frame
+		}
+		delete(match.activeGrenades, id)
+	})
+}
+
+// activeGrenade returns the grenade of the projectile with the specified
+// entity id, or nil if there is no such projectile.
+func (m *Match) activeGrenade(entityID int) *ocom.Grenade {
+	i, ok := m.activeGrenades[entityID]
+	if !ok {
+		return nil
+	}
+	return &m.Grenades[i]
+}
+
+// recordTrajectories adds the current position of all grenade projectiles to
+// the trajectories of their grenades.
+func (m *Match) recordTrajectories(frame int, projectiles map[int]*common.GrenadeProjectile) {
+	for id, projectile := range projectiles {
+		grenade := m.activeGrenade(id)
+		if grenade == nil {
+			continue
+		}
+		pos := projectile.Position()
+		if last := grenade.Trajectory[len(grenade.Trajectory)-1]; last.Position == pos {
+			continue
+		}
+		grenade.Trajectory = append(grenade.Trajectory, ocom.TrajectoryPoint{
+			Frame:    frame,
+			Position: pos,
+		})
+	}
+}
+
+// addGrenadeHit adds the damage to the latest detonated grenade of the
+// attacker that matches the weapon, if the damage was dealt by a grenade.
+func (m *Match) addGrenadeHit(d ocom.Damage) {
+	var types []common.EquipmentType
+	switch d.Weapon {
+	case common.EqHE.String():
+		types = []common.EquipmentType{common.EqHE}
+	case common.EqMolotov.String(), common.EqIncendiary.String():
+		types = []common.EquipmentType{common.EqMolotov, common.EqIncendiary}
+	default:
+		return
+	}
+
+	for i := len(m.Grenades) - 1; i >= 0; i-- {
+		grenade := &m.Grenades[i]
+		if !ocom.SamePlayer(grenade.ThrowerSteamID, grenade.ThrowerName, d.AttackerSteamID, d.AttackerName) || grenade.DetonateFrame == -1 ||
+			grenade.DetonateFrame > d.Frame || !isGrenadeType(grenade.Type, types) {
+			continue
+		}
+		for j := range grenade.Hits {
+			hit := grenade.Hits[j]
+			if ocom.SamePlayer(hit.PlayerSteamID, hit.PlayerName, d.VictimSteamID, d.VictimName) {
+				grenade.Hits[j].HealthDamage += d.HealthDamageTaken
+				return
+			}
+		}
+		grenade.Hits = append(grenade.Hits, ocom.GrenadeHit{
+			PlayerName:    d.VictimName,
+			PlayerTeam:    d.VictimTeam,
+			PlayerSteamID: d.VictimSteamID,
+			HealthDamage:  d.HealthDamageTaken,
+		})
+		return
+	}
+}
+
+func isGrenadeType(t common.EquipmentType, types []common.EquipmentType) bool {
+	for _, other := range types {
+		if t == other {
+			return true
+		}
+	}
+	return false
+}
+
+// GrenadesInFlight returns the grenades that were thrown but did not detonate
+// yet at the specified frame.
+func (m *Match) GrenadesInFlight(frame int) []*ocom.Grenade {
+	ids := m.flightIndex.query(frame, frame)
+	grenades := make([]*ocom.Grenade, len(ids))
+	for i, id := range ids {
+		grenades[i] = &m.Grenades[id]
+	}
+	return grenades
+}
+
+// RoundGrenades returns the grenades that were thrown in the current round
+// up to the specified frame.
+func (m *Match) RoundGrenades(frame int) []*ocom.Grenade {
+	roundStart := 0
+	if round := m.RoundAt(frame); round != nil {
+		roundStart = round.StartFrame
+	}
+	// Grenades are ordered by the frame they were thrown in
+	first := sort.Search(len(m.Grenades), func(i int) bool { return m.Grenades[i].ThrowFrame >= roundStart })
+	last := sort.Search(len(m.Grenades), func(i int) bool { return m.Grenades[i].ThrowFrame > frame })
+	grenades := make([]*ocom.Grenade, 0, last-first)
+	for i := first; i < last; i++ {
+		grenades = append(grenades, &m.Grenades[i])
+	}
+	return grenades
+}
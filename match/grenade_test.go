@@ -0,0 +1,116 @@
+package match
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	ocom "github.com/lwayneh/dem-replay/common"
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+// TestGrenadeHitBots checks that the hits of grenades thrown by bots go to the
+// grenade of the bot that dealt the damage.
+func TestGrenadeHitBots(t *testing.T) {
+	const ct, tt = common.TeamCounterTerrorists, common.TeamTerrorists
+	m := &Match{Grenades: []ocom.Grenade{
+		{Type: common.EqHE, ThrowerName: "BotA", ThrowerTeam: ct, DetonateFrame: 10, ExpireFrame: -1},
+		{Type: common.EqHE, ThrowerName: "BotB", ThrowerTeam: ct, DetonateFrame: 10, ExpireFrame: -1},
+	}}
+	he := func(attacker, victim string, damage int) ocom.Damage {
+		return ocom.Damage{
+			Frame:             10,
+			AttackerName:      attacker,
+			AttackerTeam:      ct,
+			VictimName:        victim,
+			VictimTeam:        tt,
+			Weapon:            common.EqHE.String(),
+			HealthDamageTaken: damage,
+		}
+	}
+	m.addGrenadeHit(he("BotA", "BotC", 20))
+	m.addGrenadeHit(he("BotA", "BotD", 30))
+	m.addGrenadeHit(he("BotA", "BotC", 5))
+	// BotB threw the latest grenade, but didn't deal this damage
+	m.addGrenadeHit(he("BotB", "BotD", 40))
+
+	want := [][]ocom.GrenadeHit{
+		{
+			{PlayerName: "BotC", PlayerTeam: tt, HealthDamage: 25},
+			{PlayerName: "BotD", PlayerTeam: tt, HealthDamage: 30},
+		},
+		{
+			{PlayerName: "BotD", PlayerTeam: tt, HealthDamage: 40},
+		},
+	}
+	for i, grenade := range m.Grenades {
+		if !reflect.DeepEqual(grenade.Hits, want[i]) {
+			t.Errorf("grenade of %v: got hits %+v, want %+v", grenade.ThrowerName, grenade.Hits, want[i])
+		}
+	}
+}
+
+// TestGrenadeQueries compares the indexed grenade queries with scanning all
+// grenades.
+func TestGrenadeQueries(t *testing.T) {
+	flash := func(throw, detonate int, durations ...time.Duration) ocom.Grenade {
+		grenade := ocom.Grenade{Type: common.EqFlash, ThrowFrame: throw, DetonateFrame: detonate, ExpireFrame: -1}
+		for _, d := range durations {
+			grenade.Flashed = append(grenade.Flashed, ocom.FlashedPlayer{Duration: d})
+		}
+		return grenade
+	}
+	m := &Match{
+		FrameRate: 10,
+		Rounds:    []ocom.Round{{StartFrame: 0, EndFrame: 40}, {StartFrame: 50, EndFrame: -1}},
+		Grenades: []ocom.Grenade{
+			flash(5, 20, time.Second, 3*time.Second),
+			{Type: common.EqHE, ThrowFrame: 10, DetonateFrame: 25, ExpireFrame: -1},
+			// blinds nobody
+			flash(12, 18),
+			// detonates after flashbangs thrown later
+			{Type: common.EqSmoke, ThrowFrame: 30, DetonateFrame: 60, ExpireFrame: 100},
+			flash(52, 55, 2*time.Second),
+			// never detonates
+			{Type: common.EqDecoy, ThrowFrame: 70, DetonateFrame: -1, ExpireFrame: -1},
+		},
+	}
+	m.buildIndexes()
+
+	for frame := 0; frame < 120; frame++ {
+		var flashes, inFlight, round []*ocom.Grenade
+		for i := range m.Grenades {
+			grenade := &m.Grenades[i]
+			if grenade.InFlight(frame) {
+				inFlight = append(inFlight, grenade)
+			}
+			if grenade.ThrowFrame <= frame && grenade.ThrowFrame >= m.RoundAt(frame).StartFrame {
+				round = append(round, grenade)
+			}
+			for _, p := range grenade.Flashed {
+				if grenade.DetonateFrame <= frame && frame < grenade.DetonateFrame+m.durationToFrames(p.Duration) {
+					flashes = append(flashes, grenade)
+					break
+				}
+			}
+		}
+		for _, test := range []struct {
+			name      string
+			got, want []*ocom.Grenade
+		}{
+			{"ActiveFlashes", m.ActiveFlashes(frame), flashes},
+			{"GrenadesInFlight", m.GrenadesInFlight(frame), inFlight},
+			{"RoundGrenades", m.RoundGrenades(frame), round},
+		} {
+			if len(test.got) != len(test.want) {
+				t.Errorf("%v(%d): got %d grenades, want %d", test.name, frame, len(test.got), len(test.want))
+				continue
+			}
+			for i := range test.got {
+				if test.got[i] != test.want[i] {
+					t.Errorf("%v(%d): got grenade thrown at %d at %d, want %d", test.name, frame, test.got[i].ThrowFrame, i, test.want[i].ThrowFrame)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package match
+
+import (
+	"math"
+
+	"github.com/golang/geo/r3"
+	ocom "github.com/lwayneh/dem-replay/common"
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+// maxInterpolationDistance is the farthest a player or grenade may move
+// between two frames to still be interpolated. Anything farther was
+// teleported, e.g. to a spawn at the start of a round.
+const maxInterpolationDistance = 1000
+
+// InterpolatedState returns the state between the frame and the next one,
+// with fraction running from 0 at the frame to 1 at the next frame.
+// Positions, view directions and health of players and the positions of
+// grenade projectiles are interpolated, everything else is taken from the
+// frame.
+func (m *Match) InterpolatedState(frame int, fraction float64) ocom.OverviewState {
+	return m.States.Interpolated(frame, fraction)
+}
+
+// Interpolated returns the state between the frame and the next one, see
+// Match.InterpolatedState.
+func (s *StateStore) Interpolated(frame int, fraction float64) ocom.OverviewState {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	state := s.state(frame)
+	if fraction <= 0 || frame+1 >= s.Len() {
+		return state
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+
+	// the state is built for this call, Bomb.Carrier points into its players
+	// and moves with them
+	players := state.Players
+	next := append([]playerRow(nil), s.cachePlayer...)
+	for i := s.PlayerStarts[frame+1]; i < s.PlayerStarts[frame+2]; i++ {
+		row := s.playerRow(int(i))
+		for j := range next {
+			if next[j].roster == row.roster {
+				next[j] = row
+			}
+		}
+	}
+	for i := range players {
+		interpolatePlayer(&players[i], next[i], fraction)
+	}
+
+	grenades := make([]common.GrenadeProjectile, len(state.Grenades))
+	start := s.ProjectileStarts[frame]
+	for i, grenade := range state.Grenades {
+		grenades[i] = grenade
+		id := s.ProjectileIDs[int(start)+i]
+		for j := s.ProjectileStarts[frame+1]; j < s.ProjectileStarts[frame+2]; j++ {
+			if s.ProjectileIDs[j] != id {
+				continue
+			}
+			to := r3.Vector{X: float64(s.ProjectileX[j]), Y: float64(s.ProjectileY[j]), Z: float64(s.ProjectileZ[j])}
+			grenades[i].Trajectory = []r3.Vector{lerpPosition(grenade.Trajectory[0], to, fraction)}
+		}
+	}
+	state.Grenades = grenades
+
+	return state
+}
+
+// interpolatePlayer moves the player towards its row in the next frame. Dead
+// players stay where they died.
+func interpolatePlayer(player *ocom.Player, next playerRow, fraction float64) {
+	if player.Health <= 0 || next.health <= 0 {
+		return
+	}
+	to := r3.Vector{X: float64(next.x), Y: float64(next.y), Z: float64(next.z)}
+	player.LastAlivePosition = lerpPosition(player.LastAlivePosition, to, fraction)
+	player.ViewDirectionX = float32(lerpAngle(float64(player.ViewDirectionX), float64(next.viewX), fraction))
+	player.ViewDirectionY = float32(lerp(float64(player.ViewDirectionY), float64(next.viewY), fraction))
+	player.Health = int(math.Round(lerp(float64(player.Health), float64(next.health), fraction)))
+}
+
+// lerpPosition interpolates between two positions, unless they are too far
+// apart.
+func lerpPosition(from, to r3.Vector, fraction float64) r3.Vector {
+	if from.Distance(to) > maxInterpolationDistance {
+		return from
+	}
+	return from.Add(to.Sub(from).Mul(fraction))
+}
+
+// lerpAngle interpolates between two angles in degrees along the shorter
+// direction, so turning from 350° to 10° passes 0° instead of 180°. The result
+// is in [0, 360).
+func lerpAngle(from, to, fraction float64) float64 {
+	delta := math.Mod(to-from, 360)
+	if delta > 180 {
+		delta -= 360
+	}
+	if delta < -180 {
+		delta += 360
+	}
+	angle := math.Mod(from+delta*fraction, 360)
+	if angle < 0 {
+		angle += 360
+	}
+	return angle
+}
+
+func lerp(from, to, fraction float64) float64 {
+	return from + (to-from)*fraction
+}
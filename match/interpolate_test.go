@@ -0,0 +1,109 @@
+package match
+
+import (
+	"math"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+func TestLerpAngle(t *testing.T) {
+	tests := []struct {
+		from, to, fraction, want float64
+	}{
+		{0, 90, .5, 45},
+		{90, 0, .5, 45},
+		// across 0°/360°
+		{350, 10, .5, 0},
+		{350, 10, .25, 355},
+		{10, 350, .75, 355},
+		// across ±180°, as the view angles of older demos
+		{170, -170, .5, 180},
+		{-170, 170, .25, 185},
+		{-90, 0, .5, 315},
+		// more than one turn apart
+		{0, 720 + 90, .5, 45},
+		{45, 45, .5, 45},
+		{0, 90, 0, 0},
+		{0, 90, 1, 90},
+	}
+	for _, test := range tests {
+		got := lerpAngle(test.from, test.to, test.fraction)
+		if math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("lerpAngle(%v, %v, %v) = %v, want %v", test.from, test.to, test.fraction, got, test.want)
+		}
+		if got < 0 || got >= 360 {
+			t.Errorf("lerpAngle(%v, %v, %v) = %v, not in [0, 360)", test.from, test.to, test.fraction, got)
+		}
+	}
+}
+
+func TestLerpPosition(t *testing.T) {
+	from := r3.Vector{X: 100, Y: 200}
+	if got, want := lerpPosition(from, r3.Vector{X: 200, Y: 0, Z: 20}, .5), (r3.Vector{X: 150, Y: 100, Z: 10}); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// teleported
+	if got := lerpPosition(from, r3.Vector{X: 5000, Y: 200}, .5); got != from {
+		t.Errorf("got %v, want %v for a teleport", got, from)
+	}
+}
+
+// interpolationStore returns three frames of a player running along the x
+// axis and turning, who dies in the last frame, and a grenade in flight.
+func interpolationStore() *StateStore {
+	b := newStateBuilder()
+	roster := b.rosterIndex(RosterEntry{Name: "A", SteamID64: 1, UserID: 1})
+	loadout := b.loadoutIndex(nil, nil)
+	rows := []playerRow{
+		{roster: roster, loadout: loadout, team: common.TeamTerrorists, x: 0, viewX: 350, health: 100},
+		{roster: roster, loadout: loadout, team: common.TeamTerrorists, x: 100, viewX: 10, health: 50},
+		{roster: roster, loadout: loadout, team: common.TeamTerrorists, x: 200, viewX: 20, health: 0},
+	}
+	for f, row := range rows {
+		b.append(frameValues{
+			tick:        f * 4,
+			players:     []playerRow{row},
+			bombCarrier: -1,
+			projectiles: []projectileRow{{id: 1, grenadeType: common.EqFlash, x: float32(f * 40)}},
+		})
+	}
+	return b.store
+}
+
+func TestInterpolated(t *testing.T) {
+	s := interpolationStore()
+	tests := []struct {
+		frame    int
+		fraction float64
+		x, viewX float64
+		health   int
+		grenadeX float64
+	}{
+		{0, 0, 0, 350, 100, 0},
+		{0, .5, 50, 0, 75, 20},
+		{0, .25, 25, 355, 88, 10},
+		// fractions above 1 stop at the next frame
+		{0, 2, 100, 10, 50, 40},
+		// the player died in the next frame and stays
+		{1, .5, 100, 10, 50, 60},
+		// the last frame has no next frame
+		{2, .5, 200, 20, 0, 80},
+	}
+	for _, test := range tests {
+		state := s.Interpolated(test.frame, test.fraction)
+		if len(state.Players) != 1 || len(state.Grenades) != 1 {
+			t.Fatalf("frame %d: got %d players and %d grenades", test.frame, len(state.Players), len(state.Grenades))
+		}
+		p := state.Players[0]
+		got := []float64{p.LastAlivePosition.X, float64(p.ViewDirectionX), float64(p.Health), state.Grenades[0].Trajectory[0].X}
+		want := []float64{test.x, test.viewX, float64(test.health), test.grenadeX}
+		for i := range got {
+			if math.Abs(got[i]-want[i]) > 1e-4 {
+				t.Errorf("Interpolated(%d, %v): got x, view, health, grenade %v, want %v", test.frame, test.fraction, got, want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package match
+
+import "sort"
+
+// interval is the range of frames from start up to end (exclusive) an event
+// is visible in. id is the index of the event in its slice on Match.
+type interval struct {
+	start, end, id int
+}
+
+// intervalTree is a static, augmented interval tree. The intervals are sorted
+// by their start and form an implicit balanced binary search tree, where the
+// root of every range of intervals is its middle. maxEnd holds the largest
+// end of every subtree.
+type intervalTree struct {
+	intervals []interval
+	maxEnd    []int
+}
+
+func newIntervalTree(intervals []interval) *intervalTree {
+	sort.SliceStable(intervals, func(i, j int) bool { return intervals[i].start < intervals[j].start })
+	t := &intervalTree{
+		intervals: intervals,
+		maxEnd:    make([]int, len(intervals)),
+	}
+	t.build(0, len(intervals))
+	return t
+}
+
+// build sets maxEnd for the subtree of the intervals from lo up to hi and
+// returns it.
+func (t *intervalTree) build(lo, hi int) int {
+	if lo >= hi {
+		return -1
+	}
+	mid := (lo + hi) / 2
+	maxEnd := t.intervals[mid].end
+	if end := t.build(lo, mid); end > maxEnd {
+		maxEnd = end
+	}
+	if end := t.build(mid+1, hi); end > maxEnd {
+		maxEnd = end
+	}
+	t.maxEnd[mid] = maxEnd
+	return maxEnd
+}
+
+// query returns the ids of all intervals that overlap the frames from up to
+// to (both inclusive), ordered by their start.
+func (t *intervalTree) query(from, to int) []int {
+	ids := make([]int, 0)
+	if t == nil {
+		return ids
+	}
+	return t.collect(ids, 0, len(t.intervals), from, to)
+}
+
+func (t *intervalTree) collect(ids []int, lo, hi, from, to int) []int {
+	if lo >= hi {
+		return ids
+	}
+	mid := (lo + hi) / 2
+	// no interval in this subtree reaches the queried frames
+	if t.maxEnd[mid] <= from {
+		return ids
+	}
+	ids = t.collect(ids, lo, mid, from, to)
+	// all intervals right of mid start after the queried frames
+	if t.intervals[mid].start > to {
+		return ids
+	}
+	if t.intervals[mid].end > from {
+		ids = append(ids, t.intervals[mid].id)
+	}
+	return t.collect(ids, mid+1, hi, from, to)
+}
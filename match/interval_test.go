@@ -0,0 +1,86 @@
+package match
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// overlappingBrute returns the ids of the intervals overlapping the frames
+// from up to to, ordered like intervalTree.query.
+func overlappingBrute(intervals []interval, from, to int) []int {
+	sorted := append([]interval(nil), intervals...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].start < sorted[j].start })
+	ids := make([]int, 0)
+	for _, iv := range sorted {
+		if iv.start <= to && iv.end > from {
+			ids = append(ids, iv.id)
+		}
+	}
+	return ids
+}
+
+func TestIntervalTreeEmpty(t *testing.T) {
+	var nilTree *intervalTree
+	for _, tree := range []*intervalTree{nilTree, newIntervalTree(nil), newIntervalTree([]interval{})} {
+		if ids := tree.query(0, 100); len(ids) != 0 {
+			t.Errorf("got %v from an empty tree", ids)
+		}
+	}
+}
+
+// TestIntervalTreeTouching checks that an interval ends before its end frame,
+// so intervals that touch don't overlap at the shared frame.
+func TestIntervalTreeTouching(t *testing.T) {
+	tree := newIntervalTree([]interval{
+		{start: 0, end: 10, id: 0},
+		{start: 10, end: 20, id: 1},
+		{start: 20, end: 30, id: 2},
+		{start: 5, end: 5, id: 3},
+	})
+	tests := []struct {
+		from, to int
+		want     []int
+	}{
+		{9, 9, []int{0}},
+		{10, 10, []int{1}},
+		{19, 20, []int{1, 2}},
+		{30, 30, []int{}},
+		{-5, -1, []int{}},
+		{9, 10, []int{0, 1}},
+		{0, 100, []int{0, 3, 1, 2}},
+	}
+	for _, test := range tests {
+		if got := tree.query(test.from, test.to); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("query(%d, %d) = %v, want %v", test.from, test.to, got, test.want)
+		}
+	}
+}
+
+func TestIntervalTreeRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for round := 0; round < 200; round++ {
+		intervals := make([]interval, rng.Intn(50))
+		for i := range intervals {
+			start := rng.Intn(100)
+			intervals[i] = interval{start: start, end: start + rng.Intn(20), id: i}
+		}
+		tree := newIntervalTree(append([]interval(nil), intervals...))
+
+		for frame := -1; frame <= 121; frame++ {
+			want := overlappingBrute(intervals, frame, frame)
+			if got := tree.query(frame, frame); !reflect.DeepEqual(got, want) {
+				t.Fatalf("round %d: query(%d, %d) = %v, want %v", round, frame, frame, got, want)
+			}
+		}
+		for i := 0; i < 20; i++ {
+			from := rng.Intn(130) - 5
+			to := from + rng.Intn(30)
+			want := overlappingBrute(intervals, from, to)
+			if got := tree.query(from, to); !reflect.DeepEqual(got, want) {
+				t.Fatalf("round %d: query(%d, %d) = %v, want %v", round, from, to, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,971 @@
+package match
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/golang/geo/r2"
+	"github.com/golang/geo/r3"
+	ocom "github.com/lwayneh/dem-replay/common"
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	event "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+)
+
+// JSONVersion is the version of the schema written by WriteJSON. It is
+// increased whenever a field is removed or changes its meaning, so readers
+// can reject files they don't understand. Adding fields keeps the version.
+const JSONVersion = 2
+
+// ErrJSONVersion is returned by ReadJSON for files of another schema version.
+var ErrJSONVersion = errors.New("unsupported JSON schema version")
+
+// The JSON schema of a match. All names are camel case. Positions are in
+// world units, durations in milliseconds and frames are indices in samples.
+// Events that happened before the first sample have negative frames, the
+// frames of events that never happened are null.
+// Enumerations use the values of the Go constants they are converted from:
+// teams (2 terrorists, 3 counter-terrorists), equipment types, hit groups
+// and round end reasons of demoinfocs-golang, and timer phases and bomb
+// event types of the common package. Steam IDs and unique IDs are strings,
+// as they don't fit into JavaScript numbers.
+
+// JSONMatch is the document written by WriteJSON.
+type JSONMatch struct {
+	Version int    `json:"version"`
+	Map     string `json:"map"`
+	// TickRate is the number of ingame ticks per second.
+	TickRate float64 `json:"tickRate"`
+	// FrameRate is the number of samples per second.
+	FrameRate float64 `json:"frameRate"`
+	// DemoFrames is the number of frames in the header of the demo.
+	DemoFrames int      `json:"demoFrames"`
+	TeamOne    JSONClan `json:"teamOne"`
+	TeamTwo    JSONClan `json:"teamTwo"`
+	// HalfStarts and RoundStarts are the first frames of all halves and
+	// rounds.
+	HalfStarts     []int               `json:"halfStarts"`
+	RoundStarts    []int               `json:"roundStarts"`
+	Rounds         []JSONRound         `json:"rounds"`
+	Samples        []JSONSample        `json:"samples,omitempty"`
+	Kills          []JSONKill          `json:"kills"`
+	Shots          []JSONShot          `json:"shots"`
+	Damage         []JSONDamage        `json:"damage"`
+	Grenades       []JSONGrenade       `json:"grenades"`
+	GrenadeEffects []JSONGrenadeEffect `json:"grenadeEffects"`
+	BombEvents     []JSONBombEvent     `json:"bombEvents"`
+}
+
+// JSONClan is the name and tag of a team.
+type JSONClan struct {
+	Name string `json:"name"`
+	Tag  string `json:"tag"`
+}
+
+// JSONVector is a position in the world.
+type JSONVector struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+// JSONPoint is a position on the ground.
+type JSONPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// JSONFrame is the frame of an event that may never happen. It is written as
+// null if the event never happened.
+type JSONFrame int
+
+// JSONNever is the JSONFrame of events that never happened. It is distinct
+// from every frame, including the negative frames of events before the first
+// sample.
+const JSONNever JSONFrame = math.MinInt32
+
+// MarshalJSON implements json.Marshaler.
+func (f JSONFrame) MarshalJSON() ([]byte, error) {
+	if f == JSONNever {
+		return []byte("null"), nil
+	}
+	return json.Marshal(int(f))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (f *JSONFrame) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*f = JSONNever
+		return nil
+	}
+	var frame int
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return err
+	}
+	*f = JSONFrame(frame)
+	return nil
+}
+
+// JSONPlayerRef identifies the player taking part in an event.
+type JSONPlayerRef struct {
+	Name    string `json:"name"`
+	SteamID uint64 `json:"steamId,string"`
+	Team    int    `json:"team"`
+}
+
+// JSONRound is a round and its result.
+type JSONRound struct {
+	Number           int       `json:"number"`
+	StartFrame       int       `json:"startFrame"`
+	FreezeEndFrame   JSONFrame `json:"freezeEndFrame"`
+	PlantFrame       JSONFrame `json:"plantFrame"`
+	EndFrame         JSONFrame `json:"endFrame"`
+	OfficialEndFrame JSONFrame `json:"officialEndFrame"`
+	Winner           int       `json:"winner"`
+	EndReason        int       `json:"endReason"`
+	// ScoreCT and ScoreT are the scores after the round.
+	ScoreCT int `json:"scoreCT"`
+	ScoreT  int `json:"scoreT"`
+	// EquipmentValueCT and EquipmentValueT are the equipment values at the
+	// end of the freezetime.
+	EquipmentValueCT int `json:"equipmentValueCT"`
+	EquipmentValueT  int `json:"equipmentValueT"`
+}
+
+// JSONSample is the state of the game at a frame.
+type JSONSample struct {
+	Tick        int    `json:"tick"`
+	Phase       int    `json:"phase"`
+	RemainingMs int    `json:"remainingMs"`
+	ScoreCT     int    `json:"scoreCT"`
+	ScoreT      int    `json:"scoreT"`
+	ClanNameCT  string `json:"clanNameCT"`
+	ClanNameT   string `json:"clanNameT"`
+	// Bomb is the position of the bomb whenever nobody carries it.
+	Bomb     JSONVector       `json:"bomb"`
+	Players  []JSONPlayer     `json:"players"`
+	Grenades []JSONProjectile `json:"grenades"`
+	Infernos []JSONInferno    `json:"infernos"`
+}
+
+// JSONPlayer is the state of a player in a sample.
+type JSONPlayer struct {
+	Name         string  `json:"name"`
+	SteamID      uint64  `json:"steamId,string"`
+	UserID       int     `json:"userId"`
+	IsBot        bool    `json:"isBot,omitempty"`
+	Team         int     `json:"team"`
+	X            float32 `json:"x"`
+	Y            float32 `json:"y"`
+	Z            float32 `json:"z"`
+	ViewX        float32 `json:"viewX"`
+	ViewY        float32 `json:"viewY"`
+	Health       int     `json:"health"`
+	Armor        int     `json:"armor"`
+	Money        int     `json:"money"`
+	Kills        int     `json:"kills"`
+	Deaths       int     `json:"deaths"`
+	Assists      int     `json:"assists"`
+	Connected    bool    `json:"connected,omitempty"`
+	Helmet       bool    `json:"helmet,omitempty"`
+	Kit          bool    `json:"kit,omitempty"`
+	Defusing     bool    `json:"defusing,omitempty"`
+	Planting     bool    `json:"planting,omitempty"`
+	HasBomb      bool    `json:"hasBomb,omitempty"`
+	FlashMs      int     `json:"flashMs,omitempty"`
+	ActiveWeapon int     `json:"activeWeapon"`
+	Weapons      []int   `json:"weapons"`
+	// Grenades contains one entry per grenade.
+	Grenades []int `json:"grenades"`
+}
+
+// JSONProjectile is a grenade in flight.
+type JSONProjectile struct {
+	ID   int64   `json:"id,string"`
+	Type int     `json:"type"`
+	X    float32 `json:"x"`
+	Y    float32 `json:"y"`
+	Z    float32 `json:"z"`
+}
+
+// JSONInferno is the area covered by the fires of a molotov or incendiary
+// grenade.
+type JSONInferno struct {
+	ID   int64       `json:"id,string"`
+	Hull []JSONPoint `json:"hull"`
+}
+
+// JSONKill is a kill as shown on the killfeed.
+type JSONKill struct {
+	Frame             int           `json:"frame"`
+	Tick              int           `json:"tick"`
+	Killer            JSONPlayerRef `json:"killer"`
+	KillerPosition    JSONVector    `json:"killerPosition"`
+	Victim            JSONPlayerRef `json:"victim"`
+	VictimPosition    JSONVector    `json:"victimPosition"`
+	Assister          JSONPlayerRef `json:"assister"`
+	Weapon            string        `json:"weapon"`
+	Headshot          bool          `json:"headshot,omitempty"`
+	PenetratedObjects int           `json:"penetratedObjects,omitempty"`
+	FlashAssist       bool          `json:"flashAssist,omitempty"`
+	ThroughSmoke      bool          `json:"throughSmoke,omitempty"`
+	NoScope           bool          `json:"noScope,omitempty"`
+	AttackerBlind     bool          `json:"attackerBlind,omitempty"`
+}
+
+// JSONShot is a shot visible from StartFrame up to EndFrame (exclusive).
+type JSONShot struct {
+	Tick       int        `json:"tick"`
+	StartFrame int        `json:"startFrame"`
+	EndFrame   int        `json:"endFrame"`
+	Position   JSONVector `json:"position"`
+	ViewX      float32    `json:"viewX"`
+	Awp        bool       `json:"awp,omitempty"`
+}
+
+// JSONDamage is a single instance of damage a player took.
+type JSONDamage struct {
+	Frame       int           `json:"frame"`
+	Tick        int           `json:"tick"`
+	Attacker    JSONPlayerRef `json:"attacker"`
+	Victim      JSONPlayerRef `json:"victim"`
+	Weapon      string        `json:"weapon"`
+	HitGroup    int           `json:"hitGroup"`
+	Health      int           `json:"health"`
+	HealthTaken int           `json:"healthTaken"`
+	Armor       int           `json:"armor"`
+}
+
+// JSONGrenade is the lifecycle of a thrown grenade.
+type JSONGrenade struct {
+	ID         int64           `json:"id,string"`
+	EntityID   int             `json:"entityId"`
+	Type       int             `json:"type"`
+	Thrower    JSONPlayerRef   `json:"thrower"`
+	ThrowFrame int             `json:"throwFrame"`
+	ThrowTick  int             `json:"throwTick"`
+	Throw      JSONVector      `json:"throwPosition"`
+	ThrowViewX float32         `json:"throwViewX"`
+	ThrowViewY float32         `json:"throwViewY"`
+	Trajectory []JSONTrajPoint `json:"trajectory"`
+	// DetonateFrame and ExpireFrame are null and DetonateTick is -1 if the
+	// grenade never detonated or expired.
+	DetonateFrame JSONFrame           `json:"detonateFrame"`
+	DetonateTick  int                 `json:"detonateTick"`
+	Detonate      JSONVector          `json:"detonatePosition"`
+	ExpireFrame   JSONFrame           `json:"expireFrame"`
+	Hits          []JSONGrenadeHit    `json:"hits,omitempty"`
+	Flashed       []JSONFlashedPlayer `json:"flashed,omitempty"`
+	Extinguished  bool                `json:"extinguished,omitempty"`
+}
+
+// JSONTrajPoint is the position of a grenade at a frame.
+type JSONTrajPoint struct {
+	Frame    int        `json:"frame"`
+	Position JSONVector `json:"position"`
+}
+
+// JSONGrenadeHit is the damage a grenade dealt to a player.
+type JSONGrenadeHit struct {
+	Player JSONPlayerRef `json:"player"`
+	Health int           `json:"health"`
+}
+
+// JSONFlashedPlayer is a player blinded by a flashbang.
+type JSONFlashedPlayer struct {
+	Player     JSONPlayerRef `json:"player"`
+	DurationMs int           `json:"durationMs"`
+}
+
+// JSONGrenadeEffect is visible from StartFrame up to EndFrame (exclusive).
+type JSONGrenadeEffect struct {
+	Type       int           `json:"type"`
+	EntityID   int           `json:"entityId"`
+	Position   JSONVector    `json:"position"`
+	Thrower    JSONPlayerRef `json:"thrower"`
+	StartFrame int           `json:"startFrame"`
+	EndFrame   int           `json:"endFrame"`
+}
+
+// JSONBombEvent is a step in the lifecycle of the bomb.
+type JSONBombEvent struct {
+	Frame    int           `json:"frame"`
+	Tick     int           `json:"tick"`
+	Type     int           `json:"type"`
+	Player   JSONPlayerRef `json:"player"`
+	Position JSONVector    `json:"position"`
+	// Site is "A" or "B" for plants, defuses and explosions.
+	Site   string `json:"site,omitempty"`
+	HasKit bool   `json:"hasKit,omitempty"`
+}
+
+// WriteJSON writes the match as a JSON document of the version JSONVersion,
+// with one sample per frame. Matches parsed with Options.StatesPerSecond
+// contain fewer frames and result in a smaller document.
+func (m *Match) WriteJSON(w io.Writer) error {
+	return m.WriteJSONFrames(w, 0, m.StateCount())
+}
+
+// WriteJSONFrames writes the frames from start up to end (exclusive) like
+// WriteJSON. Only the events visible in these frames are written and all
+// frames are counted from start, so the document looks like a match of its
+// own. Frames of events that began before start are negative.
+func (m *Match) WriteJSONFrames(w io.Writer, start, end int) error {
+	start, end, err := m.jsonRange(start, end)
+	if err != nil {
+		return err
+	}
+	doc := m.jsonDocument(start, end, start)
+	doc.Samples = make([]JSONSample, end-start)
+	for i := range doc.Samples {
+		doc.Samples[i] = m.States.JSONSample(start + i)
+	}
+	return json.NewEncoder(w).Encode(doc)
+}
+
+// JSONEvents returns the document of the frames from start up to end
+// (exclusive) like WriteJSONFrames, but without samples and with frames
+// counted from the first frame of the match.
+func (m *Match) JSONEvents(start, end int) (*JSONMatch, error) {
+	start, end, err := m.jsonRange(start, end)
+	if err != nil {
+		return nil, err
+	}
+	return m.jsonDocument(start, end, 0), nil
+}
+
+// JSONSample returns the sample of the frame in the schema of WriteJSON.
+func (m *Match) JSONSample(frame int) JSONSample {
+	return m.States.JSONSample(frame)
+}
+
+// JSONKillfeed returns the kills shown on the killfeed at the frame in the
+// schema of WriteJSON.
+func (m *Match) JSONKillfeed(frame int) []JSONKill {
+	kills := m.KillsAt(frame)
+	feed := make([]JSONKill, len(kills))
+	for i, kill := range kills {
+		feed[i] = jsonKill(kill, kill.Frame)
+	}
+	return feed
+}
+
+// jsonRange limits the frames from start up to end to the frames of the
+// match.
+func (m *Match) jsonRange(start, end int) (int, int, error) {
+	if start < 0 {
+		start = 0
+	}
+	if end > m.StateCount() {
+		end = m.StateCount()
+	}
+	if end <= start {
+		return 0, 0, errors.New("no frames to write")
+	}
+	return start, end, nil
+}
+
+// jsonDocument returns the document of the frames from start up to end
+// without samples. Frames are counted from base.
+func (m *Match) jsonDocument(start, end, base int) *JSONMatch {
+	inRange := func(frame int) bool {
+		return frame >= start && frame < end
+	}
+	rebase := func(frame int) int {
+		return frame - base
+	}
+	// -1 marks frames that never happened
+	rebaseEvent := func(frame int) JSONFrame {
+		if frame == -1 {
+			return JSONNever
+		}
+		return JSONFrame(rebase(frame))
+	}
+
+	doc := &JSONMatch{
+		Version:        JSONVersion,
+		Map:            m.MapName,
+		TickRate:       m.TickRate,
+		FrameRate:      m.FrameRate,
+		DemoFrames:     m.TotalFrames,
+		TeamOne:        JSONClan{Name: m.TeamOne.ClanName, Tag: m.TeamOne.Tag},
+		TeamTwo:        JSONClan{Name: m.TeamTwo.ClanName, Tag: m.TeamTwo.Tag},
+		HalfStarts:     make([]int, 0),
+		RoundStarts:    make([]int, 0),
+		Rounds:         make([]JSONRound, 0),
+		Kills:          make([]JSONKill, 0),
+		Shots:          make([]JSONShot, 0),
+		Damage:         make([]JSONDamage, 0),
+		Grenades:       make([]JSONGrenade, 0),
+		GrenadeEffects: make([]JSONGrenadeEffect, 0),
+		BombEvents:     make([]JSONBombEvent, 0),
+	}
+	for _, frame := range m.HalfStarts {
+		if inRange(frame) {
+			doc.HalfStarts = append(doc.HalfStarts, rebase(frame))
+		}
+	}
+	for _, frame := range m.RoundStarts {
+		if inRange(frame) {
+			doc.RoundStarts = append(doc.RoundStarts, rebase(frame))
+		}
+	}
+	for i, round := range m.Rounds {
+		if round.StartFrame >= end || m.roundEnd(i) < start {
+			continue
+		}
+		doc.Rounds = append(doc.Rounds, JSONRound{
+			Number:           round.Number,
+			StartFrame:       rebase(round.StartFrame),
+			FreezeEndFrame:   rebaseEvent(round.FreezeEndFrame),
+			PlantFrame:       rebaseEvent(round.PlantFrame),
+			EndFrame:         rebaseEvent(round.EndFrame),
+			OfficialEndFrame: rebaseEvent(round.OfficialEndFrame),
+			Winner:           int(round.Winner),
+			EndReason:        int(round.EndReason),
+			ScoreCT:          round.ScoreCT,
+			ScoreT:           round.ScoreT,
+			EquipmentValueCT: round.EquipmentValueCT,
+			EquipmentValueT:  round.EquipmentValueT,
+		})
+	}
+	// kills stay on the killfeed for a while after they happened
+	for _, kill := range m.Kills {
+		if kill.Frame >= end || m.killfeedEnd(kill) <= start {
+			continue
+		}
+		doc.Kills = append(doc.Kills, jsonKill(kill, rebase(kill.Frame)))
+	}
+	for _, shot := range m.Shots {
+		if shot.StartFrame >= end || shot.EndFrame <= start {
+			continue
+		}
+		doc.Shots = append(doc.Shots, JSONShot{
+			Tick:       shot.Tick,
+			StartFrame: rebase(shot.StartFrame),
+			EndFrame:   rebase(shot.EndFrame),
+			Position:   vector(shot.Position),
+			ViewX:      shot.ViewDirectionX,
+			Awp:        shot.IsAwpShot,
+		})
+	}
+	for _, damage := range m.Damage {
+		if !inRange(damage.Frame) {
+			continue
+		}
+		doc.Damage = append(doc.Damage, JSONDamage{
+			Frame:       rebase(damage.Frame),
+			Tick:        damage.Tick,
+			Attacker:    playerRef(damage.AttackerName, damage.AttackerTeam, damage.AttackerSteamID),
+			Victim:      playerRef(damage.VictimName, damage.VictimTeam, damage.VictimSteamID),
+			Weapon:      damage.Weapon,
+			HitGroup:    int(damage.HitGroup),
+			Health:      damage.HealthDamage,
+			HealthTaken: damage.HealthDamageTaken,
+			Armor:       damage.ArmorDamage,
+		})
+	}
+	for _, grenade := range m.Grenades {
+		last := grenade.ThrowFrame
+		if grenade.DetonateFrame > last {
+			last = grenade.DetonateFrame
+		}
+		if grenade.ExpireFrame > last {
+			last = grenade.ExpireFrame
+		}
+		if grenade.ThrowFrame >= end || last < start {
+			continue
+		}
+		g := JSONGrenade{
+			ID:            grenade.UniqueID,
+			EntityID:      grenade.EntityID,
+			Type:          int(grenade.Type),
+			Thrower:       playerRef(grenade.ThrowerName, grenade.ThrowerTeam, grenade.ThrowerSteamID),
+			ThrowFrame:    rebase(grenade.ThrowFrame),
+			ThrowTick:     grenade.ThrowTick,
+			Throw:         vector(grenade.ThrowPosition),
+			ThrowViewX:    grenade.ThrowViewDirectionX,
+			ThrowViewY:    grenade.ThrowViewDirectionY,
+			Trajectory:    make([]JSONTrajPoint, len(grenade.Trajectory)),
+			DetonateFrame: rebaseEvent(grenade.DetonateFrame),
+			DetonateTick:  grenade.DetonateTick,
+			Detonate:      vector(grenade.DetonatePosition),
+			ExpireFrame:   rebaseEvent(grenade.ExpireFrame),
+			Extinguished:  grenade.Extinguished,
+		}
+		for j, point := range grenade.Trajectory {
+			g.Trajectory[j] = JSONTrajPoint{Frame: rebase(point.Frame), Position: vector(point.Position)}
+		}
+		for _, hit := range grenade.Hits {
+			g.Hits = append(g.Hits, JSONGrenadeHit{
+				Player: playerRef(hit.PlayerName, hit.PlayerTeam, hit.PlayerSteamID),
+				Health: hit.HealthDamage,
+			})
+		}
+		for _, flashed := range grenade.Flashed {
+			g.Flashed = append(g.Flashed, JSONFlashedPlayer{
+				Player:     playerRef(flashed.PlayerName, flashed.PlayerTeam, flashed.PlayerSteamID),
+				DurationMs: int(flashed.Duration / time.Millisecond),
+			})
+		}
+		doc.Grenades = append(doc.Grenades, g)
+	}
+	for _, effect := range m.GrenadeEffects {
+		if effect.StartFrame >= end || effect.EndFrame <= start {
+			continue
+		}
+		e := JSONGrenadeEffect{
+			Type:       int(effect.GrenadeType),
+			EntityID:   effect.GrenadeEntityID,
+			Position:   vector(effect.Position),
+			StartFrame: rebase(effect.StartFrame),
+			EndFrame:   rebase(effect.EndFrame),
+		}
+		if thrower := effect.Thrower; thrower != nil {
+			e.Thrower = playerRef(thrower.Name, thrower.Team, thrower.SteamID64)
+		}
+		doc.GrenadeEffects = append(doc.GrenadeEffects, e)
+	}
+	for _, bombEvent := range m.BombEvents {
+		if !inRange(bombEvent.Frame) {
+			continue
+		}
+		e := JSONBombEvent{
+			Frame:    rebase(bombEvent.Frame),
+			Tick:     bombEvent.Tick,
+			Type:     int(bombEvent.Type),
+			Player:   playerRef(bombEvent.PlayerName, bombEvent.PlayerTeam, bombEvent.PlayerSteamID),
+			Position: vector(bombEvent.Position),
+			HasKit:   bombEvent.HasKit,
+		}
+		if bombEvent.Site != 0 {
+			e.Site = string(bombEvent.Site)
+		}
+		doc.BombEvents = append(doc.BombEvents, e)
+	}
+
+	return doc
+}
+
+// JSONSample returns the sample of the frame in the schema of WriteJSON.
+func (s *StateStore) JSONSample(frame int) JSONSample {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	s.state(frame)
+
+	sample := JSONSample{
+		Tick:        int(s.IngameTicks[frame]),
+		Phase:       int(s.TimerPhases[frame]),
+		RemainingMs: int(s.TimerRemaining[frame]),
+		ScoreCT:     int(s.ScoresCT[frame]),
+		ScoreT:      int(s.ScoresT[frame]),
+		ClanNameCT:  s.Strings[s.ClanNamesCT[frame]],
+		ClanNameT:   s.Strings[s.ClanNamesT[frame]],
+		Bomb: JSONVector{
+			X: float64(s.BombX[frame]),
+			Y: float64(s.BombY[frame]),
+			Z: float64(s.BombZ[frame]),
+		},
+		Players:  make([]JSONPlayer, len(s.cachePlayer)),
+		Grenades: make([]JSONProjectile, 0),
+		Infernos: make([]JSONInferno, 0),
+	}
+
+	for i, row := range s.cachePlayer {
+		entry := s.Roster[row.roster]
+		loadout := s.Loadouts[row.loadout]
+		sample.Players[i] = JSONPlayer{
+			Name:         entry.Name,
+			SteamID:      entry.SteamID64,
+			UserID:       entry.UserID,
+			IsBot:        entry.IsBot,
+			Team:         int(row.team),
+			X:            row.x,
+			Y:            row.y,
+			Z:            row.z,
+			ViewX:        row.viewX,
+			ViewY:        row.viewY,
+			Health:       row.health,
+			Armor:        row.armor,
+			Money:        row.money,
+			Kills:        row.kills,
+			Deaths:       row.deaths,
+			Assists:      row.assists,
+			Connected:    row.flags&flagConnected != 0,
+			Helmet:       row.flags&flagHelmet != 0,
+			Kit:          row.flags&flagKit != 0,
+			Defusing:     row.flags&flagDefusing != 0,
+			Planting:     row.flags&flagPlanting != 0,
+			HasBomb:      row.roster == int(s.BombCarriers[frame]),
+			FlashMs:      int(row.flashRemaining / time.Millisecond),
+			ActiveWeapon: int(row.activeWeapon),
+			Weapons:      equipmentInts(loadout.Weapons),
+			Grenades:     equipmentInts(loadout.Grenades),
+		}
+	}
+
+	for i := s.ProjectileStarts[frame]; i < s.ProjectileStarts[frame+1]; i++ {
+		sample.Grenades = append(sample.Grenades, JSONProjectile{
+			ID:   s.ProjectileIDs[i],
+			Type: int(s.ProjectileTypes[i]),
+			X:    s.ProjectileX[i],
+			Y:    s.ProjectileY[i],
+			Z:    s.ProjectileZ[i],
+		})
+	}
+
+	for i := s.InfernoStarts[frame]; i < s.InfernoStarts[frame+1]; i++ {
+		hull := s.Hulls[s.InfernoHulls[i]]
+		inferno := JSONInferno{ID: s.InfernoIDs[i], Hull: make([]JSONPoint, len(hull))}
+		for j, p := range hull {
+			inferno.Hull[j] = JSONPoint{X: p.X, Y: p.Y}
+		}
+		sample.Infernos = append(sample.Infernos, inferno)
+	}
+	return sample
+}
+
+// frame returns the frame in a Match, which uses -1 for events that never
+// happened. Events before the first sample happened at or before the first
+// frame as far as a Match read from JSON is concerned, so they are moved to
+// it and never become -1.
+func (f JSONFrame) frame() int {
+	switch {
+	case f == JSONNever:
+		return -1
+	case f < 0:
+		return 0
+	}
+	return int(f)
+}
+
+// ReadJSON builds a match from a JSON document written by WriteJSON.
+func ReadJSON(r io.Reader) (*Match, error) {
+	var doc JSONMatch
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	if doc.Version != JSONVersion {
+		return nil, fmt.Errorf("%w %d, expected %d", ErrJSONVersion, doc.Version, JSONVersion)
+	}
+	if len(doc.Samples) == 0 {
+		return nil, errors.New("match contains no samples")
+	}
+	if doc.FrameRate <= 0 || doc.TickRate <= 0 {
+		return nil, errors.New("match has no frame or tick rate")
+	}
+
+	match := &Match{
+		MapName:          doc.Map,
+		TotalFrames:      doc.DemoFrames,
+		TeamOne:          ocom.Clan{ClanName: doc.TeamOne.Name, Tag: doc.TeamOne.Tag},
+		TeamTwo:          ocom.Clan{ClanName: doc.TeamTwo.Name, Tag: doc.TeamTwo.Tag},
+		HalfStarts:       append(make([]int, 0), doc.HalfStarts...),
+		RoundStarts:      append(make([]int, 0), doc.RoundStarts...),
+		Rounds:           make([]ocom.Round, len(doc.Rounds)),
+		GrenadeEffects:   make([]ocom.GrenadeEffect, len(doc.GrenadeEffects)),
+		FrameRate:        doc.FrameRate,
+		TickRate:         doc.TickRate,
+		FrameRateRounded: int(math.Round(doc.FrameRate)),
+		Kills:            make([]ocom.Kill, len(doc.Kills)),
+		Shots:            make([]ocom.Shot, len(doc.Shots)),
+		Damage:           make([]ocom.Damage, len(doc.Damage)),
+		BombEvents:       make([]ocom.BombEvent, len(doc.BombEvents)),
+		Grenades:         make([]ocom.Grenade, len(doc.Grenades)),
+	}
+
+	states := newStateBuilder()
+	for _, sample := range doc.Samples {
+		states.appendJSON(sample)
+	}
+	match.States = states.store
+
+	for i, round := range doc.Rounds {
+		match.Rounds[i] = ocom.Round{
+			Number:           round.Number,
+			StartFrame:       round.StartFrame,
+			FreezeEndFrame:   round.FreezeEndFrame.frame(),
+			PlantFrame:       round.PlantFrame.frame(),
+			EndFrame:         round.EndFrame.frame(),
+			OfficialEndFrame: round.OfficialEndFrame.frame(),
+			Winner:           common.Team(round.Winner),
+			EndReason:        ocom.RoundEndReason(round.EndReason),
+			ScoreCT:          round.ScoreCT,
+			ScoreT:           round.ScoreT,
+			EquipmentValueCT: round.EquipmentValueCT,
+			EquipmentValueT:  round.EquipmentValueT,
+		}
+	}
+	for i, kill := range doc.Kills {
+		match.Kills[i] = ocom.Kill{
+			Frame:             kill.Frame,
+			Tick:              kill.Tick,
+			KillerName:        kill.Killer.Name,
+			KillerTeam:        common.Team(kill.Killer.Team),
+			KillerSteamID:     kill.Killer.SteamID,
+			KillerPosition:    kill.KillerPosition.r3(),
+			VictimName:        kill.Victim.Name,
+			VictimTeam:        common.Team(kill.Victim.Team),
+			VictimSteamID:     kill.Victim.SteamID,
+			VictimPosition:    kill.VictimPosition.r3(),
+			AssisterName:      kill.Assister.Name,
+			AssisterTeam:      common.Team(kill.Assister.Team),
+			AssisterSteamID:   kill.Assister.SteamID,
+			Weapon:            kill.Weapon,
+			IsHeadshot:        kill.Headshot,
+			PenetratedObjects: kill.PenetratedObjects,
+			IsFlashAssist:     kill.FlashAssist,
+			ThroughSmoke:      kill.ThroughSmoke,
+			NoScope:           kill.NoScope,
+			AttackerBlind:     kill.AttackerBlind,
+		}
+	}
+	for i, shot := range doc.Shots {
+		match.Shots[i] = ocom.Shot{
+			Tick:           shot.Tick,
+			StartFrame:     shot.StartFrame,
+			EndFrame:       shot.EndFrame,
+			Position:       shot.Position.r3(),
+			ViewDirectionX: shot.ViewX,
+			IsAwpShot:      shot.Awp,
+		}
+	}
+	for i, damage := range doc.Damage {
+		match.Damage[i] = ocom.Damage{
+			Frame:             damage.Frame,
+			Tick:              damage.Tick,
+			AttackerName:      damage.Attacker.Name,
+			AttackerTeam:      common.Team(damage.Attacker.Team),
+			AttackerSteamID:   damage.Attacker.SteamID,
+			VictimName:        damage.Victim.Name,
+			VictimTeam:        common.Team(damage.Victim.Team),
+			VictimSteamID:     damage.Victim.SteamID,
+			Weapon:            damage.Weapon,
+			HitGroup:          event.HitGroup(damage.HitGroup),
+			HealthDamage:      damage.Health,
+			HealthDamageTaken: damage.HealthTaken,
+			ArmorDamage:       damage.Armor,
+		}
+	}
+	for i, grenade := range doc.Grenades {
+		g := ocom.Grenade{
+			UniqueID:            grenade.ID,
+			EntityID:            grenade.EntityID,
+			Type:                common.EquipmentType(grenade.Type),
+			ThrowerName:         grenade.Thrower.Name,
+			ThrowerTeam:         common.Team(grenade.Thrower.Team),
+			ThrowerSteamID:      grenade.Thrower.SteamID,
+			ThrowFrame:          grenade.ThrowFrame,
+			ThrowTick:           grenade.ThrowTick,
+			ThrowPosition:       grenade.Throw.r3(),
+			ThrowViewDirectionX: grenade.ThrowViewX,
+			ThrowViewDirectionY: grenade.ThrowViewY,
+			Trajectory:          make([]ocom.TrajectoryPoint, len(grenade.Trajectory)),
+			DetonateFrame:       grenade.DetonateFrame.frame(),
+			DetonateTick:        grenade.DetonateTick,
+			DetonatePosition:    grenade.Detonate.r3(),
+			ExpireFrame:         grenade.ExpireFrame.frame(),
+			Hits:                make([]ocom.GrenadeHit, len(grenade.Hits)),
+			Flashed:             make([]ocom.FlashedPlayer, len(grenade.Flashed)),
+			Extinguished:        grenade.Extinguished,
+		}
+		for j, point := range grenade.Trajectory {
+			g.Trajectory[j] = ocom.TrajectoryPoint{Frame: point.Frame, Position: point.Position.r3()}
+		}
+		for j, hit := range grenade.Hits {
+			g.Hits[j] = ocom.GrenadeHit{
+				PlayerName:    hit.Player.Name,
+				PlayerTeam:    common.Team(hit.Player.Team),
+				PlayerSteamID: hit.Player.SteamID,
+				HealthDamage:  hit.Health,
+			}
+		}
+		for j, flashed := range grenade.Flashed {
+			g.Flashed[j] = ocom.FlashedPlayer{
+				PlayerName:    flashed.Player.Name,
+				PlayerTeam:    common.Team(flashed.Player.Team),
+				PlayerSteamID: flashed.Player.SteamID,
+				Duration:      time.Duration(flashed.DurationMs) * time.Millisecond,
+			}
+		}
+		match.Grenades[i] = g
+	}
+	for i, effect := range doc.GrenadeEffects {
+		e := event.GrenadeEvent{
+			GrenadeType:     common.EquipmentType(effect.Type),
+			Grenade:         common.NewEquipment(common.EquipmentType(effect.Type)),
+			Position:        effect.Position.r3(),
+			GrenadeEntityID: effect.EntityID,
+		}
+		if effect.Thrower != (JSONPlayerRef{}) {
+			e.Thrower = &common.Player{
+				Name:      effect.Thrower.Name,
+				SteamID64: effect.Thrower.SteamID,
+				Team:      common.Team(effect.Thrower.Team),
+			}
+		}
+		match.GrenadeEffects[i] = ocom.GrenadeEffect{
+			GrenadeEvent: e,
+			StartFrame:   effect.StartFrame,
+			EndFrame:     effect.EndFrame,
+		}
+	}
+	for i, bombEvent := range doc.BombEvents {
+		e := ocom.BombEvent{
+			Frame:         bombEvent.Frame,
+			Tick:          bombEvent.Tick,
+			Type:          ocom.BombEventType(bombEvent.Type),
+			PlayerName:    bombEvent.Player.Name,
+			PlayerTeam:    common.Team(bombEvent.Player.Team),
+			PlayerSteamID: bombEvent.Player.SteamID,
+			Position:      bombEvent.Position.r3(),
+			HasKit:        bombEvent.HasKit,
+		}
+		if bombEvent.Site != "" {
+			e.Site = []rune(bombEvent.Site)[0]
+		}
+		match.BombEvents[i] = e
+	}
+
+	match.buildIndexes()
+	return match, nil
+}
+
+// appendJSON appends the state of a sample.
+func (b *stateBuilder) appendJSON(sample JSONSample) {
+	values := frameValues{
+		tick: sample.Tick,
+		timer: ocom.Timer{
+			TimeRemaining: time.Duration(sample.RemainingMs) * time.Millisecond,
+			Phase:         ocom.Phase(sample.Phase),
+		},
+		scoreCT:     sample.ScoreCT,
+		scoreT:      sample.ScoreT,
+		clanNameCT:  sample.ClanNameCT,
+		clanNameT:   sample.ClanNameT,
+		players:     make([]playerRow, 0, len(sample.Players)),
+		bombCarrier: -1,
+		bomb:        sample.Bomb.r3(),
+	}
+
+	for _, p := range sample.Players {
+		var flags uint8
+		if p.Connected {
+			flags |= flagConnected
+		}
+		if p.Helmet {
+			flags |= flagHelmet
+		}
+		if p.Kit {
+			flags |= flagKit
+		}
+		if p.Defusing {
+			flags |= flagDefusing
+		}
+		if p.Planting {
+			flags |= flagPlanting
+		}
+		row := playerRow{
+			roster: b.rosterIndex(RosterEntry{
+				Name:      p.Name,
+				SteamID64: p.SteamID,
+				UserID:    p.UserID,
+				IsBot:     p.IsBot,
+			}),
+			team:           common.Team(p.Team),
+			x:              p.X,
+			y:              p.Y,
+			z:              p.Z,
+			viewX:          p.ViewX,
+			viewY:          p.ViewY,
+			health:         p.Health,
+			armor:          p.Armor,
+			money:          p.Money,
+			kills:          p.Kills,
+			deaths:         p.Deaths,
+			assists:        p.Assists,
+			flags:          flags,
+			flashRemaining: time.Duration(p.FlashMs) * time.Millisecond,
+			activeWeapon:   common.EquipmentType(p.ActiveWeapon),
+			loadout:        b.loadoutIndex(equipmentTypes(p.Weapons), equipmentTypes(p.Grenades)),
+		}
+		if p.HasBomb {
+			values.bombCarrier = row.roster
+		}
+		values.players = append(values.players, row)
+	}
+
+	for _, projectile := range sample.Grenades {
+		values.projectiles = append(values.projectiles, projectileRow{
+			id:          projectile.ID,
+			grenadeType: common.EquipmentType(projectile.Type),
+			x:           projectile.X,
+			y:           projectile.Y,
+			z:           projectile.Z,
+		})
+	}
+
+	for _, inferno := range sample.Infernos {
+		hull := make([]r2.Point, len(inferno.Hull))
+		for i, p := range inferno.Hull {
+			hull[i] = r2.Point{X: p.X, Y: p.Y}
+		}
+		values.infernos = append(values.infernos, infernoRow{
+			id:   inferno.ID,
+			hull: b.hull(inferno.ID, hull),
+		})
+	}
+
+	b.append(values)
+}
+
+// jsonKill converts the kill, which happened at frame in the document.
+func jsonKill(kill ocom.Kill, frame int) JSONKill {
+	return JSONKill{
+		Frame:             frame,
+		Tick:              kill.Tick,
+		Killer:            playerRef(kill.KillerName, kill.KillerTeam, kill.KillerSteamID),
+		KillerPosition:    vector(kill.KillerPosition),
+		Victim:            playerRef(kill.VictimName, kill.VictimTeam, kill.VictimSteamID),
+		VictimPosition:    vector(kill.VictimPosition),
+		Assister:          playerRef(kill.AssisterName, kill.AssisterTeam, kill.AssisterSteamID),
+		Weapon:            kill.Weapon,
+		Headshot:          kill.IsHeadshot,
+		PenetratedObjects: kill.PenetratedObjects,
+		FlashAssist:       kill.IsFlashAssist,
+		ThroughSmoke:      kill.ThroughSmoke,
+		NoScope:           kill.NoScope,
+		AttackerBlind:     kill.AttackerBlind,
+	}
+}
+
+func vector(v r3.Vector) JSONVector {
+	return JSONVector{X: v.X, Y: v.Y, Z: v.Z}
+}
+
+func (v JSONVector) r3() r3.Vector {
+	return r3.Vector{X: v.X, Y: v.Y, Z: v.Z}
+}
+
+func playerRef(name string, team common.Team, steamID uint64) JSONPlayerRef {
+	return JSONPlayerRef{Name: name, SteamID: steamID, Team: int(team)}
+}
+
+func equipmentInts(types []common.EquipmentType) []int {
+	ints := make([]int, len(types))
+	for i, t := range types {
+		ints[i] = int(t)
+	}
+	return ints
+}
+
+func equipmentTypes(ints []int) []common.EquipmentType {
+	types := make([]common.EquipmentType, len(ints))
+	for i, t := range ints {
+		types[i] = common.EquipmentType(t)
+	}
+	return types
+}
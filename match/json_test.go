@@ -0,0 +1,168 @@
+package match
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	ocom "github.com/lwayneh/dem-replay/common"
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	event "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+)
+
+// jsonTestMatch returns testMatch with damage, grenades and bomb events,
+// which the cache test doesn't need.
+func jsonTestMatch() *Match {
+	m := testMatch()
+	m.TeamOne = ocom.Clan{ClanName: "Orange", Tag: "OR"}
+	m.TeamTwo = ocom.Clan{ClanName: "Blue", Tag: "BL"}
+	m.Damage = []ocom.Damage{{
+		Frame: 20, Tick: 80, AttackerName: "A", AttackerTeam: common.TeamTerrorists, AttackerSteamID: 1,
+		VictimName: "B", VictimTeam: common.TeamCounterTerrorists, VictimSteamID: 2,
+		Weapon: "AK-47", HitGroup: event.HitGroupHead, HealthDamage: 112, HealthDamageTaken: 100, ArmorDamage: 20,
+	}}
+	m.Grenades = []ocom.Grenade{{
+		UniqueID: 5, EntityID: 7, Type: common.EqFlash,
+		ThrowerName: "C", ThrowerTeam: common.TeamCounterTerrorists, ThrowerSteamID: 3,
+		ThrowFrame: 12, ThrowTick: 48, ThrowPosition: r3.Vector{X: 1, Y: 2, Z: 3}, ThrowViewDirectionX: 90, ThrowViewDirectionY: -10,
+		Trajectory: []ocom.TrajectoryPoint{
+			{Frame: 12, Position: r3.Vector{X: 1, Y: 2, Z: 3}},
+			{Frame: 14, Position: r3.Vector{X: 5, Y: 6, Z: 7}},
+		},
+		DetonateFrame: 14, DetonateTick: 56, DetonatePosition: r3.Vector{X: 5, Y: 6, Z: 7}, ExpireFrame: 14,
+		Hits:    []ocom.GrenadeHit{{PlayerName: "A", PlayerTeam: common.TeamTerrorists, PlayerSteamID: 1, HealthDamage: 1}},
+		Flashed: []ocom.FlashedPlayer{{PlayerName: "A", PlayerTeam: common.TeamTerrorists, PlayerSteamID: 1, Duration: 2500 * time.Millisecond}},
+	}}
+	m.BombEvents = []ocom.BombEvent{{
+		Frame: 80, Tick: 320, Type: ocom.BombPlanted, PlayerName: "A", PlayerTeam: common.TeamTerrorists, PlayerSteamID: 1,
+		Position: r3.Vector{X: 9, Y: 8, Z: 7}, Site: 'B',
+	}}
+	m.GrenadeEffects[0].Thrower = &common.Player{Name: "C", SteamID64: 3, Team: common.TeamCounterTerrorists}
+	m.GrenadeEffects[0].Position = r3.Vector{X: 4, Y: 5, Z: 6}
+	return m
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	want := jsonTestMatch()
+	var buf bytes.Buffer
+	if err := want.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.MapName != want.MapName || got.TotalFrames != want.TotalFrames || got.FrameRate != want.FrameRate ||
+		got.TickRate != want.TickRate || got.TeamOne != want.TeamOne || got.TeamTwo != want.TeamTwo {
+		t.Errorf("got match %v with %d frames at %v/%v of %v and %v", got.MapName, got.TotalFrames,
+			got.FrameRate, got.TickRate, got.TeamOne, got.TeamTwo)
+	}
+	for _, field := range []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"half starts", got.HalfStarts, want.HalfStarts},
+		{"round starts", got.RoundStarts, want.RoundStarts},
+		{"rounds", got.Rounds, want.Rounds},
+		{"kills", got.Kills, want.Kills},
+		{"shots", got.Shots, want.Shots},
+		{"damage", got.Damage, want.Damage},
+		{"grenades", got.Grenades, want.Grenades},
+		{"bomb events", got.BombEvents, want.BombEvents},
+	} {
+		if !reflect.DeepEqual(field.got, field.want) {
+			t.Errorf("got %v %+v, want %+v", field.name, field.got, field.want)
+		}
+	}
+
+	if len(got.GrenadeEffects) != 1 {
+		t.Fatalf("got %d grenade effects, want 1", len(got.GrenadeEffects))
+	}
+	g, w := got.GrenadeEffects[0], want.GrenadeEffects[0]
+	if g.GrenadeType != w.GrenadeType || g.GrenadeEntityID != w.GrenadeEntityID || g.Position != w.Position ||
+		g.StartFrame != w.StartFrame || g.EndFrame != w.EndFrame || g.Grenade.Type != w.GrenadeType ||
+		g.Thrower == nil || g.Thrower.Name != w.Thrower.Name || g.Thrower.SteamID64 != w.Thrower.SteamID64 {
+		t.Errorf("got grenade effect %+v, want %+v", g, w)
+	}
+
+	if got.StateCount() != want.StateCount() {
+		t.Fatalf("got %d states, want %d", got.StateCount(), want.StateCount())
+	}
+	for frame := 0; frame < want.StateCount(); frame++ {
+		gotState, wantState := got.State(frame), want.State(frame)
+		if g, w := comparable(gotState), comparable(wantState); !reflect.DeepEqual(g, w) {
+			t.Fatalf("frame %d:\ngot  %+v\nwant %+v", frame, g, w)
+		}
+		if len(gotState.Grenades) != len(wantState.Grenades) {
+			t.Fatalf("frame %d: got %d grenades, want %d", frame, len(gotState.Grenades), len(wantState.Grenades))
+		}
+		for i := range wantState.Grenades {
+			if g, w := gotState.Grenades[i], wantState.Grenades[i]; g.WeaponInstance.Type != w.WeaponInstance.Type || g.Trajectory[0] != w.Trajectory[0] {
+				t.Fatalf("frame %d: got grenade %v at %v, want %v at %v", frame,
+					g.WeaponInstance.Type, g.Trajectory[0], w.WeaponInstance.Type, w.Trajectory[0])
+			}
+		}
+	}
+}
+
+// TestJSONFramesKillfeed checks that kills which happened before the first
+// frame, but are still on the killfeed, are written with negative frames.
+func TestJSONFramesKillfeed(t *testing.T) {
+	m := jsonTestMatch()
+	var buf bytes.Buffer
+	if err := m.WriteJSONFrames(&buf, 30, 60); err != nil {
+		t.Fatal(err)
+	}
+	clip, err := ReadJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clip.StateCount() != 30 {
+		t.Errorf("got %d states, want 30", clip.StateCount())
+	}
+	// the second kill happens after the clip
+	if len(clip.Kills) != 1 || clip.Kills[0].Frame != -10 || clip.Kills[0].VictimName != "B" {
+		t.Fatalf("got kills %+v, want the kill of B at frame -10", clip.Kills)
+	}
+	if got := clip.KillsAt(0); len(got) != 1 {
+		t.Errorf("got %d kills on the killfeed of the first frame, want 1", len(got))
+	}
+	// damage isn't shown after it happened
+	if len(clip.Damage) != 0 {
+		t.Errorf("got damage %+v before the clip", clip.Damage)
+	}
+}
+
+// TestJSONFramesNever checks that events one frame before the first frame
+// aren't mistaken for events that never happened.
+func TestJSONFramesNever(t *testing.T) {
+	m := jsonTestMatch()
+	// the bomb of the second round is planted at frame 80
+	var buf bytes.Buffer
+	if err := m.WriteJSONFrames(&buf, 81, 120); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(`"plantFrame":-1`)) || !bytes.Contains(buf.Bytes(), []byte(`"officialEndFrame":null`)) {
+		t.Error("didn't write the plant as -1 and the official end as null")
+	}
+
+	var doc JSONMatch
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Rounds) != 1 || doc.Rounds[0].PlantFrame != -1 || doc.Rounds[0].OfficialEndFrame != JSONNever {
+		t.Fatalf("got rounds %+v, want the plant at -1 and no official end", doc.Rounds)
+	}
+
+	clip, err := ReadJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if round := clip.Rounds[0]; round.PlantFrame != 0 || round.OfficialEndFrame != -1 || round.EndFrame != 29 {
+		t.Errorf("got round %+v, want the plant at the first frame", round)
+	}
+}
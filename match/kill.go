@@ -0,0 +1,207 @@
+package match
+
+import (
+	"github.com/golang/geo/r2"
+	"github.com/golang/geo/r3"
+	ocom "github.com/lwayneh/dem-replay/common"
+	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	event "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+	msg "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/msg"
+)
+
+// registerKillHandlers records kills for the killfeed.
+// The Kill event comes with the generic player_death event, which contains
+// additional flags in recent demos. Kills are therefore completed and added
+// to the killfeed when both events arrived, or at the end of the frame.
+func registerKillHandlers(parser dem.Parser, match *Match) {
+	recorder := newKillRecorder(match)
+
+	parser.RegisterEventHandler(func(e event.Kill) {
+		kill := ocom.Kill{
+			KillerName:        "World",
+			KillerTeam:        common.TeamUnassigned,
+			VictimName:        "World",
+			VictimTeam:        common.TeamUnassigned,
+			Weapon:            e.Weapon.Type.String(),
+			IsHeadshot:        e.IsHeadshot,
+			PenetratedObjects: e.PenetratedObjects,
+		}
+		if e.Killer != nil {
+			kill.KillerName = e.Killer.Name
+			kill.KillerTeam = e.Killer.Team
+			kill.KillerSteamID = e.Killer.SteamID64
+			kill.KillerPosition = e.Killer.LastAlivePosition
+		}
+		if e.Victim != nil {
+			kill.VictimName = e.Victim.Name
+			kill.VictimTeam = e.Victim.Team
+			kill.VictimSteamID = e.Victim.SteamID64
+			kill.VictimPosition = e.Victim.LastAlivePosition
+		}
+		if e.Assister != nil {
+			kill.AssisterName = e.Assister.Name
+			kill.AssisterTeam = e.Assister.Team
+			kill.AssisterSteamID = e.Assister.SteamID64
+		}
+		key := deathKey{victim: userID(e.Victim), attacker: userID(e.Killer)}
+		recorder.kill(kill, key, e.Killer, match.frame(), parser.GameState().IngameTick())
+	})
+
+	parser.RegisterEventHandler(func(e event.GenericGameEvent) {
+		if e.Name != "player_death" {
+			return
+		}
+		key := deathKey{
+			victim:   int(e.Data["userid"].GetValShort()),
+			attacker: int(e.Data["attacker"].GetValShort()),
+		}
+		recorder.death(key, e.Data, match.frame(), parser.GameState().IngameTick())
+	})
+
+	parser.RegisterEventHandler(func(event.FrameDone) {
+		recorder.flush(match.frame(), parser.GameState().IngameTick())
+	})
+}
+
+// deathKey identifies a death by the user IDs of the victim and the
+// attacker, 0 if there is none.
+type deathKey struct {
+	victim, attacker int
+}
+
+func userID(p *common.Player) int {
+	if p == nil {
+		return 0
+	}
+	return p.UserID
+}
+
+// pendingKill is a Kill event waiting for its player_death event.
+type pendingKill struct {
+	kill   ocom.Kill
+	key    deathKey
+	killer *common.Player
+}
+
+// killRecorder pairs Kill events with their player_death events. Either may
+// arrive first, as the parser delays Kill events until players are known.
+type killRecorder struct {
+	match *Match
+	// kills in the order they happened
+	kills []pendingKill
+	// player_death events without a Kill event
+	deaths map[deathKey]map[string]*msg.CSVCMsg_GameEventKeyT
+}
+
+func newKillRecorder(match *Match) *killRecorder {
+	return &killRecorder{
+		match:  match,
+		deaths: make(map[deathKey]map[string]*msg.CSVCMsg_GameEventKeyT),
+	}
+}
+
+// kill adds the kill of a Kill event, completing it if its player_death event
+// arrived already.
+func (r *killRecorder) kill(kill ocom.Kill, key deathKey, killer *common.Player, frame, tick int) {
+	pending := pendingKill{kill: kill, key: key, killer: killer}
+	if data, ok := r.deaths[key]; ok {
+		delete(r.deaths, key)
+		r.finish(pending, data, frame, tick)
+		return
+	}
+	r.kills = append(r.kills, pending)
+}
+
+// death completes the kill of a player_death event, or keeps the event until
+// its Kill event arrives.
+func (r *killRecorder) death(key deathKey, data map[string]*msg.CSVCMsg_GameEventKeyT, frame, tick int) {
+	for i, pending := range r.kills {
+		if pending.key == key {
+			r.kills = append(r.kills[:i], r.kills[i+1:]...)
+			r.finish(pending, data, frame, tick)
+			return
+		}
+	}
+	r.deaths[key] = data
+}
+
+// flush completes the kills of the frame whose player_death event is missing
+// and drops player_death events without a kill.
+func (r *killRecorder) flush(frame, tick int) {
+	for _, pending := range r.kills {
+		r.finish(pending, nil, frame, tick)
+	}
+	r.kills = r.kills[:0]
+	for key := range r.deaths {
+		delete(r.deaths, key)
+	}
+}
+
+// finish adds the kill to the killfeed with the flags of its player_death
+// event. Flags that are missing are estimated.
+func (r *killRecorder) finish(pending pendingKill, data map[string]*msg.CSVCMsg_GameEventKeyT, frame, tick int) {
+	kill := pending.kill
+	killer := pending.killer
+
+	// older demos don't contain these flags, estimate them instead
+	if key, ok := data["assistedflash"]; ok {
+		kill.IsFlashAssist = key.GetValBool()
+	}
+	if key, ok := data["noscope"]; ok {
+		kill.NoScope = key.GetValBool()
+	} else if killer != nil {
+		kill.NoScope = isScopedWeapon(kill.Weapon) && !killer.IsScoped()
+	}
+	if key, ok := data["thrusmoke"]; ok {
+		kill.ThroughSmoke = key.GetValBool()
+	} else if killer != nil {
+		kill.ThroughSmoke = throughSmoke(kill.KillerPosition, kill.VictimPosition, r.match.activeSmokes())
+	}
+	if key, ok := data["attackerblind"]; ok {
+		kill.AttackerBlind = key.GetValBool()
+	} else if killer != nil {
+		kill.AttackerBlind = killer.IsBlinded()
+	}
+
+	kill.Frame = frame
+	kill.Tick = tick
+	r.match.Kills = append(r.match.Kills, kill)
+}
+
+func isScopedWeapon(weapon string) bool {
+	switch weapon {
+	case common.EqAWP.String(), common.EqSSG08.String(), common.EqScar20.String(), common.EqG3SG1.String():
+		return true
+	}
+	return false
+}
+
+// throughSmoke returns true if the line between from and to passes through
+// any of the smokes.
+func throughSmoke(from, to r3.Vector, smokes []r3.Vector) bool {
+	a := r2.Point{X: from.X, Y: from.Y}
+	b := r2.Point{X: to.X, Y: to.Y}
+	for _, smoke := range smokes {
+		center := r2.Point{X: smoke.X, Y: smoke.Y}
+		if distanceToSegment(center, a, b) < smokeRadius {
+			return true
+		}
+	}
+	return false
+}
+
+func distanceToSegment(p, a, b r2.Point) float64 {
+	ab := b.Sub(a)
+	length := ab.Dot(ab)
+	if length == 0 {
+		return p.Sub(a).Norm()
+	}
+	t := p.Sub(a).Dot(ab) / length
+	if t < 0 {
+		t = 0
+	} else if t > 1 {
+		t = 1
+	}
+	return p.Sub(a.Add(ab.Mul(t))).Norm()
+}
@@ -0,0 +1,59 @@
+package match
+
+import (
+	"testing"
+
+	ocom "github.com/lwayneh/dem-replay/common"
+	msg "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/msg"
+)
+
+func deathData(flags ...string) map[string]*msg.CSVCMsg_GameEventKeyT {
+	data := map[string]*msg.CSVCMsg_GameEventKeyT{
+		"assistedflash": {ValBool: false},
+		"noscope":       {ValBool: false},
+		"thrusmoke":     {ValBool: false},
+		"attackerblind": {ValBool: false},
+	}
+	for _, flag := range flags {
+		data[flag] = &msg.CSVCMsg_GameEventKeyT{ValBool: true}
+	}
+	return data
+}
+
+func TestKillRecorder(t *testing.T) {
+	m := new(Match)
+	r := newKillRecorder(m)
+	first := deathKey{victim: 2, attacker: 3}
+	second := deathKey{victim: 4, attacker: 5}
+
+	// the usual order: the Kill event is followed by its player_death event
+	r.kill(ocom.Kill{VictimName: "a"}, first, nil, 10, 1000)
+	r.death(first, deathData("noscope"), 10, 1000)
+
+	// delayed Kill events arrive after their player_death events, which
+	// must not be attached to other kills
+	r.death(second, deathData("thrusmoke"), 11, 1010)
+	r.kill(ocom.Kill{VictimName: "c"}, deathKey{victim: 6, attacker: 3}, nil, 11, 1010)
+	r.kill(ocom.Kill{VictimName: "b"}, second, nil, 11, 1010)
+	// a player_death event without a Kill event is dropped
+	r.death(deathKey{victim: 8, attacker: 9}, deathData("attackerblind"), 11, 1010)
+	r.flush(11, 1010)
+	r.flush(12, 1020)
+
+	want := []ocom.Kill{
+		{VictimName: "a", NoScope: true, Frame: 10, Tick: 1000},
+		{VictimName: "b", ThroughSmoke: true, Frame: 11, Tick: 1010},
+		{VictimName: "c", Frame: 11, Tick: 1010},
+	}
+	if len(m.Kills) != len(want) {
+		t.Fatalf("got %d kills, want %d: %+v", len(m.Kills), len(want), m.Kills)
+	}
+	for i := range want {
+		if m.Kills[i] != want[i] {
+			t.Errorf("kill %d: got %+v, want %+v", i, m.Kills[i], want[i])
+		}
+	}
+	if len(r.kills) != 0 || len(r.deaths) != 0 {
+		t.Errorf("pending after flush: %d kills, %d deaths", len(r.kills), len(r.deaths))
+	}
+}
@@ -2,12 +2,13 @@
 package match
 
 import (
+	"context"
 	"errors"
+	"io"
 	"log"
 	"math"
 	"os"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
@@ -18,166 +19,171 @@ import (
 )
 
 const (
-	flashEffectLifetime int = 10
-	heEffectLifetime    int = 10
-	killfeedLifetime    int = 10
-	c4timer             int = 40
+	smokeRadius float64 = 144
 )
 
-var (
-	started = false
-	teamOne ocom.Clan
-	teamTwo ocom.Clan
-	// TotalFrames provides the total frames to be parsed in the demo
-	TotalFrames int
-	frameCount  float64
-	//Progress contains the percent of frames currently parsed of the total frames in the demo
-	Progress float64
+// Durations of the tracers of shots in the viewer.
+const (
+	shotDuration    = time.Second / 32
+	awpShotDuration = time.Second / 8
 )
 
 // Match contains general information about the demo and all relevant, parsed
 // data from every tick of the demo that will be displayed.
 type Match struct {
 	MapName              string
+	TotalFrames          int
+	TeamOne              ocom.Clan
+	TeamTwo              ocom.Clan
 	HalfStarts           []int
 	RoundStarts          []int
-	GrenadeEffects       map[int][]ocom.GrenadeEffect
+	Rounds               []ocom.Round
+	GrenadeEffects       []ocom.GrenadeEffect
 	FrameRate            float64
 	TickRate             float64
 	FrameRateRounded     int
-	States               []ocom.OverviewState
-	SmokeEffectLifetime  int
-	Killfeed             map[int][]ocom.Kill
-	Shots                map[int][]ocom.Shot
+	States               *StateStore
+	Kills                []ocom.Kill
+	Shots                []ocom.Shot
+	Damage               []ocom.Damage
+	BombEvents           []ocom.BombEvent
+	Grenades             []ocom.Grenade
 	currentPhase         ocom.Phase
+	rules                GameRules
 	latestTimerEventTime time.Duration
+	// indices in Grenades of the projectiles that were not destroyed yet
+	activeGrenades map[int]int
+	// smokes and decoys that did not expire yet by the entity id of their
+	// projectile
+	pendingEffects map[int]pendingEffect
+	killIndex      *intervalTree
+	shotIndex      *intervalTree
+	effectIndex    *intervalTree
+	flashIndex     *intervalTree
+	flightIndex    *intervalTree
+	// damage totals after every round, by index in Rounds
+	roundTotals []roundTotal
+	// flash statistics after every flashbang of a player
+	flashTotals map[playerKey][]flashTotal
 }
 
 // NewMatch parses the demo at the specified path in the argument and returns a
 // match.Match containing all relevant data from the demo.
 // fallbackFrameRate and fallbackTickRate are used in case the values cannot be
 // parsed from the demo. If they are not set, they must be -1.
-func NewMatch(demoFileName string, fallbackFrameRate, fallbackTickRate float64) (*Match, error) {
-	demo, err := os.Open(demoFileName)
+// progress is handled as described for Options.Progress and may be nil.
+func NewMatch(demoFileName string, fallbackFrameRate, fallbackTickRate float64, progress chan<- Progress) (*Match, error) {
+	opts := Options{
+		FallbackFrameRate: fallbackFrameRate,
+		FallbackTickRate:  fallbackTickRate,
+		Progress:          progress,
+	}
+	return NewMatchContext(context.Background(), demoFileName, opts)
+}
+
+// NewMatchContext parses the demo at the specified path like NewMatch, but
+// stops as soon as ctx is done and returns a *CanceledError in that case.
+// Compressed demos and zip archives are supported, see OpenDemo.
+// All parsing state is kept per call, so several demos can be parsed
+// concurrently.
+func NewMatchContext(ctx context.Context, demoFileName string, opts Options) (*Match, error) {
+	if opts.Progress != nil {
+		defer close(opts.Progress)
+	}
+	if opts.CacheDir == "" {
+		return parseFile(ctx, demoFileName, opts)
+	}
+	return parseFileCached(ctx, demoFileName, opts)
+}
+
+func parseFile(ctx context.Context, demoFileName string, opts Options) (*Match, error) {
+	file, err := os.Open(demoFileName)
 	if err != nil {
 		return nil, err
 	}
-	defer demo.Close()
+	defer file.Close()
 
-	/* // Minify demo to JSON with snapshot 1 per second (0.5 for 1 per 2 seconds)
-	freq := 1.0
-	buf := new(bytes.Buffer)
-	err = csminify.MinifyTo(demo, freq, marshalJSON, buf)
+	demo, err := OpenDemo(file)
 	if err != nil {
-			log.Fatal(err)
+		return nil, err
 	}
-	//Decode replay
-	var r rep.Replay
-	err = json.NewDecoder(buf).Decode(&r)
-	if err != nil {
-		log.Fatal(err)
-	} */
+	defer demo.Close()
+
+	return parseDemo(ctx, demo, opts)
+}
 
+func parseDemo(ctx context.Context, demo io.Reader, opts Options) (*Match, error) {
 	parser := dem.NewParser(demo)
+	defer parser.Close()
 	header, err := parser.ParseHeader()
 	if err != nil {
 		return nil, err
 	}
-	TotalFrames = parser.Header().PlaybackFrames
 	match := &Match{
+		TotalFrames:    parser.Header().PlaybackFrames,
 		HalfStarts:     make([]int, 0),
 		RoundStarts:    make([]int, 0),
-		GrenadeEffects: make(map[int][]ocom.GrenadeEffect),
-		Killfeed:       make(map[int][]ocom.Kill),
-		Shots:          make(map[int][]ocom.Shot),
+		Rounds:         make([]ocom.Round, 0),
+		Damage:         make([]ocom.Damage, 0),
+		BombEvents:     make([]ocom.BombEvent, 0),
+		Grenades:       make([]ocom.Grenade, 0),
+		GrenadeEffects: make([]ocom.GrenadeEffect, 0),
+		Kills:          make([]ocom.Kill, 0),
+		Shots:          make([]ocom.Shot, 0),
 	}
 
 	match.FrameRate = header.FrameRate()
 	if math.IsNaN(match.FrameRate) || match.FrameRate == 0 {
-		if fallbackFrameRate == -1 {
+		if opts.FallbackFrameRate == -1 {
 			err := errors.New("could not parse Framerate from demo." +
 				"Please provide a fallback value (command-line option -framerate)")
 			return nil, err
 		}
-		match.FrameRate = fallbackFrameRate
+		match.FrameRate = opts.FallbackFrameRate
 	}
 	match.TickRate = parser.TickRate()
 	if math.IsNaN(match.TickRate) || match.TickRate == 0 {
-		if fallbackTickRate == -1 {
+		if opts.FallbackTickRate == -1 {
 			err := errors.New("could not parse Tickrate from demo." +
 				"Please provide a fallback value (command-line option -tickrate)")
 			return nil, err
 		}
-		match.TickRate = fallbackTickRate
+		match.TickRate = opts.FallbackTickRate
+	}
+	sampling := opts.StatesPerSecond > 0 && opts.StatesPerSecond < match.FrameRate
+	if sampling {
+		match.FrameRate = opts.StatesPerSecond
 	}
 	match.FrameRateRounded = int(math.Round(match.FrameRate))
 	match.MapName = header.MapName
-	match.SmokeEffectLifetime = int(18 * match.FrameRate)
+	states := newStateBuilder()
+	match.States = states.store
+
+	match.rules = NewGameRules(parser.GameState().ConVars())
+	parser.RegisterEventHandler(func(e event.ConVarsUpdated) {
+		match.rules = NewGameRules(parser.GameState().ConVars())
+	})
 
+	registerRoundHandlers(parser, match)
 	parser.RegisterEventHandler(func(event.RoundStart) {
-		match.RoundStarts = append(match.RoundStarts, parser.CurrentFrame())
+		match.RoundStarts = append(match.RoundStarts, match.frame())
 	})
 	parser.RegisterEventHandler(func(e event.MatchStart) {
-		match.HalfStarts = append(match.HalfStarts, parser.CurrentFrame())
+		match.HalfStarts = append(match.HalfStarts, match.frame())
 	})
 
 	parser.RegisterEventHandler(func(event.GameHalfEnded) {
-		match.HalfStarts = append(match.HalfStarts, parser.CurrentFrame())
+		match.HalfStarts = append(match.HalfStarts, match.frame())
 	})
 	parser.RegisterEventHandler(func(e event.WeaponFire) {
-		frame := parser.CurrentFrame()
-		weaponFireEventHandler(frame, e, match)
-	})
-	parser.RegisterEventHandler(func(e event.FlashExplode) {
-		frame := parser.CurrentFrame()
-		grenadeEventHandler(flashEffectLifetime, frame, e.GrenadeEvent, match)
-	})
-	parser.RegisterEventHandler(func(e event.HeExplode) {
-		frame := parser.CurrentFrame()
-		grenadeEventHandler(heEffectLifetime, frame, e.GrenadeEvent, match)
-	})
-	parser.RegisterEventHandler(func(e event.SmokeStart) {
-		frame := parser.CurrentFrame()
-		grenadeEventHandler(match.SmokeEffectLifetime, frame, e.GrenadeEvent, match)
-	})
-	parser.RegisterEventHandler(func(e event.Kill) {
-		frame := parser.CurrentFrame()
-		var killerName, victimName string
-		var killerTeam, victimTeam common.Team
-		if e.Killer == nil {
-			killerName = "World"
-			killerTeam = common.TeamUnassigned
-		} else {
-			killerName = e.Killer.Name
-			killerTeam = e.Killer.Team
-		}
-		if e.Victim == nil {
-			victimName = "World"
-			victimTeam = common.TeamUnassigned
-		} else {
-			victimName = e.Victim.Name
-			victimTeam = e.Victim.Team
-		}
-		kill := ocom.Kill{
-			KillerName: killerName,
-			KillerTeam: killerTeam,
-			VictimName: victimName,
-			VictimTeam: victimTeam,
-			Weapon:     e.Weapon.Type.String(),
-		}
-
-		for i := 0; i < match.FrameRateRounded*killfeedLifetime; i++ {
-			kills, ok := match.Killfeed[frame+i]
-			if ok {
-				if len(kills) > 5 {
-					match.Killfeed[frame+i] = match.Killfeed[frame+i][1:]
-				}
-				match.Killfeed[frame+i] = append(kills, kill)
-			} else {
-				match.Killfeed[frame+i] = []ocom.Kill{kill}
-			}
-		}
+		weaponFireEventHandler(match.frame(), parser.GameState().IngameTick(), e, match)
 	})
+	registerKillHandlers(parser, match)
+	registerDamageHandlers(parser, match)
+	registerBombHandlers(parser, match)
+	registerGrenadeHandlers(parser, match)
+	registerFlashHandlers(parser, match)
+	expireUtility := registerUtilityHandlers(parser, match)
 	parser.RegisterEventHandler(func(e event.RoundStart) {
 		match.currentPhase = ocom.PhaseFreezetime
 		match.latestTimerEventTime = parser.CurrentTime()
@@ -199,20 +205,46 @@ func NewMatch(demoFileName string, fallbackFrameRate, fallbackTickRate float64)
 		match.latestTimerEventTime = parser.CurrentTime()
 	})
 	parser.RegisterEventHandler(func(event.AnnouncementWinPanelMatch) {
-		match.HalfStarts = append(match.HalfStarts, parser.CurrentFrame())
+		match.HalfStarts = append(match.HalfStarts, match.frame())
 	})
 
-	playbackFrames := parser.Header().PlaybackFrames
-	states := make([]ocom.OverviewState, 0, playbackFrames)
-	frameCount = 0
+	started := false
+	sampleInterval := time.Duration(float64(time.Second) / match.FrameRate)
+	var nextSample time.Duration
+	// the last parsed frame was kept
+	kept := true
+	frameCount := 0
+	lastPercent := -1
+	parseStart := time.Now()
 	for ok, err := parser.ParseNextFrame(); ok; ok, err = parser.ParseNextFrame() {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, &CanceledError{
+				Frame: frameCount,
+				Err:   ctxErr,
+			}
+		}
 		if err != nil {
 			log.Println(err)
 			// return here or not?
 			continue
 		}
 		frameCount++
-		Progress = (frameCount / (float64(TotalFrames) / 100))
+		if opts.Progress != nil && match.TotalFrames > 0 {
+			if percent := frameCount * 100 / match.TotalFrames; percent != lastPercent {
+				lastPercent = percent
+				current := Progress{
+					Frame:       frameCount,
+					TotalFrames: match.TotalFrames,
+					Round:       parser.GameState().TotalRoundsPlayed() + 1,
+					Elapsed:     time.Since(parseStart),
+				}
+				current.ETA = current.estimateRemaining()
+				select {
+				case opts.Progress <- current:
+				default:
+				}
+			}
+		}
 
 		gameState := parser.GameState()
 		if !started {
@@ -220,159 +252,74 @@ func NewMatch(demoFileName string, fallbackFrameRate, fallbackTickRate float64)
 			ctScore := gameState.TeamCounterTerrorists().Score()
 			tScore := gameState.TeamTerrorists().Score()
 			if ctScore > 0 || tScore > 0 {
-				removeTeamTag(gameState.Participants().Playing())
+				match.setTeamTags(gameState.Participants().Playing())
 				started = true
 			}
 		}
 
-		playersInfo := make([]ocom.Player, 0, 10)
-
-		for _, p := range gameState.Participants().Playing() {
-			equipment := make(map[int]*common.Equipment)
-
-			for k := range p.Inventory {
-				eq := *p.Inventory[k]
-				equipment[k] = &eq
-			}
-			player := *p
-			player.Inventory = equipment
-
-			info := &ocom.Player{
-				Player:         player,
-				Health:         player.Health(),
-				ViewDirectionX: player.ViewDirectionX(),
-				Money:          player.Money(),
-				Kills:          player.Kills(),
-				Deaths:         player.Deaths(),
-				Assists:        player.Assists(),
-				Armor:          player.Armor(),
-				Helmet:         player.HasHelmet(),
-				Kit:            player.HasDefuseKit(),
-				ActiveWeapon:   player.ActiveWeapon(),
-				FlashRemaining: player.FlashDurationTimeRemaining(),
-				ClanName:       player.TeamState.ClanName(),
-			}
-
-			playersInfo = append(playersInfo, *info)
-		}
-
-		grenades := make([]common.GrenadeProjectile, 0)
-
-		for _, grenade := range gameState.GrenadeProjectiles() {
-			grenades = append(grenades, *grenade)
-		}
-
-		infernos := make([]common.Inferno, 0)
-
-		for _, inferno := range gameState.Infernos() {
-			infernos = append(infernos, *inferno)
-		}
-
-		bomb := *gameState.Bomb()
-		ts := *gameState.TeamTerrorists()
-		cts := *gameState.TeamCounterTerrorists()
-
-		ct := ocom.Team{
-			TeamState: cts,
-			Score:     cts.Score(),
-			ClanName:  cts.ClanName(),
-		}
-		t := ocom.Team{
-			TeamState: ts,
-			Score:     ts.Score(),
-			ClanName:  ts.ClanName(),
-		}
+		match.recordTrajectories(match.frame(), gameState.GrenadeProjectiles())
 
-		var timer ocom.Timer
-
-		if gameState.IsWarmupPeriod() {
-			timer = ocom.Timer{
-				TimeRemaining: 0,
-				Phase:         ocom.PhaseWarmup,
+		if sampling {
+			now := parser.CurrentTime()
+			kept = now >= nextSample
+			if !kept {
+				continue
 			}
-		} else {
-			switch match.currentPhase {
-			case ocom.PhaseFreezetime:
-				freezetime, _ := strconv.Atoi(gameState.ConVars()["mp_freezetime"])
-				remaining := time.Duration(freezetime)*time.Second - (parser.CurrentTime() - match.latestTimerEventTime)
-				timer = ocom.Timer{
-					TimeRemaining: remaining,
-					Phase:         ocom.PhaseFreezetime,
-				}
-			case ocom.PhaseRegular:
-				round := 115
-
-				//roundtime, _ := strconv.ParseFloat(gameState.ConVars()["mp_roundtime_defuse"], 64)
-				remaining := (time.Duration(round)*time.Second - (parser.CurrentTime() - match.latestTimerEventTime))
-				timer = ocom.Timer{
-					TimeRemaining: remaining,
-					Phase:         ocom.PhaseRegular,
-				}
-			case ocom.PhasePlanted:
-				// mp_c4timer is not set in testdemo
-				//bombtime, _ := strconv.Atoi(gameState.ConVars()["mp_c4timer"])
-				bombtime := c4timer
-				remaining := time.Duration(bombtime)*time.Second - (parser.CurrentTime() - match.latestTimerEventTime)
-				timer = ocom.Timer{
-					TimeRemaining: remaining,
-					Phase:         ocom.PhasePlanted,
-				}
-			case ocom.PhaseRestart:
-				restartDelay, _ := strconv.Atoi(gameState.ConVars()["mp_round_restart_delay"])
-				remaining := time.Duration(restartDelay)*time.Second - (parser.CurrentTime() - match.latestTimerEventTime)
-				timer = ocom.Timer{
-					TimeRemaining: remaining,
-					Phase:         ocom.PhaseRestart,
-				}
-			case ocom.PhaseHalftime:
-				halftimeDuration, _ := strconv.Atoi(gameState.ConVars()["mp_halftime_duration"])
-				remaining := time.Duration(halftimeDuration)*time.Second - (parser.CurrentTime() - match.latestTimerEventTime)
-				timer = ocom.Timer{
-					TimeRemaining: remaining,
-					Phase:         ocom.PhaseRestart,
-				}
+			nextSample += sampleInterval
+			if nextSample <= now {
+				nextSample = now + sampleInterval
 			}
 		}
-
-		state := ocom.OverviewState{
-			IngameTick:            parser.GameState().IngameTick(),
-			Players:               playersInfo,
-			Grenades:              grenades,
-			Infernos:              infernos,
-			Bomb:                  bomb,
-			TeamCounterTerrorists: ct,
-			TeamTerrorists:        t,
-			Timer:                 timer,
-		}
-
-		states = append(states, state)
+		states.add(gameState, match.timer(parser))
+	}
+	// events after the last kept frame belong to the end of the demo
+	if !kept {
+		states.add(parser.GameState(), match.timer(parser))
 	}
 
-	match.States = states
+	expireUtility(match.frame())
+	match.TotalFrames = match.States.Len()
+	match.buildIndexes()
 	return match, nil
 }
 
-func grenadeEventHandler(lifetime int, frame int, e event.GrenadeEvent, match *Match) {
-	for i := 0; i < lifetime; i++ {
-		if match.currentPhase == ocom.PhaseFreezetime || match.currentPhase == ocom.PhaseRestart {
-			break
-		}
-		effect := ocom.GrenadeEffect{
-			GrenadeEvent: e,
-			Lifetime:     i,
-		}
-		effects, ok := match.GrenadeEffects[frame+i]
-		if ok {
+// frame returns the index of the state that is kept next. All events that
+// happen until then belong to that state.
+func (m *Match) frame() int {
+	return m.States.Len()
+}
 
-			match.GrenadeEffects[frame+i] = append(effects, effect)
-		} else {
-			match.GrenadeEffects[frame+i] = []ocom.GrenadeEffect{effect}
+// timer returns the timer of the current phase of the round.
+func (m *Match) timer(parser dem.Parser) ocom.Timer {
+	if parser.GameState().IsWarmupPeriod() {
+		return ocom.Timer{
+			TimeRemaining: 0,
+			Phase:         ocom.PhaseWarmup,
 		}
 	}
+	phase := m.currentPhase
+	remaining := m.rules.PhaseDuration(phase) - (parser.CurrentTime() - m.latestTimerEventTime)
+	// the halftime break is displayed like the break between rounds
+	if phase == ocom.PhaseHalftime {
+		phase = ocom.PhaseRestart
+	}
+	return ocom.Timer{
+		TimeRemaining: remaining,
+		Phase:         phase,
+	}
+}
 
+// grenadeEventHandler adds the effect of the grenade event that is visible
+// from start up to end.
+func grenadeEventHandler(start, end int, e event.GrenadeEvent, match *Match) {
+	match.GrenadeEffects = append(match.GrenadeEffects, ocom.GrenadeEffect{
+		GrenadeEvent: snapshotGrenadeEvent(e),
+		StartFrame:   start,
+		EndFrame:     end,
+	})
 }
 
-func weaponFireEventHandler(frame int, e event.WeaponFire, match *Match) {
+func weaponFireEventHandler(frame, tick int, e event.WeaponFire, match *Match) {
 	if e.Shooter == nil {
 		return
 	}
@@ -383,29 +330,24 @@ func weaponFireEventHandler(frame int, e event.WeaponFire, match *Match) {
 	}
 	isAwpShot := e.Weapon.Type == common.EqAWP
 	shot := ocom.Shot{
+		Tick:           tick,
 		Position:       e.Shooter.LastAlivePosition,
 		ViewDirectionX: e.Shooter.ViewDirectionX(),
 		IsAwpShot:      isAwpShot,
 	}
 
-	lifetime := int((match.FrameRate + 1) / 32)
-	if lifetime == 0 {
-		lifetime = 1
-	}
+	lifetime := shotDuration
 	if isAwpShot {
-		lifetime = int((match.FrameRate + 1) / 8)
-	}
-	for i := 0; i < lifetime; i++ {
-		shots, ok := match.Shots[frame+i]
-		if ok {
-			match.Shots[frame+i] = append(shots, shot)
-		} else {
-			match.Shots[frame+i] = []ocom.Shot{shot}
-		}
+		lifetime = awpShotDuration
 	}
+	shot.StartFrame = frame
+	shot.EndFrame = frame + match.durationToFrames(lifetime)
+	match.Shots = append(match.Shots, shot)
 }
 
-func removeTeamTag(players []*common.Player) {
+// setTeamTags detects the clan tags which the players of each team put in
+// front of their names.
+func (m *Match) setTeamTags(players []*common.Player) {
 	tNames := make([]string, 0)
 	searchT := make([]string, 0)
 	ctNames := make([]string, 0)
@@ -418,14 +360,14 @@ func removeTeamTag(players []*common.Player) {
 		if p.Team == common.TeamTerrorists {
 			tNames = append(tNames, p.Name)
 			if !team1 {
-				teamOne.ClanName = p.TeamState.ClanName()
+				m.TeamOne.ClanName = p.TeamState.ClanName()
 				team1 = true
 			}
 		}
 		if p.Team == common.TeamCounterTerrorists {
 			ctNames = append(ctNames, p.Name)
 			if !team2 {
-				teamTwo.ClanName = p.TeamState.ClanName()
+				m.TeamTwo.ClanName = p.TeamState.ClanName()
 				team2 = true
 			}
 		}
@@ -441,7 +383,7 @@ func removeTeamTag(players []*common.Player) {
 	for index, ch := range tNames[0] {
 		searchT = append(searchT, string(ch))
 		if !strings.HasPrefix(tNames[len(tNames)-1], strings.Join(searchT, "")) {
-			teamOne.Tag = strings.Join(searchT[:index], "")
+			m.TeamOne.Tag = strings.Join(searchT[:index], "")
 			break
 
 		}
@@ -451,7 +393,7 @@ func removeTeamTag(players []*common.Player) {
 		searchCt = append(searchCt, string(ch))
 		if !strings.HasPrefix(ctNames[len(ctNames)-1], strings.Join(searchCt, "")) {
 
-			teamTwo.Tag = strings.Join(searchCt[:index], "")
+			m.TeamTwo.Tag = strings.Join(searchCt[:index], "")
 			break
 		}
 	}
@@ -459,11 +401,7 @@ func removeTeamTag(players []*common.Player) {
 }
 
 // GetTeamTags returns two Clan structs - providing the team name and tag for each team - ordered by first team on T-Side, then first team on Ct-Side
-func GetTeamTags() (ocom.Clan, ocom.Clan) {
-	return teamOne, teamTwo
+func (m *Match) GetTeamTags() (ocom.Clan, ocom.Clan) {
+	return m.TeamOne, m.TeamTwo
 
 }
-
-/* func marshalJSON(r rep.Replay, w io.Writer) error {
-	return json.NewEncoder(w).Encode(r)
-} */
@@ -0,0 +1,87 @@
+package match
+
+import (
+	"fmt"
+	"time"
+)
+
+// Options control how a demo is parsed.
+type Options struct {
+	// FallbackFrameRate and FallbackTickRate are used in case the values
+	// cannot be parsed from the demo. If they are not set, they must be -1.
+	FallbackFrameRate float64
+	FallbackTickRate  float64
+
+	// CacheDir is the directory parsed matches are kept in. If a valid cache
+	// file for the content of the demo and the other options exists, it is
+	// loaded instead of parsing the demo. If CacheDir is empty, the cache is
+	// not used.
+	CacheDir string
+
+	// StatesPerSecond limits how many states are kept per second of the demo.
+	// Frames in between are parsed but their states are dropped. Events
+	// keep their exact tick and are assigned to the next kept state, and
+	// FrameRate is lowered to the sampling rate. If StatesPerSecond is 0 or
+	// not below the frame rate of the demo, the state of every frame is kept.
+	StatesPerSecond float64
+
+	// Progress receives the parsing progress whenever another percent of the
+	// demo has been parsed. Sends never block, so updates are dropped if the
+	// receiver is busy. Progress is closed when parsing returns.
+	Progress chan<- Progress
+}
+
+// DefaultOptions contains standard options for parsing a demo.
+var DefaultOptions = Options{
+	FallbackFrameRate: -1,
+	FallbackTickRate:  -1,
+}
+
+// Progress describes how far the parsing of a demo has advanced.
+type Progress struct {
+	// Frame is the number of frames parsed so far.
+	Frame int
+	// TotalFrames is the number of frames in the demo according to its header.
+	TotalFrames int
+	// Round is the round that is currently being parsed.
+	Round int
+	// Elapsed is the time spent parsing so far.
+	Elapsed time.Duration
+	// ETA is the estimated time until parsing is done.
+	ETA time.Duration
+}
+
+// Percent returns the percentage of frames parsed.
+func (p Progress) Percent() float64 {
+	if p.TotalFrames <= 0 {
+		return 0
+	}
+	return float64(p.Frame) * 100 / float64(p.TotalFrames)
+}
+
+func (p Progress) estimateRemaining() time.Duration {
+	if p.Frame <= 0 || p.Frame >= p.TotalFrames {
+		return 0
+	}
+	perFrame := p.Elapsed / time.Duration(p.Frame)
+	return perFrame * time.Duration(p.TotalFrames-p.Frame)
+}
+
+// CanceledError is returned when parsing stopped because its context was
+// canceled or its deadline exceeded.
+type CanceledError struct {
+	// Frame is the number of frames parsed before parsing stopped.
+	Frame int
+	// Err is the error of the context.
+	Err error
+}
+
+func (e *CanceledError) Error() string {
+	return fmt.Sprintf("parsing canceled after %d frames: %v", e.Frame, e.Err)
+}
+
+// Unwrap returns the error of the context, so errors.Is can be used to tell
+// a cancellation from an exceeded deadline.
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,165 @@
+package match
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// maxContainerDepth limits how many containers may be nested around a demo,
+// e.g. a gzipped demo inside a zip archive.
+const maxContainerDepth = 3
+
+var (
+	magicGzip  = []byte{0x1f, 0x8b}
+	magicBzip2 = []byte("BZh")
+	magicZip   = []byte("PK\x03\x04")
+)
+
+// ErrNoDemoInArchive is returned if a zip archive does not contain a .dem file.
+var ErrNoDemoInArchive = errors.New("no .dem file in zip archive")
+
+// NewMatchReader parses the demo read from r like NewMatchContext.
+// The demo may be compressed with gzip or bzip2 or be stored in a zip
+// archive, see OpenDemo. opts.CacheDir is ignored, as the content of r is
+// not known before it has been parsed.
+func NewMatchReader(ctx context.Context, r io.Reader, opts Options) (*Match, error) {
+	if opts.Progress != nil {
+		defer close(opts.Progress)
+	}
+
+	demo, err := OpenDemo(r)
+	if err != nil {
+		return nil, err
+	}
+	defer demo.Close()
+
+	return parseDemo(ctx, demo, opts)
+}
+
+// OpenDemo returns a reader for the uncompressed demo contained in r.
+// gzip and bzip2 streams are decompressed and the first .dem file of a zip
+// archive is extracted, anything else is returned as is. Zip archives are
+// read into memory unless r is an *os.File of a regular file.
+// Closing the returned reader does not close r.
+func OpenDemo(r io.Reader) (io.ReadCloser, error) {
+	var demo io.ReadCloser = ioutil.NopCloser(r)
+	for i := 0; i < maxContainerDepth; i++ {
+		br := bufio.NewReader(demo)
+		magic, err := br.Peek(len(magicZip))
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			demo.Close()
+			return nil, err
+		}
+
+		var inner io.ReadCloser
+		switch {
+		case bytes.HasPrefix(magic, magicGzip):
+			inner, err = gzip.NewReader(br)
+		case bytes.HasPrefix(magic, magicBzip2):
+			inner = ioutil.NopCloser(bzip2.NewReader(br))
+		case bytes.HasPrefix(magic, magicZip):
+			// zip archives can't be streamed, read them from the file if
+			// possible and the buffered content otherwise
+			file, isFile := regularFile(r)
+			if i == 0 && isFile {
+				inner, err = openZipFile(file)
+			} else {
+				inner, err = openZipReader(br)
+			}
+		default:
+			return closerFunc{Reader: br, close: demo.Close}, nil
+		}
+		if err != nil {
+			demo.Close()
+			return nil, err
+		}
+		demo = chainCloser(inner, demo)
+	}
+	return demo, nil
+}
+
+// regularFile returns r if it is a regular file. Pipes like os.Stdin have no
+// size and can't be read at random offsets.
+func regularFile(r io.Reader) (*os.File, bool) {
+	file, ok := r.(*os.File)
+	if !ok {
+		return nil, false
+	}
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, false
+	}
+	return file, true
+}
+
+func openZipFile(file *os.File) (io.ReadCloser, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	archive, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		return nil, err
+	}
+	return openDemoInZip(archive)
+}
+
+func openZipReader(r io.Reader) (io.ReadCloser, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, err
+	}
+	return openDemoInZip(archive)
+}
+
+// openDemoInZip opens the first file of the archive that looks like a
+// (possibly compressed) demo.
+func openDemoInZip(archive *zip.Reader) (io.ReadCloser, error) {
+	for _, f := range archive.File {
+		name := strings.ToLower(path.Base(f.Name))
+		if strings.HasSuffix(name, ".dem") ||
+			strings.HasSuffix(name, ".dem.gz") ||
+			strings.HasSuffix(name, ".dem.bz2") {
+			return f.Open()
+		}
+	}
+	return nil, ErrNoDemoInArchive
+}
+
+// closerFunc combines a reader with a custom close function.
+type closerFunc struct {
+	io.Reader
+	close func() error
+}
+
+func (c closerFunc) Close() error {
+	return c.close()
+}
+
+// chainCloser returns inner with a Close method that closes inner and outer.
+func chainCloser(inner, outer io.ReadCloser) io.ReadCloser {
+	return closerFunc{
+		Reader: inner,
+		close: func() error {
+			err := inner.Close()
+			if outerErr := outer.Close(); err == nil {
+				err = outerErr
+			}
+			return err
+		},
+	}
+}
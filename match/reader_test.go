@@ -0,0 +1,131 @@
+package match
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var demoContent = []byte("HL2DEMO\x00 not really a demo")
+
+func zipped(t *testing.T, name string, content []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(content)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func gzipped(t *testing.T, content []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(content)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestOpenDemo(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{"plain", demoContent},
+		{"gzip", gzipped(t, demoContent)},
+		{"zip", zipped(t, "match/demo.dem", demoContent)},
+		{"gzip in zip", zipped(t, "demo.dem.gz", gzipped(t, demoContent))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			demo, err := OpenDemo(bytes.NewReader(test.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer demo.Close()
+			got, err := ioutil.ReadAll(demo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, demoContent) {
+				t.Errorf("got %q, want %q", got, demoContent)
+			}
+		})
+	}
+}
+
+func TestOpenDemoZipFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dem-replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "demo.zip")
+	if err := ioutil.WriteFile(name, zipped(t, "demo.dem", demoContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	demo, err := OpenDemo(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer demo.Close()
+	got, err := ioutil.ReadAll(demo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, demoContent) {
+		t.Errorf("got %q, want %q", got, demoContent)
+	}
+}
+
+// TestOpenDemoZipPipe reads a zip archive from a pipe like os.Stdin, which
+// is an *os.File without a size.
+func TestOpenDemoZipPipe(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	go func() {
+		w.Write(zipped(t, "demo.dem", demoContent))
+		w.Close()
+	}()
+
+	demo, err := OpenDemo(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer demo.Close()
+	got, err := ioutil.ReadAll(demo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, demoContent) {
+		t.Errorf("got %q, want %q", got, demoContent)
+	}
+}
+
+func TestOpenDemoNoDemoInZip(t *testing.T) {
+	_, err := OpenDemo(bytes.NewReader(zipped(t, "readme.txt", demoContent)))
+	if err != ErrNoDemoInArchive {
+		t.Errorf("got error %v, want %v", err, ErrNoDemoInArchive)
+	}
+}
@@ -0,0 +1,117 @@
+package match
+
+import (
+	"sort"
+
+	ocom "github.com/lwayneh/dem-replay/common"
+	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	event "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+)
+
+// RoundAt returns the round that is being played at the specified frame, or
+// nil if the frame is before the first round.
+func (m *Match) RoundAt(frame int) *ocom.Round {
+	i := m.RoundIndexAt(frame)
+	if i == -1 {
+		return nil
+	}
+	return &m.Rounds[i]
+}
+
+// RoundFrames returns the first and last frame of the round with the number.
+// ok is false if there is no such round.
+func (m *Match) RoundFrames(number int) (start, end int, ok bool) {
+	for i, round := range m.Rounds {
+		if round.Number == number {
+			return round.StartFrame, m.roundEnd(i), true
+		}
+	}
+	return 0, 0, false
+}
+
+// RoundIndexAt returns the index in Rounds of the round that is being played
+// at the specified frame, or -1 if the frame is before the first round.
+func (m *Match) RoundIndexAt(frame int) int {
+	return sort.Search(len(m.Rounds), func(i int) bool {
+		return m.Rounds[i].StartFrame > frame
+	}) - 1
+}
+
+// currentRound returns the round that is being parsed, or nil before the
+// first round started.
+func (m *Match) currentRound() *ocom.Round {
+	if len(m.Rounds) == 0 {
+		return nil
+	}
+	return &m.Rounds[len(m.Rounds)-1]
+}
+
+func registerRoundHandlers(parser dem.Parser, match *Match) {
+	parser.RegisterEventHandler(func(event.RoundStart) {
+		match.Rounds = append(match.Rounds, ocom.Round{
+			Number:           parser.GameState().TotalRoundsPlayed() + 1,
+			StartFrame:       match.frame(),
+			FreezeEndFrame:   -1,
+			PlantFrame:       -1,
+			EndFrame:         -1,
+			OfficialEndFrame: -1,
+		})
+	})
+	parser.RegisterEventHandler(func(event.RoundFreezetimeEnd) {
+		round := match.currentRound()
+		if round == nil {
+			return
+		}
+		round.FreezeEndFrame = match.frame()
+		round.EquipmentValueCT = parser.GameState().TeamCounterTerrorists().CurrentEquipmentValue()
+		round.EquipmentValueT = parser.GameState().TeamTerrorists().CurrentEquipmentValue()
+	})
+	parser.RegisterEventHandler(func(event.BombPlanted) {
+		if round := match.currentRound(); round != nil {
+			round.PlantFrame = match.frame()
+		}
+	})
+	parser.RegisterEventHandler(func(e event.RoundEnd) {
+		round := match.currentRound()
+		if round == nil {
+			return
+		}
+		round.EndFrame = match.frame()
+		round.Winner = e.Winner
+		round.EndReason = roundEndReason(e.Reason)
+		round.ScoreCT = parser.GameState().TeamCounterTerrorists().Score()
+		round.ScoreT = parser.GameState().TeamTerrorists().Score()
+	})
+	// the scores are usually updated after the end of the round
+	parser.RegisterEventHandler(func(event.ScoreUpdated) {
+		round := match.currentRound()
+		if round == nil || round.EndFrame == -1 {
+			return
+		}
+		round.ScoreCT = parser.GameState().TeamCounterTerrorists().Score()
+		round.ScoreT = parser.GameState().TeamTerrorists().Score()
+	})
+	parser.RegisterEventHandler(func(event.RoundEndOfficial) {
+		if round := match.currentRound(); round != nil {
+			round.OfficialEndFrame = match.frame()
+		}
+	})
+}
+
+func roundEndReason(reason event.RoundEndReason) ocom.RoundEndReason {
+	switch reason {
+	case event.RoundEndReasonCTWin, event.RoundEndReasonTerroristsWin:
+		return ocom.RoundEndReasonElimination
+	case event.RoundEndReasonTargetBombed:
+		return ocom.RoundEndReasonBombExploded
+	case event.RoundEndReasonBombDefused:
+		return ocom.RoundEndReasonBombDefused
+	case event.RoundEndReasonTargetSaved:
+		return ocom.RoundEndReasonTimeExpired
+	case event.RoundEndReasonTerroristsSurrender, event.RoundEndReasonCTSurrender:
+		return ocom.RoundEndReasonSurrender
+	case event.RoundEndReasonDraw:
+		return ocom.RoundEndReasonDraw
+	}
+	return ocom.RoundEndReasonOther
+}
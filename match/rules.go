@@ -0,0 +1,162 @@
+package match
+
+import (
+	"strconv"
+	"time"
+
+	ocom "github.com/lwayneh/dem-replay/common"
+)
+
+// GameMode corresponds to the game mode a demo was recorded in.
+type GameMode int
+
+// Possible values for GameMode type.
+const (
+	GameModeCompetitive GameMode = iota
+	GameModeCasual
+	GameModeWingman
+	GameModeArmsRace
+	GameModeDemolition
+	GameModeDeathmatch
+)
+
+// GameRules contains the durations of all timers of a round.
+type GameRules struct {
+	Mode              GameMode
+	FreezeTime        time.Duration
+	RoundTime         time.Duration
+	BombTime          time.Duration
+	RoundRestartDelay time.Duration
+	HalftimeDuration  time.Duration
+}
+
+// defaultRules contains the values of the official config of each game mode.
+var defaultRules = map[GameMode]GameRules{
+	GameModeCompetitive: {
+		Mode:              GameModeCompetitive,
+		FreezeTime:        15 * time.Second,
+		RoundTime:         115 * time.Second,
+		BombTime:          40 * time.Second,
+		RoundRestartDelay: 7 * time.Second,
+		HalftimeDuration:  15 * time.Second,
+	},
+	GameModeCasual: {
+		Mode:              GameModeCasual,
+		FreezeTime:        6 * time.Second,
+		RoundTime:         135 * time.Second,
+		BombTime:          40 * time.Second,
+		RoundRestartDelay: 7 * time.Second,
+		HalftimeDuration:  15 * time.Second,
+	},
+	GameModeWingman: {
+		Mode:              GameModeWingman,
+		FreezeTime:        10 * time.Second,
+		RoundTime:         90 * time.Second,
+		BombTime:          40 * time.Second,
+		RoundRestartDelay: 5 * time.Second,
+		HalftimeDuration:  15 * time.Second,
+	},
+	GameModeArmsRace: {
+		Mode:              GameModeArmsRace,
+		FreezeTime:        3 * time.Second,
+		RoundTime:         10 * time.Minute,
+		BombTime:          40 * time.Second,
+		RoundRestartDelay: 7 * time.Second,
+	},
+	GameModeDemolition: {
+		Mode:              GameModeDemolition,
+		FreezeTime:        3 * time.Second,
+		RoundTime:         90 * time.Second,
+		BombTime:          30 * time.Second,
+		RoundRestartDelay: 5 * time.Second,
+		HalftimeDuration:  15 * time.Second,
+	},
+	GameModeDeathmatch: {
+		Mode:              GameModeDeathmatch,
+		RoundTime:         10 * time.Minute,
+		BombTime:          40 * time.Second,
+		RoundRestartDelay: 7 * time.Second,
+	},
+}
+
+// NewGameRules resolves the game rules from the convars of a server.
+// Timers that are not set by a convar keep the default of the game mode set by
+// game_type and game_mode. Unknown game modes are treated as competitive.
+func NewGameRules(conVars map[string]string) GameRules {
+	rules := defaultRules[gameModeOf(conVars)]
+
+	if seconds, ok := conVarFloat(conVars, "mp_freezetime"); ok {
+		rules.FreezeTime = secondsToDuration(seconds)
+	}
+	// the game truncates the round time to full seconds
+	if minutes, ok := conVarFloat(conVars, "mp_roundtime_defuse"); ok && minutes > 0 {
+		rules.RoundTime = time.Duration(int(minutes*60)) * time.Second
+	} else if minutes, ok := conVarFloat(conVars, "mp_roundtime"); ok && minutes > 0 {
+		rules.RoundTime = time.Duration(int(minutes*60)) * time.Second
+	}
+	if seconds, ok := conVarFloat(conVars, "mp_c4timer"); ok && seconds > 0 {
+		rules.BombTime = secondsToDuration(seconds)
+	}
+	if seconds, ok := conVarFloat(conVars, "mp_round_restart_delay"); ok {
+		rules.RoundRestartDelay = secondsToDuration(seconds)
+	}
+	if seconds, ok := conVarFloat(conVars, "mp_halftime_duration"); ok {
+		rules.HalftimeDuration = secondsToDuration(seconds)
+	}
+	return rules
+}
+
+// PhaseDuration returns how long the timer runs in the given phase.
+func (r GameRules) PhaseDuration(phase ocom.Phase) time.Duration {
+	switch phase {
+	case ocom.PhaseFreezetime:
+		return r.FreezeTime
+	case ocom.PhaseRegular:
+		return r.RoundTime
+	case ocom.PhasePlanted:
+		return r.BombTime
+	case ocom.PhaseRestart:
+		return r.RoundRestartDelay
+	case ocom.PhaseHalftime:
+		return r.HalftimeDuration
+	}
+	return 0
+}
+
+func gameModeOf(conVars map[string]string) GameMode {
+	gameType, _ := strconv.Atoi(conVars["game_type"])
+	gameMode, _ := strconv.Atoi(conVars["game_mode"])
+
+	switch {
+	case gameType == 0 && gameMode == 0:
+		if _, ok := conVars["game_mode"]; !ok {
+			return GameModeCompetitive
+		}
+		return GameModeCasual
+	case gameType == 0 && gameMode == 2:
+		return GameModeWingman
+	case gameType == 1 && gameMode == 0:
+		return GameModeArmsRace
+	case gameType == 1 && gameMode == 1:
+		return GameModeDemolition
+	case gameType == 1 && gameMode == 2:
+		return GameModeDeathmatch
+	}
+	return GameModeCompetitive
+}
+
+func conVarFloat(conVars map[string]string, name string) (float64, bool) {
+	value, ok := conVars[name]
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false
+	}
+	return f, true
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,138 @@
+package match
+
+import (
+	"testing"
+	"time"
+
+	ocom "github.com/lwayneh/dem-replay/common"
+)
+
+func TestNewGameRulesModes(t *testing.T) {
+	tests := []struct {
+		name     string
+		conVars  map[string]string
+		mode     GameMode
+		freeze   time.Duration
+		round    time.Duration
+		bomb     time.Duration
+		restart  time.Duration
+		halftime time.Duration
+	}{
+		{
+			name:    "competitive",
+			conVars: map[string]string{"game_type": "0", "game_mode": "1"},
+			mode:    GameModeCompetitive,
+			freeze:  15 * time.Second, round: 115 * time.Second, bomb: 40 * time.Second,
+			restart: 7 * time.Second, halftime: 15 * time.Second,
+		},
+		{
+			name:    "casual",
+			conVars: map[string]string{"game_type": "0", "game_mode": "0"},
+			mode:    GameModeCasual,
+			freeze:  6 * time.Second, round: 135 * time.Second, bomb: 40 * time.Second,
+			restart: 7 * time.Second, halftime: 15 * time.Second,
+		},
+		{
+			name:    "wingman",
+			conVars: map[string]string{"game_type": "0", "game_mode": "2"},
+			mode:    GameModeWingman,
+			freeze:  10 * time.Second, round: 90 * time.Second, bomb: 40 * time.Second,
+			restart: 5 * time.Second, halftime: 15 * time.Second,
+		},
+		{
+			name:    "arms race",
+			conVars: map[string]string{"game_type": "1", "game_mode": "0"},
+			mode:    GameModeArmsRace,
+			freeze:  3 * time.Second, round: 10 * time.Minute, bomb: 40 * time.Second,
+			restart: 7 * time.Second,
+		},
+		{
+			name:    "demolition",
+			conVars: map[string]string{"game_type": "1", "game_mode": "1"},
+			mode:    GameModeDemolition,
+			freeze:  3 * time.Second, round: 90 * time.Second, bomb: 30 * time.Second,
+			restart: 5 * time.Second, halftime: 15 * time.Second,
+		},
+		{
+			name:    "deathmatch",
+			conVars: map[string]string{"game_type": "1", "game_mode": "2"},
+			mode:    GameModeDeathmatch,
+			round:   10 * time.Minute, bomb: 40 * time.Second,
+			restart: 7 * time.Second,
+		},
+		{
+			name:    "no game mode",
+			conVars: map[string]string{},
+			mode:    GameModeCompetitive,
+			freeze:  15 * time.Second, round: 115 * time.Second, bomb: 40 * time.Second,
+			restart: 7 * time.Second, halftime: 15 * time.Second,
+		},
+		{
+			name:    "unknown game mode",
+			conVars: map[string]string{"game_type": "6", "game_mode": "0"},
+			mode:    GameModeCompetitive,
+			freeze:  15 * time.Second, round: 115 * time.Second, bomb: 40 * time.Second,
+			restart: 7 * time.Second, halftime: 15 * time.Second,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := NewGameRules(test.conVars)
+			want := GameRules{
+				Mode:              test.mode,
+				FreezeTime:        test.freeze,
+				RoundTime:         test.round,
+				BombTime:          test.bomb,
+				RoundRestartDelay: test.restart,
+				HalftimeDuration:  test.halftime,
+			}
+			if got != want {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestNewGameRulesConVars(t *testing.T) {
+	got := NewGameRules(map[string]string{
+		"game_type":              "1",
+		"game_mode":              "1",
+		"mp_freezetime":          "0.5",
+		"mp_roundtime":           "3",
+		"mp_roundtime_defuse":    "1.92",
+		"mp_c4timer":             "35",
+		"mp_round_restart_delay": "4",
+		"mp_halftime_duration":   "invalid",
+	})
+	want := GameRules{
+		Mode:              GameModeDemolition,
+		FreezeTime:        500 * time.Millisecond,
+		RoundTime:         115 * time.Second,
+		BombTime:          35 * time.Second,
+		RoundRestartDelay: 4 * time.Second,
+		HalftimeDuration:  15 * time.Second,
+	}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestGameRulesPhaseDuration(t *testing.T) {
+	rules := NewGameRules(nil)
+	tests := []struct {
+		phase ocom.Phase
+		want  time.Duration
+	}{
+		{ocom.PhaseFreezetime, rules.FreezeTime},
+		{ocom.PhaseRegular, rules.RoundTime},
+		{ocom.PhasePlanted, rules.BombTime},
+		{ocom.PhaseRestart, rules.RoundRestartDelay},
+		{ocom.PhaseHalftime, rules.HalftimeDuration},
+		{ocom.PhaseWarmup, 0},
+	}
+	for _, test := range tests {
+		if got := rules.PhaseDuration(test.phase); got != test.want {
+			t.Errorf("PhaseDuration(%v) = %v, want %v", test.phase, got, test.want)
+		}
+	}
+}
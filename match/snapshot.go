@@ -0,0 +1,69 @@
+package match
+
+import (
+	"sort"
+
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	event "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+)
+
+// The parser reuses and mutates its objects while it advances through the
+// demo. The snapshot functions copy everything that is needed for displaying
+// an event and drop all references to parser entities, so events stay valid
+// after parsing and can be written to the cache.
+
+func snapshotEquipment(e *common.Equipment) *common.Equipment {
+	if e == nil {
+		return nil
+	}
+	eq := *e
+	eq.Entity = nil
+	eq.Owner = nil
+	return &eq
+}
+
+// snapshotPlayer returns a detached copy of p together with the copy of its
+// active weapon.
+func snapshotPlayer(p *common.Player) (common.Player, *common.Equipment) {
+	active := p.ActiveWeapon()
+	var activeCopy *common.Equipment
+
+	equipment := make(map[int]*common.Equipment)
+	for k, e := range p.Inventory {
+		eq := snapshotEquipment(e)
+		equipment[k] = eq
+		if e == active {
+			activeCopy = eq
+		}
+	}
+
+	player := *p
+	player.Inventory = equipment
+	player.Entity = nil
+	player.TeamState = nil
+	return player, activeCopy
+}
+
+// grenadesOf returns one entry per grenade the player is carrying.
+func grenadesOf(p *common.Player) []common.EquipmentType {
+	grenades := make([]common.EquipmentType, 0)
+	for _, w := range p.Weapons() {
+		if w.Class() != common.EqClassGrenade {
+			continue
+		}
+		for i := 0; i < p.AmmoLeft[w.AmmoType()]; i++ {
+			grenades = append(grenades, w.Type)
+		}
+	}
+	sort.Slice(grenades, func(i, j int) bool { return grenades[i] < grenades[j] })
+	return grenades
+}
+
+func snapshotGrenadeEvent(e event.GrenadeEvent) event.GrenadeEvent {
+	e.Grenade = snapshotEquipment(e.Grenade)
+	if e.Thrower != nil {
+		thrower, _ := snapshotPlayer(e.Thrower)
+		e.Thrower = &thrower
+	}
+	return e
+}
@@ -0,0 +1,698 @@
+package match
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/geo/r2"
+	"github.com/golang/geo/r3"
+	ocom "github.com/lwayneh/dem-replay/common"
+	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+// keyFrameInterval is the maximum number of frames between two keyframes.
+// Rebuilding a state applies up to this many deltas.
+const keyFrameInterval = 64
+
+// Flags of a player row.
+const (
+	flagConnected uint8 = 1 << iota
+	flagHelmet
+	flagKit
+	flagDefusing
+	flagPlanting
+)
+
+// RosterEntry contains the data of a player that doesn't change from frame to
+// frame.
+type RosterEntry struct {
+	Name      string
+	SteamID64 uint64
+	UserID    int
+	IsBot     bool
+}
+
+// Loadout contains the equipment a player is carrying, sorted by type.
+type Loadout struct {
+	Weapons  []common.EquipmentType
+	Grenades []common.EquipmentType
+}
+
+// StateStore holds the states of all frames in a compact form.
+// Data that exists once per frame, players, grenade projectiles and infernos
+// are stored column by column. Players are delta encoded: keyframes contain
+// all players, the frames in between only the players that changed since the
+// previous frame. A keyframe is stored at least every keyFrameInterval frames
+// and whenever the set of players changes.
+// Names, loadouts and the areas of infernos are stored once and referenced by
+// their index.
+type StateStore struct {
+	KeyFrames []int32
+	Roster    []RosterEntry
+	Loadouts  []Loadout
+	Strings   []string
+	Hulls     [][]r2.Point
+
+	// one entry per frame
+	IngameTicks    []int32
+	TimerPhases    []uint8
+	TimerRemaining []int32 // milliseconds
+	ScoresCT       []int16
+	ScoresT        []int16
+	ClanNamesCT    []uint16 // index in Strings
+	ClanNamesT     []uint16 // index in Strings
+	BombCarriers   []int16  // index in Roster or -1
+	BombX          []float32
+	BombY          []float32
+	BombZ          []float32
+
+	// index of the first row of every frame, followed by the number of rows
+	PlayerStarts     []uint32
+	ProjectileStarts []uint32
+	InfernoStarts    []uint32
+
+	// player rows
+	PlayerRoster         []uint16 // index in Roster
+	PlayerTeams          []uint8
+	PlayerX              []float32
+	PlayerY              []float32
+	PlayerZ              []float32
+	PlayerViewX          []float32
+	PlayerViewY          []float32
+	PlayerHealth         []int16
+	PlayerArmor          []uint8
+	PlayerMoney          []int32
+	PlayerKills          []int16
+	PlayerDeaths         []int16
+	PlayerAssists        []int16
+	PlayerFlags          []uint8
+	PlayerFlashRemaining []uint16 // milliseconds
+	PlayerActiveWeapons  []uint16
+	PlayerLoadouts       []uint32 // index in Loadouts
+
+	// grenade projectile rows
+	ProjectileIDs   []int64
+	ProjectileTypes []uint16
+	ProjectileX     []float32
+	ProjectileY     []float32
+	ProjectileZ     []float32
+
+	// inferno rows
+	InfernoIDs   []int64
+	InfernoHulls []uint32 // index in Hulls
+
+	// the players of the last rebuilt frame, so playing forward only applies
+	// the deltas since then
+	cacheMu     sync.Mutex
+	cacheFrame  int
+	cachePlayer []playerRow
+}
+
+// playerRow is a single row of the player columns.
+type playerRow struct {
+	roster         int
+	team           common.Team
+	x, y, z        float32
+	viewX, viewY   float32
+	health         int
+	armor          int
+	money          int
+	kills          int
+	deaths         int
+	assists        int
+	flags          uint8
+	flashRemaining time.Duration
+	activeWeapon   common.EquipmentType
+	loadout        int
+}
+
+func newStateStore() *StateStore {
+	return &StateStore{
+		PlayerStarts:     []uint32{0},
+		ProjectileStarts: []uint32{0},
+		InfernoStarts:    []uint32{0},
+	}
+}
+
+// Len returns the number of frames in the store.
+func (s *StateStore) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.IngameTicks)
+}
+
+// State rebuilds the state of the specified frame. The state doesn't share
+// any memory with the store, callers may modify and keep it.
+func (s *StateStore) State(frame int) ocom.OverviewState {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	return s.state(frame)
+}
+
+// state rebuilds the state of the frame and leaves the rows of its players in
+// cachePlayer. The caller must hold cacheMu.
+func (s *StateStore) state(frame int) ocom.OverviewState {
+	ct := ocom.Team{
+		TeamState: common.NewTeamState(common.TeamCounterTerrorists, nil),
+		Score:     int(s.ScoresCT[frame]),
+		ClanName:  s.Strings[s.ClanNamesCT[frame]],
+	}
+	t := ocom.Team{
+		TeamState: common.NewTeamState(common.TeamTerrorists, nil),
+		Score:     int(s.ScoresT[frame]),
+		ClanName:  s.Strings[s.ClanNamesT[frame]],
+	}
+
+	rows := s.playerRows(frame)
+	players := make([]ocom.Player, len(rows))
+	for i, row := range rows {
+		players[i] = s.player(row)
+		switch row.team {
+		case common.TeamCounterTerrorists:
+			players[i].ClanName = ct.ClanName
+		case common.TeamTerrorists:
+			players[i].ClanName = t.ClanName
+		}
+	}
+
+	bomb := common.Bomb{
+		LastOnGroundPosition: r3.Vector{
+			X: float64(s.BombX[frame]),
+			Y: float64(s.BombY[frame]),
+			Z: float64(s.BombZ[frame]),
+		},
+	}
+	if carrier := int(s.BombCarriers[frame]); carrier != -1 {
+		for i := range players {
+			if rows[i].roster == carrier {
+				bomb.Carrier = &players[i].Player
+			}
+		}
+	}
+
+	grenades := make([]common.GrenadeProjectile, 0)
+	for i := s.ProjectileStarts[frame]; i < s.ProjectileStarts[frame+1]; i++ {
+		grenades = append(grenades, common.GrenadeProjectile{
+			WeaponInstance: common.NewEquipment(common.EquipmentType(s.ProjectileTypes[i])),
+			Trajectory: []r3.Vector{{
+				X: float64(s.ProjectileX[i]),
+				Y: float64(s.ProjectileY[i]),
+				Z: float64(s.ProjectileZ[i]),
+			}},
+		})
+	}
+
+	infernos := make([]ocom.Inferno, 0)
+	for i := s.InfernoStarts[frame]; i < s.InfernoStarts[frame+1]; i++ {
+		infernos = append(infernos, ocom.Inferno{
+			UniqueID:   s.InfernoIDs[i],
+			ConvexHull: append([]r2.Point(nil), s.Hulls[s.InfernoHulls[i]]...),
+		})
+	}
+
+	return ocom.OverviewState{
+		IngameTick:            int(s.IngameTicks[frame]),
+		Players:               players,
+		Grenades:              grenades,
+		Infernos:              infernos,
+		Bomb:                  bomb,
+		TeamCounterTerrorists: ct,
+		TeamTerrorists:        t,
+		Timer: ocom.Timer{
+			TimeRemaining: time.Duration(s.TimerRemaining[frame]) * time.Millisecond,
+			Phase:         ocom.Phase(s.TimerPhases[frame]),
+		},
+	}
+}
+
+// keyFrameOf returns the latest keyframe before or at the frame.
+func (s *StateStore) keyFrameOf(frame int) int {
+	i := sort.Search(len(s.KeyFrames), func(i int) bool {
+		return int(s.KeyFrames[i]) > frame
+	}) - 1
+	return int(s.KeyFrames[i])
+}
+
+// playerRows returns the rows of all players at the frame by applying the
+// deltas since the last keyframe. The caller must hold cacheMu.
+func (s *StateStore) playerRows(frame int) []playerRow {
+	keyFrame := s.keyFrameOf(frame)
+	var from int
+	var rows []playerRow
+	if s.cachePlayer != nil && s.cacheFrame <= frame && s.keyFrameOf(s.cacheFrame) == keyFrame {
+		rows = s.cachePlayer
+		from = s.cacheFrame + 1
+	} else {
+		rows = make([]playerRow, 0, 10)
+		for i := s.PlayerStarts[keyFrame]; i < s.PlayerStarts[keyFrame+1]; i++ {
+			rows = append(rows, s.playerRow(int(i)))
+		}
+		from = keyFrame + 1
+	}
+
+	for f := from; f <= frame; f++ {
+		for i := s.PlayerStarts[f]; i < s.PlayerStarts[f+1]; i++ {
+			row := s.playerRow(int(i))
+			for j := range rows {
+				if rows[j].roster == row.roster {
+					rows[j] = row
+				}
+			}
+		}
+	}
+
+	s.cacheFrame = frame
+	s.cachePlayer = rows
+	return append([]playerRow(nil), rows...)
+}
+
+func (s *StateStore) playerRow(i int) playerRow {
+	return playerRow{
+		roster:         int(s.PlayerRoster[i]),
+		team:           common.Team(s.PlayerTeams[i]),
+		x:              s.PlayerX[i],
+		y:              s.PlayerY[i],
+		z:              s.PlayerZ[i],
+		viewX:          s.PlayerViewX[i],
+		viewY:          s.PlayerViewY[i],
+		health:         int(s.PlayerHealth[i]),
+		armor:          int(s.PlayerArmor[i]),
+		money:          int(s.PlayerMoney[i]),
+		kills:          int(s.PlayerKills[i]),
+		deaths:         int(s.PlayerDeaths[i]),
+		assists:        int(s.PlayerAssists[i]),
+		flags:          s.PlayerFlags[i],
+		flashRemaining: time.Duration(s.PlayerFlashRemaining[i]) * time.Millisecond,
+		activeWeapon:   common.EquipmentType(s.PlayerActiveWeapons[i]),
+		loadout:        int(s.PlayerLoadouts[i]),
+	}
+}
+
+func (s *StateStore) appendPlayerRow(row playerRow) {
+	s.PlayerRoster = append(s.PlayerRoster, uint16(row.roster))
+	s.PlayerTeams = append(s.PlayerTeams, uint8(row.team))
+	s.PlayerX = append(s.PlayerX, row.x)
+	s.PlayerY = append(s.PlayerY, row.y)
+	s.PlayerZ = append(s.PlayerZ, row.z)
+	s.PlayerViewX = append(s.PlayerViewX, row.viewX)
+	s.PlayerViewY = append(s.PlayerViewY, row.viewY)
+	s.PlayerHealth = append(s.PlayerHealth, int16(row.health))
+	s.PlayerArmor = append(s.PlayerArmor, uint8(row.armor))
+	s.PlayerMoney = append(s.PlayerMoney, int32(row.money))
+	s.PlayerKills = append(s.PlayerKills, int16(row.kills))
+	s.PlayerDeaths = append(s.PlayerDeaths, int16(row.deaths))
+	s.PlayerAssists = append(s.PlayerAssists, int16(row.assists))
+	s.PlayerFlags = append(s.PlayerFlags, row.flags)
+	s.PlayerFlashRemaining = append(s.PlayerFlashRemaining, uint16(row.flashRemaining/time.Millisecond))
+	s.PlayerActiveWeapons = append(s.PlayerActiveWeapons, uint16(row.activeWeapon))
+	s.PlayerLoadouts = append(s.PlayerLoadouts, uint32(row.loadout))
+}
+
+// player rebuilds the player of the row. Its equipment only has a type.
+func (s *StateStore) player(row playerRow) ocom.Player {
+	entry := s.Roster[row.roster]
+	loadout := s.Loadouts[row.loadout]
+
+	var active *common.Equipment
+	inventory := make(map[int]*common.Equipment, len(loadout.Weapons))
+	for i, weapon := range loadout.Weapons {
+		eq := common.NewEquipment(weapon)
+		inventory[i] = eq
+		if weapon == row.activeWeapon && active == nil {
+			active = eq
+		}
+	}
+	if active == nil && row.activeWeapon != common.EqUnknown {
+		active = common.NewEquipment(row.activeWeapon)
+	}
+
+	return ocom.Player{
+		Player: common.Player{
+			SteamID64:         entry.SteamID64,
+			LastAlivePosition: r3.Vector{X: float64(row.x), Y: float64(row.y), Z: float64(row.z)},
+			UserID:            entry.UserID,
+			Name:              entry.Name,
+			Inventory:         inventory,
+			Team:              row.team,
+			IsBot:             entry.IsBot,
+			IsConnected:       row.flags&flagConnected != 0,
+			IsDefusing:        row.flags&flagDefusing != 0,
+			IsPlanting:        row.flags&flagPlanting != 0,
+		},
+		Health:         row.health,
+		ViewDirectionX: row.viewX,
+		ViewDirectionY: row.viewY,
+		Money:          row.money,
+		Kills:          row.kills,
+		Deaths:         row.deaths,
+		Assists:        row.assists,
+		Armor:          row.armor,
+		Helmet:         row.flags&flagHelmet != 0,
+		Kit:            row.flags&flagKit != 0,
+		ActiveWeapon:   active,
+		Grenades:       append([]common.EquipmentType(nil), loadout.Grenades...),
+		FlashRemaining: row.flashRemaining,
+	}
+}
+
+// Players returns every player that is in any state, as of the last frame
+// they are in, in the order they first appear. Players that reconnected are
+// returned once.
+func (s *StateStore) Players() []ocom.Player {
+	// index in last of every roster entry, or -1 before the player appears
+	slots := make([]int, len(s.Roster))
+	for i := range slots {
+		slots[i] = -1
+	}
+	var last []int // last row of each player
+	for i, roster := range s.PlayerRoster {
+		if slots[roster] == -1 {
+			// a reconnected player has several roster entries
+			player := s.Roster[roster]
+			for j, entry := range s.Roster {
+				if ocom.SamePlayer(entry.SteamID64, entry.Name, player.SteamID64, player.Name) {
+					slots[j] = len(last)
+				}
+			}
+			last = append(last, i)
+		}
+		last[slots[roster]] = i
+	}
+
+	players := make([]ocom.Player, len(last))
+	for i, row := range last {
+		players[i] = s.player(s.playerRow(row))
+	}
+	return players
+}
+
+// State returns the state of the specified frame.
+func (m *Match) State(frame int) ocom.OverviewState {
+	return m.States.State(frame)
+}
+
+// Players returns every player that is in any state of the match, see
+// StateStore.Players.
+func (m *Match) Players() []ocom.Player {
+	return m.States.Players()
+}
+
+// StateCount returns the number of frames with a state.
+func (m *Match) StateCount() int {
+	return m.States.Len()
+}
+
+// stateBuilder appends the states of parsed frames to a StateStore.
+type stateBuilder struct {
+	store    *StateStore
+	roster   map[RosterEntry]int
+	loadouts map[string]int
+	strings  map[string]int
+	// latest hull of every inferno
+	hulls    map[int64]int
+	previous []playerRow
+}
+
+func newStateBuilder() *stateBuilder {
+	return &stateBuilder{
+		store:    newStateStore(),
+		roster:   make(map[RosterEntry]int),
+		loadouts: make(map[string]int),
+		strings:  make(map[string]int),
+		hulls:    make(map[int64]int),
+	}
+}
+
+// frameValues contains everything that is stored for a single frame.
+type frameValues struct {
+	tick        int
+	timer       ocom.Timer
+	scoreCT     int
+	scoreT      int
+	clanNameCT  string
+	clanNameT   string
+	players     []playerRow
+	bombCarrier int // index in Roster or -1
+	bomb        r3.Vector
+	projectiles []projectileRow
+	infernos    []infernoRow
+}
+
+// projectileRow is a single row of the grenade projectile columns.
+type projectileRow struct {
+	id          int64
+	grenadeType common.EquipmentType
+	x, y, z     float32
+}
+
+// infernoRow is a single row of the inferno columns.
+type infernoRow struct {
+	id   int64
+	hull int
+}
+
+// add appends the current state of the game.
+func (b *stateBuilder) add(gameState dem.GameState, timer ocom.Timer) {
+	ct := gameState.TeamCounterTerrorists()
+	t := gameState.TeamTerrorists()
+	values := frameValues{
+		tick:        gameState.IngameTick(),
+		timer:       timer,
+		scoreCT:     ct.Score(),
+		scoreT:      t.Score(),
+		clanNameCT:  ct.ClanName(),
+		clanNameT:   t.ClanName(),
+		bombCarrier: -1,
+	}
+
+	bomb := gameState.Bomb()
+	values.bomb = bomb.LastOnGroundPosition
+	for _, p := range gameState.Participants().Playing() {
+		row := b.playerRow(p)
+		if p == bomb.Carrier {
+			values.bombCarrier = row.roster
+		}
+		values.players = append(values.players, row)
+	}
+
+	for _, projectile := range gameState.GrenadeProjectiles() {
+		var grenadeType common.EquipmentType
+		if projectile.WeaponInstance != nil {
+			grenadeType = projectile.WeaponInstance.Type
+		}
+		pos := projectile.Position()
+		values.projectiles = append(values.projectiles, projectileRow{
+			id:          projectile.UniqueID(),
+			grenadeType: grenadeType,
+			x:           float32(pos.X),
+			y:           float32(pos.Y),
+			z:           float32(pos.Z),
+		})
+	}
+
+	for _, inferno := range gameState.Infernos() {
+		values.infernos = append(values.infernos, infernoRow{
+			id:   inferno.UniqueID(),
+			hull: b.hull(inferno.UniqueID(), inferno.Fires().ConvexHull2D()),
+		})
+	}
+
+	b.append(values)
+}
+
+// append appends the values of the next frame to the store.
+func (b *stateBuilder) append(values frameValues) {
+	s := b.store
+	frame := s.Len()
+
+	rows := values.players
+	sort.Slice(rows, func(i, j int) bool { return rows[i].roster < rows[j].roster })
+
+	keyFrame := len(s.KeyFrames) == 0 || frame-int(s.KeyFrames[len(s.KeyFrames)-1]) >= keyFrameInterval ||
+		!sameRoster(rows, b.previous)
+	if keyFrame {
+		s.KeyFrames = append(s.KeyFrames, int32(frame))
+	}
+	for i, row := range rows {
+		if keyFrame || row != b.previous[i] {
+			s.appendPlayerRow(row)
+		}
+	}
+	s.PlayerStarts = append(s.PlayerStarts, uint32(len(s.PlayerRoster)))
+	b.previous = rows
+
+	s.IngameTicks = append(s.IngameTicks, int32(values.tick))
+	s.TimerPhases = append(s.TimerPhases, uint8(values.timer.Phase))
+	s.TimerRemaining = append(s.TimerRemaining, int32(values.timer.TimeRemaining/time.Millisecond))
+	s.ScoresCT = append(s.ScoresCT, int16(values.scoreCT))
+	s.ScoresT = append(s.ScoresT, int16(values.scoreT))
+	s.ClanNamesCT = append(s.ClanNamesCT, uint16(b.intern(values.clanNameCT)))
+	s.ClanNamesT = append(s.ClanNamesT, uint16(b.intern(values.clanNameT)))
+
+	s.BombCarriers = append(s.BombCarriers, int16(values.bombCarrier))
+	s.BombX = append(s.BombX, float32(values.bomb.X))
+	s.BombY = append(s.BombY, float32(values.bomb.Y))
+	s.BombZ = append(s.BombZ, float32(values.bomb.Z))
+
+	for _, projectile := range values.projectiles {
+		s.ProjectileIDs = append(s.ProjectileIDs, projectile.id)
+		s.ProjectileTypes = append(s.ProjectileTypes, uint16(projectile.grenadeType))
+		s.ProjectileX = append(s.ProjectileX, projectile.x)
+		s.ProjectileY = append(s.ProjectileY, projectile.y)
+		s.ProjectileZ = append(s.ProjectileZ, projectile.z)
+	}
+	s.ProjectileStarts = append(s.ProjectileStarts, uint32(len(s.ProjectileTypes)))
+
+	for _, inferno := range values.infernos {
+		s.InfernoIDs = append(s.InfernoIDs, inferno.id)
+		s.InfernoHulls = append(s.InfernoHulls, uint32(inferno.hull))
+	}
+	s.InfernoStarts = append(s.InfernoStarts, uint32(len(s.InfernoIDs)))
+}
+
+func (b *stateBuilder) playerRow(p *common.Player) playerRow {
+	roster := b.rosterIndex(RosterEntry{
+		Name:      p.Name,
+		SteamID64: p.SteamID64,
+		UserID:    p.UserID,
+		IsBot:     p.IsBot,
+	})
+
+	var flags uint8
+	if p.IsConnected {
+		flags |= flagConnected
+	}
+	if p.HasHelmet() {
+		flags |= flagHelmet
+	}
+	if p.HasDefuseKit() {
+		flags |= flagKit
+	}
+	if p.IsDefusing {
+		flags |= flagDefusing
+	}
+	if p.IsPlanting {
+		flags |= flagPlanting
+	}
+
+	activeWeapon := common.EqUnknown
+	if active := p.ActiveWeapon(); active != nil {
+		activeWeapon = active.Type
+	}
+
+	return playerRow{
+		roster:         roster,
+		team:           p.Team,
+		x:              float32(p.LastAlivePosition.X),
+		y:              float32(p.LastAlivePosition.Y),
+		z:              float32(p.LastAlivePosition.Z),
+		viewX:          p.ViewDirectionX(),
+		viewY:          p.ViewDirectionY(),
+		health:         p.Health(),
+		armor:          p.Armor(),
+		money:          p.Money(),
+		kills:          p.Kills(),
+		deaths:         p.Deaths(),
+		assists:        p.Assists(),
+		flags:          flags,
+		flashRemaining: p.FlashDurationTimeRemaining(),
+		activeWeapon:   activeWeapon,
+		loadout:        b.loadout(p),
+	}
+}
+
+// rosterIndex returns the index of the entry in Roster.
+func (b *stateBuilder) rosterIndex(entry RosterEntry) int {
+	i, ok := b.roster[entry]
+	if !ok {
+		i = len(b.store.Roster)
+		b.store.Roster = append(b.store.Roster, entry)
+		b.roster[entry] = i
+	}
+	return i
+}
+
+// loadout returns the index of the loadout of the player in Loadouts.
+func (b *stateBuilder) loadout(p *common.Player) int {
+	weapons := make([]common.EquipmentType, 0, len(p.Inventory))
+	for _, w := range p.Weapons() {
+		weapons = append(weapons, w.Type)
+	}
+	return b.loadoutIndex(weapons, grenadesOf(p))
+}
+
+// loadoutIndex returns the index of the loadout in Loadouts. The equipment
+// types are sorted in place.
+func (b *stateBuilder) loadoutIndex(weapons, grenades []common.EquipmentType) int {
+	sort.Slice(weapons, func(i, j int) bool { return weapons[i] < weapons[j] })
+	sort.Slice(grenades, func(i, j int) bool { return grenades[i] < grenades[j] })
+
+	key := make([]byte, 0, 2*(len(weapons)+len(grenades))+1)
+	for _, w := range weapons {
+		key = append(key, byte(w), byte(w>>8))
+	}
+	key = append(key, 0xff)
+	for _, g := range grenades {
+		key = append(key, byte(g), byte(g>>8))
+	}
+
+	i, ok := b.loadouts[string(key)]
+	if !ok {
+		i = len(b.store.Loadouts)
+		b.store.Loadouts = append(b.store.Loadouts, Loadout{Weapons: weapons, Grenades: grenades})
+		b.loadouts[string(key)] = i
+	}
+	return i
+}
+
+// intern returns the index of the string in Strings.
+func (b *stateBuilder) intern(str string) int {
+	i, ok := b.strings[str]
+	if !ok {
+		i = len(b.store.Strings)
+		b.store.Strings = append(b.store.Strings, str)
+		b.strings[str] = i
+	}
+	return i
+}
+
+// hull returns the index of the current area of the inferno in Hulls. The
+// area is only stored again if it changed.
+func (b *stateBuilder) hull(id int64, points []r2.Point) int {
+	if i, ok := b.hulls[id]; ok && samePoints(b.store.Hulls[i], points) {
+		return i
+	}
+	i := len(b.store.Hulls)
+	b.store.Hulls = append(b.store.Hulls, points)
+	b.hulls[id] = i
+	return i
+}
+
+func samePoints(a, b []r2.Point) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sameRoster returns true if both frames contain the same players in the
+// same order.
+func sameRoster(a, b []playerRow) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].roster != b[i].roster {
+			return false
+		}
+	}
+	return true
+}
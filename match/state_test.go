@@ -0,0 +1,253 @@
+package match
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r2"
+	"github.com/golang/geo/r3"
+	ocom "github.com/lwayneh/dem-replay/common"
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+// testFrames builds random frames with players that change from frame to
+// frame, join and leave, so the store contains keyframes for both reasons
+// and deltas in between.
+func testFrames(b *stateBuilder, count int) []frameValues {
+	rng := rand.New(rand.NewSource(1))
+	rosters := make([]int, 12)
+	for i := range rosters {
+		rosters[i] = b.rosterIndex(RosterEntry{Name: string(rune('A' + i)), SteamID64: uint64(i), UserID: i + 1, IsBot: i%4 == 0})
+	}
+	loadouts := []int{
+		b.loadoutIndex(nil, nil),
+		b.loadoutIndex([]common.EquipmentType{common.EqKnife, common.EqGlock}, nil),
+		b.loadoutIndex([]common.EquipmentType{common.EqKnife, common.EqAK47, common.EqDeagle}, []common.EquipmentType{common.EqSmoke, common.EqFlash, common.EqFlash}),
+	}
+	hulls := []int{
+		b.hull(1, []r2.Point{{X: 0, Y: 0}, {X: 10, Y: 0}, {X: 0, Y: 10}}),
+		b.hull(1, []r2.Point{{X: 0, Y: 0}, {X: 20, Y: 0}, {X: 0, Y: 20}}),
+	}
+
+	players := make([]playerRow, 10)
+	for i := range players {
+		players[i] = playerRow{roster: rosters[i], team: common.TeamTerrorists + common.Team(i%2), health: 100, money: 800}
+	}
+	frames := make([]frameValues, count)
+	for f := range frames {
+		// a player reconnects every 100 frames, which changes the roster
+		if f%100 == 50 {
+			players[3].roster = rosters[10+f/100%2]
+		}
+		for i := range players {
+			p := &players[i]
+			if rng.Intn(3) != 0 {
+				continue
+			}
+			p.x += float32(rng.Intn(20) - 10)
+			p.y += float32(rng.Intn(20) - 10)
+			p.viewX = float32(rng.Intn(360))
+			p.health = rng.Intn(101)
+			p.armor = rng.Intn(101)
+			// above the range of 16 bits, e.g. with a raised mp_maxmoney
+			p.money = rng.Intn(100000)
+			p.kills = rng.Intn(30)
+			p.flags = uint8(rng.Intn(32))
+			p.flashRemaining = time.Duration(rng.Intn(3000)) * time.Millisecond
+			p.activeWeapon = common.EqAK47
+			p.loadout = loadouts[rng.Intn(len(loadouts))]
+		}
+
+		values := frameValues{
+			tick:        f * 4,
+			timer:       ocom.Timer{TimeRemaining: time.Duration(f) * time.Second, Phase: ocom.Phase(f % 3)},
+			scoreCT:     f / 100,
+			scoreT:      f / 150,
+			clanNameCT:  "Blue",
+			clanNameT:   "Orange",
+			players:     append([]playerRow(nil), players...),
+			bombCarrier: -1,
+			bomb:        r3.Vector{X: float64(f)},
+		}
+		if f%7 == 0 {
+			values.bombCarrier = players[1].roster
+		}
+		if f%5 == 0 {
+			values.projectiles = []projectileRow{{id: int64(f), grenadeType: common.EqHE, x: 1, y: 2, z: 3}}
+		}
+		if f%11 == 0 {
+			values.infernos = []infernoRow{{id: 1, hull: hulls[f%2]}}
+		}
+		frames[f] = values
+	}
+	return frames
+}
+
+// wantState returns the state the values of a frame must be rebuilt to,
+// leaving out the grenade projectiles, which are compared separately.
+func wantState(s *StateStore, values frameValues) ocom.OverviewState {
+	state := ocom.OverviewState{
+		IngameTick: values.tick,
+		Players:    make([]ocom.Player, 0),
+		Grenades:   make([]common.GrenadeProjectile, 0),
+		Infernos:   make([]ocom.Inferno, 0),
+		Timer:      values.timer,
+	}
+	state.TeamCounterTerrorists.Score = values.scoreCT
+	state.TeamCounterTerrorists.ClanName = values.clanNameCT
+	state.TeamTerrorists.Score = values.scoreT
+	state.TeamTerrorists.ClanName = values.clanNameT
+	state.Bomb.LastOnGroundPosition = values.bomb
+	rows := append([]playerRow(nil), values.players...)
+	sort.Slice(rows, func(i, j int) bool { return rows[i].roster < rows[j].roster })
+	for i, row := range rows {
+		state.Players = append(state.Players, s.player(row))
+		if row.roster == values.bombCarrier {
+			state.Bomb.Carrier = &state.Players[i].Player
+		}
+	}
+	for _, inferno := range values.infernos {
+		state.Infernos = append(state.Infernos, ocom.Inferno{UniqueID: inferno.id, ConvexHull: s.Hulls[inferno.hull]})
+	}
+	return state
+}
+
+// comparable returns the parts of the state that don't contain fresh
+// equipment instances, whose unique IDs differ on every rebuild.
+func comparable(state ocom.OverviewState) interface{} {
+	type player struct {
+		Name                                  string
+		Team                                  common.Team
+		Position                              r3.Vector
+		ViewX, Health, Armor, Money, Kills    float64
+		Connected, Helmet, Kit, Def, Planting bool
+		Flash                                 time.Duration
+		Active                                common.EquipmentType
+		Weapons, Grenades                     []common.EquipmentType
+	}
+	players := make([]player, len(state.Players))
+	for i, p := range state.Players {
+		weapons := make([]common.EquipmentType, 0)
+		for j := 0; j < len(p.Inventory); j++ {
+			weapons = append(weapons, p.Inventory[j].Type)
+		}
+		var active common.EquipmentType
+		if p.ActiveWeapon != nil {
+			active = p.ActiveWeapon.Type
+		}
+		players[i] = player{
+			Name: p.Name, Team: p.Team, Position: p.LastAlivePosition,
+			ViewX: float64(p.ViewDirectionX), Health: float64(p.Health), Armor: float64(p.Armor),
+			Money: float64(p.Money), Kills: float64(p.Kills),
+			Connected: p.IsConnected, Helmet: p.Helmet, Kit: p.Kit, Def: p.IsDefusing, Planting: p.IsPlanting,
+			Flash: p.FlashRemaining, Active: active, Weapons: weapons, Grenades: p.Grenades,
+		}
+	}
+	carrier := ""
+	if state.Bomb.Carrier != nil {
+		carrier = state.Bomb.Carrier.Name
+	}
+	return []interface{}{
+		state.IngameTick, state.Timer, players, carrier, state.Bomb.LastOnGroundPosition, state.Infernos,
+		state.TeamCounterTerrorists.Score, state.TeamCounterTerrorists.ClanName,
+		state.TeamTerrorists.Score, state.TeamTerrorists.ClanName,
+	}
+}
+
+func TestStateStoreRebuild(t *testing.T) {
+	b := newStateBuilder()
+	frames := testFrames(b, 400)
+	for _, values := range frames {
+		b.append(values)
+	}
+	s := b.store
+
+	if s.Len() != len(frames) {
+		t.Fatalf("got %d frames, want %d", s.Len(), len(frames))
+	}
+	// keyframes are stored for roster changes and at least every
+	// keyFrameInterval frames
+	for _, change := range []int32{0, 50, 150, 250, 350} {
+		i := sort.Search(len(s.KeyFrames), func(i int) bool { return s.KeyFrames[i] >= change })
+		if i == len(s.KeyFrames) || s.KeyFrames[i] != change {
+			t.Errorf("no keyframe at roster change %d: %v", change, s.KeyFrames)
+		}
+	}
+	for i := 1; i < len(s.KeyFrames); i++ {
+		if s.KeyFrames[i]-s.KeyFrames[i-1] > keyFrameInterval {
+			t.Errorf("keyframes %d and %d are too far apart", s.KeyFrames[i-1], s.KeyFrames[i])
+		}
+	}
+	if len(s.PlayerRoster) >= 10*len(frames) {
+		t.Errorf("got %d player rows for %d frames, deltas are not used", len(s.PlayerRoster), len(frames))
+	}
+
+	check := func(frame int) {
+		t.Helper()
+		values := frames[frame]
+		got := s.State(frame)
+		want := wantState(s, values)
+		if g, w := comparable(got), comparable(want); !reflect.DeepEqual(g, w) {
+			t.Fatalf("frame %d:\ngot  %+v\nwant %+v", frame, g, w)
+		}
+		if len(got.Grenades) != len(values.projectiles) {
+			t.Fatalf("frame %d: got %d grenades, want %d", frame, len(got.Grenades), len(values.projectiles))
+		}
+		for i, projectile := range values.projectiles {
+			grenade := got.Grenades[i]
+			if grenade.WeaponInstance.Type != projectile.grenadeType || grenade.Trajectory[0] != (r3.Vector{X: 1, Y: 2, Z: 3}) {
+				t.Fatalf("frame %d: got grenade %v at %v", frame, grenade.WeaponInstance.Type, grenade.Trajectory)
+			}
+		}
+	}
+
+	// forward, like playback, which reuses the rows of the previous frame
+	for frame := range frames {
+		check(frame)
+	}
+	// on and between keyframes, coming from other keyframes
+	for _, keyFrame := range s.KeyFrames {
+		check(int(keyFrame))
+		if int(keyFrame)+keyFrameInterval/2 < len(frames) {
+			check(int(keyFrame) + keyFrameInterval/2)
+		}
+	}
+	// backwards and at random, like seeking
+	for frame := len(frames) - 1; frame >= 0; frame -= 3 {
+		check(frame)
+	}
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 200; i++ {
+		check(rng.Intn(len(frames)))
+	}
+}
+
+// TestStateStoreStateCopy checks that states don't share memory with the
+// store or with each other.
+func TestStateStoreStateCopy(t *testing.T) {
+	b := newStateBuilder()
+	frames := testFrames(b, 20)
+	for _, values := range frames {
+		b.append(values)
+	}
+	s := b.store
+
+	first := s.State(11)
+	first.Players[0].Money = -1
+	first.Players[0].Grenades = append(first.Players[0].Grenades[:0], common.EqDecoy)
+	first.Infernos[0].ConvexHull[0] = r2.Point{X: -1, Y: -1}
+
+	second := s.State(11)
+	if second.Players[0].Money == -1 {
+		t.Error("modifying a player changed the store")
+	}
+	if second.Infernos[0].ConvexHull[0] == (r2.Point{X: -1, Y: -1}) {
+		t.Error("modifying an inferno changed the store")
+	}
+	if got := comparable(second); !reflect.DeepEqual(got, comparable(wantState(s, frames[11]))) {
+		t.Errorf("state changed after modifying a copy: %+v", got)
+	}
+}
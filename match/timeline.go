@@ -0,0 +1,180 @@
+package match
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	ocom "github.com/lwayneh/dem-replay/common"
+)
+
+// Timeline converts between the frames of a match, ingame ticks, the time
+// elapsed since the first frame and the round clock. Times are derived from
+// the ingame ticks of the frames, so they don't depend on the frame rate or
+// on how many states were kept while parsing.
+type Timeline struct {
+	m *Match
+}
+
+// RoundClock is a point in time as shown by the round timer, e.g. round 5,
+// 1:23 remaining.
+type RoundClock struct {
+	// Round is the number of the round, starting at 1.
+	Round     int
+	Phase     ocom.Phase
+	Remaining time.Duration
+}
+
+func (c RoundClock) String() string {
+	remaining := c.Remaining
+	if remaining < 0 {
+		remaining = 0
+	}
+	seconds := int(remaining.Seconds())
+	return fmt.Sprintf("round %d, %d:%02d remaining", c.Round, seconds/60, seconds%60)
+}
+
+// Timeline returns the timeline of the match.
+func (m *Match) Timeline() Timeline {
+	return Timeline{m: m}
+}
+
+// clamp returns the frame limited to the frames of the match.
+func (t Timeline) clamp(frame int) int {
+	if frame >= t.m.States.Len() {
+		frame = t.m.States.Len() - 1
+	}
+	if frame < 0 {
+		frame = 0
+	}
+	return frame
+}
+
+// Tick returns the ingame tick of the frame.
+func (t Timeline) Tick(frame int) int {
+	if t.m.States.Len() == 0 {
+		return 0
+	}
+	return int(t.m.States.IngameTicks[t.clamp(frame)])
+}
+
+// FrameOfTick returns the first frame at or after the tick, or the last frame
+// if the tick is after the end of the demo.
+func (t Timeline) FrameOfTick(tick int) int {
+	ticks := t.m.States.IngameTicks
+	return t.clamp(sort.Search(len(ticks), func(i int) bool {
+		return int(ticks[i]) >= tick
+	}))
+}
+
+// Time returns the time elapsed between the first frame and the frame.
+func (t Timeline) Time(frame int) time.Duration {
+	return t.ticksToDuration(t.Tick(frame) - t.Tick(0))
+}
+
+// FrameAt returns the first frame at or after the time elapsed since the
+// first frame.
+func (t Timeline) FrameAt(elapsed time.Duration) int {
+	return t.FrameOfTick(t.Tick(0) + int(elapsed.Seconds()*t.m.TickRate+.5))
+}
+
+// Duration returns the time between the first and the last frame.
+func (t Timeline) Duration() time.Duration {
+	return t.Time(t.m.States.Len() - 1)
+}
+
+// Seek returns the frame that is d after the frame, or before it if d is
+// negative. The result is limited to the frames of the match.
+func (t Timeline) Seek(frame int, d time.Duration) int {
+	target := t.Time(frame) + d
+	sought := t.FrameAt(target)
+	// FrameAt rounds up, step back when seeking backwards
+	if d < 0 && sought > 0 && t.Time(sought) > target {
+		sought--
+	}
+	return sought
+}
+
+// Frames returns how many frames cover the duration at the frame rate of the
+// match, which is at least one frame.
+func (t Timeline) Frames(d time.Duration) int {
+	return t.m.durationToFrames(d)
+}
+
+// FrameDuration returns the time between the frame and the next one.
+func (t Timeline) FrameDuration(frame int) time.Duration {
+	if frame+1 >= t.m.States.Len() {
+		return time.Duration(float64(time.Second) / t.m.FrameRate)
+	}
+	return t.Time(frame+1) - t.Time(frame)
+}
+
+// Clock returns the round clock at the frame. Frames before the first round
+// belong to round 0.
+func (t Timeline) Clock(frame int) RoundClock {
+	if t.m.States.Len() == 0 {
+		return RoundClock{}
+	}
+	frame = t.clamp(frame)
+	clock := RoundClock{
+		Phase:     ocom.Phase(t.m.States.TimerPhases[frame]),
+		Remaining: time.Duration(t.m.States.TimerRemaining[frame]) * time.Millisecond,
+	}
+	if round := t.m.RoundAt(frame); round != nil {
+		clock.Round = round.Number
+	}
+	return clock
+}
+
+// FrameOfClock returns the first frame of the round at which the timer of the
+// phase shows the remaining time or less. ok is false if the round or phase
+// never happened.
+func (t Timeline) FrameOfClock(clock RoundClock) (frame int, ok bool) {
+	for i, round := range t.m.Rounds {
+		if round.Number != clock.Round {
+			continue
+		}
+		end := t.clamp(t.m.roundEnd(i))
+		for f := round.StartFrame; f <= end; f++ {
+			if ocom.Phase(t.m.States.TimerPhases[f]) != clock.Phase {
+				continue
+			}
+			if time.Duration(t.m.States.TimerRemaining[f])*time.Millisecond <= clock.Remaining {
+				return f, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// FrameOfRemaining returns the first frame of the round at which the round
+// timer shows the remaining time or less. The round timer stops when the bomb
+// is planted, so ok is false for times it did not get to before the plant.
+func (t Timeline) FrameOfRemaining(round int, remaining time.Duration) (frame int, ok bool) {
+	return t.FrameOfClock(RoundClock{Round: round, Phase: ocom.PhaseRegular, Remaining: remaining})
+}
+
+// FramePosition returns the last frame at or before the time elapsed since
+// the first frame and how far the time is on the way to the next frame, from
+// 0 at the frame to 1 at the next one.
+func (t Timeline) FramePosition(elapsed time.Duration) (frame int, fraction float64) {
+	frame = t.FrameAt(elapsed)
+	if frame > 0 && t.Time(frame) > elapsed {
+		frame--
+	}
+	start := t.Time(frame)
+	if length := t.Time(frame+1) - start; length > 0 && elapsed > start {
+		fraction = float64(elapsed-start) / float64(length)
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+	return frame, fraction
+}
+
+func (t Timeline) ticksToDuration(ticks int) time.Duration {
+	if t.m.TickRate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(ticks) / t.m.TickRate * float64(time.Second))
+}
@@ -0,0 +1,190 @@
+package match
+
+import (
+	"testing"
+	"time"
+
+	ocom "github.com/lwayneh/dem-replay/common"
+)
+
+// timelineMatch returns a match at 100 ticks per second, so a tick is 10ms.
+// The frames are 2 ticks apart, except for a gap of 14 ticks between frame 3
+// and 4, e.g. from a pause or from sampling.
+func timelineMatch() *Match {
+	b := newStateBuilder()
+	ticks := []int{100, 102, 104, 106, 120, 122, 124}
+	for f, tick := range ticks {
+		phase := ocom.PhaseFreezetime
+		if f >= 3 {
+			phase = ocom.PhaseRegular
+		}
+		b.append(frameValues{
+			tick:        tick,
+			timer:       ocom.Timer{Phase: phase, TimeRemaining: time.Duration(10-f) * time.Second},
+			bombCarrier: -1,
+		})
+	}
+	return &Match{
+		FrameRate:   50,
+		TickRate:    100,
+		TotalFrames: len(ticks),
+		States:      b.store,
+		Rounds:      []ocom.Round{{Number: 1, StartFrame: 1, EndFrame: -1}},
+	}
+}
+
+func TestTimelineTicks(t *testing.T) {
+	timeline := timelineMatch().Timeline()
+
+	ticks := []struct{ frame, tick int }{
+		{-1, 100},
+		{0, 100},
+		{3, 106},
+		{4, 120},
+		{6, 124},
+		{99, 124},
+	}
+	for _, test := range ticks {
+		if got := timeline.Tick(test.frame); got != test.tick {
+			t.Errorf("Tick(%d) = %d, want %d", test.frame, got, test.tick)
+		}
+	}
+
+	frames := []struct{ tick, frame int }{
+		{0, 0},
+		{100, 0},
+		{101, 1},
+		{106, 3},
+		// in the gap
+		{107, 4},
+		{119, 4},
+		{120, 4},
+		{124, 6},
+		{200, 6},
+	}
+	for _, test := range frames {
+		if got := timeline.FrameOfTick(test.tick); got != test.frame {
+			t.Errorf("FrameOfTick(%d) = %d, want %d", test.tick, got, test.frame)
+		}
+	}
+}
+
+func TestTimelineTime(t *testing.T) {
+	timeline := timelineMatch().Timeline()
+	ms := time.Millisecond
+
+	if got := timeline.Time(4); got != 200*ms {
+		t.Errorf("Time(4) = %v, want 200ms", got)
+	}
+	if got := timeline.Duration(); got != 240*ms {
+		t.Errorf("Duration() = %v, want 240ms", got)
+	}
+
+	frameAt := []struct {
+		elapsed time.Duration
+		frame   int
+	}{
+		{-10 * ms, 0},
+		{0, 0},
+		{10 * ms, 1},
+		{25 * ms, 2},
+		{60 * ms, 3},
+		{70 * ms, 4},
+		{200 * ms, 4},
+		{time.Second, 6},
+	}
+	for _, test := range frameAt {
+		if got := timeline.FrameAt(test.elapsed); got != test.frame {
+			t.Errorf("FrameAt(%v) = %d, want %d", test.elapsed, got, test.frame)
+		}
+	}
+
+	seek := []struct {
+		frame int
+		d     time.Duration
+		want  int
+	}{
+		{0, 20 * ms, 1},
+		{3, 20 * ms, 4},
+		{4, -20 * ms, 3},
+		{4, -140 * ms, 3},
+		{4, -150 * ms, 2},
+		{0, -time.Second, 0},
+		{6, time.Second, 6},
+	}
+	for _, test := range seek {
+		if got := timeline.Seek(test.frame, test.d); got != test.want {
+			t.Errorf("Seek(%d, %v) = %d, want %d", test.frame, test.d, got, test.want)
+		}
+	}
+}
+
+func TestTimelineFramePosition(t *testing.T) {
+	timeline := timelineMatch().Timeline()
+	ms := time.Millisecond
+
+	tests := []struct {
+		elapsed  time.Duration
+		frame    int
+		fraction float64
+	}{
+		{-10 * ms, 0, 0},
+		{0, 0, 0},
+		{30 * ms, 1, .5},
+		{40 * ms, 2, 0},
+		// half way through the gap
+		{130 * ms, 3, .5},
+		{240 * ms, 6, 0},
+		{time.Second, 6, 0},
+	}
+	for _, test := range tests {
+		frame, fraction := timeline.FramePosition(test.elapsed)
+		if frame != test.frame || fraction != test.fraction {
+			t.Errorf("FramePosition(%v) = %d, %v, want %d, %v", test.elapsed, frame, fraction, test.frame, test.fraction)
+		}
+	}
+}
+
+func TestTimelineClock(t *testing.T) {
+	timeline := timelineMatch().Timeline()
+
+	clocks := []struct {
+		frame int
+		want  RoundClock
+	}{
+		// before the first round
+		{0, RoundClock{Round: 0, Phase: ocom.PhaseFreezetime, Remaining: 10 * time.Second}},
+		{1, RoundClock{Round: 1, Phase: ocom.PhaseFreezetime, Remaining: 9 * time.Second}},
+		{99, RoundClock{Round: 1, Phase: ocom.PhaseRegular, Remaining: 4 * time.Second}},
+	}
+	for _, test := range clocks {
+		if got := timeline.Clock(test.frame); got != test.want {
+			t.Errorf("Clock(%d) = %+v, want %+v", test.frame, got, test.want)
+		}
+	}
+
+	remaining := []struct {
+		round     int
+		remaining time.Duration
+		frame     int
+		ok        bool
+	}{
+		{1, 8 * time.Second, 3, true},
+		{1, 5500 * time.Millisecond, 5, true},
+		{1, time.Second, 0, false},
+		{2, 8 * time.Second, 0, false},
+	}
+	for _, test := range remaining {
+		frame, ok := timeline.FrameOfRemaining(test.round, test.remaining)
+		if frame != test.frame || ok != test.ok {
+			t.Errorf("FrameOfRemaining(%d, %v) = %d, %v, want %d, %v", test.round, test.remaining, frame, ok, test.frame, test.ok)
+		}
+	}
+
+	// the timer of the last frame is the bomb timer
+	m := timelineMatch()
+	m.States.TimerPhases[6] = uint8(ocom.PhasePlanted)
+	if frame, ok := m.Timeline().FrameOfRemaining(1, 4*time.Second); ok {
+		t.Errorf("FrameOfRemaining read the bomb timer at frame %d", frame)
+	}
+}
@@ -0,0 +1,215 @@
+package match
+
+import (
+	"time"
+
+	"github.com/golang/geo/r2"
+	"github.com/golang/geo/r3"
+	ocom "github.com/lwayneh/dem-replay/common"
+	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	event "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+)
+
+// Durations of the flash and HE explosions in the viewer.
+const (
+	flashEffectDuration = 300 * time.Millisecond
+	heEffectDuration    = 300 * time.Millisecond
+)
+
+// pendingEffect is a smoke or decoy that did not expire yet.
+type pendingEffect struct {
+	start   int
+	event   event.GrenadeEvent
+	grenade int // index in Match.Grenades or -1
+	visible bool
+}
+
+// registerUtilityHandlers adds the effects of all grenades to GrenadeEffects
+// and sets the expiry of the grenades whose effect lasts.
+// Smokes and decoys last from their start to their expired event, molotovs
+// and incendiaries until their inferno expired. Smokes that pop on burning
+// infernos put them out, and fire grenades that land in a smoke don't start
+// an inferno at all, both are marked as extinguished.
+// The returned function ends all effects that are still active at the end
+// of the demo.
+func registerUtilityHandlers(parser dem.Parser, match *Match) func(frame int) {
+	match.pendingEffects = make(map[int]pendingEffect)
+	pending := match.pendingEffects
+	// fire grenades by the unique id of their burning inferno
+	infernos := make(map[int64]int)
+	// fire grenades that started an inferno
+	burned := make(map[int]bool)
+
+	showEffects := func() bool {
+		return match.currentPhase != ocom.PhaseFreezetime && match.currentPhase != ocom.PhaseRestart
+	}
+	grenadeIndex := func(entityID int) int {
+		if i, ok := match.activeGrenades[entityID]; ok {
+			return i
+		}
+		return -1
+	}
+	start := func(e event.GrenadeEvent) {
+		pending[e.GrenadeEntityID] = pendingEffect{
+			start:   match.frame(),
+			event:   snapshotGrenadeEvent(e),
+			grenade: grenadeIndex(e.GrenadeEntityID),
+			visible: showEffects(),
+		}
+	}
+	expire := func(entityID, frame int) {
+		effect, ok := pending[entityID]
+		if !ok {
+			return
+		}
+		delete(pending, entityID)
+		if effect.visible {
+			grenadeEventHandler(effect.start, frame, effect.event, match)
+		}
+		if effect.grenade != -1 {
+			match.Grenades[effect.grenade].ExpireFrame = frame
+		}
+	}
+	expireAll := func(frame int) {
+		for entityID := range pending {
+			expire(entityID, frame)
+		}
+	}
+
+	parser.RegisterEventHandler(func(e event.FlashExplode) {
+		if showEffects() {
+			frame := match.frame()
+			grenadeEventHandler(frame, frame+match.durationToFrames(flashEffectDuration), e.GrenadeEvent, match)
+		}
+	})
+	parser.RegisterEventHandler(func(e event.HeExplode) {
+		if showEffects() {
+			frame := match.frame()
+			grenadeEventHandler(frame, frame+match.durationToFrames(heEffectDuration), e.GrenadeEvent, match)
+		}
+	})
+
+	parser.RegisterEventHandler(func(e event.SmokeStart) {
+		start(e.GrenadeEvent)
+		smoke := r2.Point{X: e.Position.X, Y: e.Position.Y}
+		for _, inferno := range parser.GameState().Infernos() {
+			i, ok := infernos[inferno.UniqueID()]
+			if ok && infernoInSmoke(inferno, smoke) {
+				match.Grenades[i].Extinguished = true
+			}
+		}
+	})
+	parser.RegisterEventHandler(func(e event.SmokeExpired) {
+		expire(e.GrenadeEntityID, match.frame())
+	})
+	parser.RegisterEventHandler(func(e event.DecoyStart) {
+		start(e.GrenadeEvent)
+	})
+	parser.RegisterEventHandler(func(e event.DecoyExpired) {
+		expire(e.GrenadeEntityID, match.frame())
+	})
+
+	parser.RegisterEventHandler(func(e event.GrenadeProjectileDestroy) {
+		i := match.lastGrenade(e.Projectile.UniqueID())
+		if i == -1 || !isFireGrenade(match.Grenades[i].Type) {
+			return
+		}
+		pos := e.Projectile.Position()
+		for _, smoke := range match.activeSmokes() {
+			if (r2.Point{X: smoke.X - pos.X, Y: smoke.Y - pos.Y}).Norm() < smokeRadius {
+				match.Grenades[i].Extinguished = true
+			}
+		}
+	})
+	parser.RegisterEventHandler(func(e event.InfernoStart) {
+		if i := match.infernoGrenade(e.Inferno.Thrower(), burned); i != -1 {
+			infernos[e.Inferno.UniqueID()] = i
+			burned[i] = true
+			match.Grenades[i].ExpireFrame = -1
+		}
+	})
+	parser.RegisterEventHandler(func(e event.InfernoExpired) {
+		id := e.Inferno.UniqueID()
+		if i, ok := infernos[id]; ok {
+			match.Grenades[i].ExpireFrame = match.frame()
+			delete(infernos, id)
+		}
+	})
+
+	// the game removes all utility when a new round starts
+	parser.RegisterEventHandler(func(event.RoundStart) {
+		expireAll(match.frame())
+	})
+
+	return expireAll
+}
+
+// activeSmokes returns the positions of the smokes that are active while
+// parsing.
+func (m *Match) activeSmokes() []r3.Vector {
+	smokes := make([]r3.Vector, 0)
+	for _, effect := range m.pendingEffects {
+		if effect.event.GrenadeType == common.EqSmoke {
+			smokes = append(smokes, effect.event.Position)
+		}
+	}
+	return smokes
+}
+
+// durationToFrames returns the number of frames that cover the duration.
+func (m *Match) durationToFrames(d time.Duration) int {
+	frames := int(d.Seconds() * m.FrameRate)
+	if frames == 0 {
+		frames = 1
+	}
+	return frames
+}
+
+// lastGrenade returns the index of the grenade with the unique id of the
+// projectile, or -1 if it was not recorded.
+func (m *Match) lastGrenade(uniqueID int64) int {
+	for i := len(m.Grenades) - 1; i >= 0; i-- {
+		if m.Grenades[i].UniqueID == uniqueID {
+			return i
+		}
+	}
+	return -1
+}
+
+// infernoGrenade returns the index of the fire grenade that started an
+// inferno of the thrower, which is the latest detonated fire grenade of the
+// thrower that has no inferno yet, or -1 if there is none. Any thrower
+// matches if it is nil.
+func (m *Match) infernoGrenade(thrower *common.Player, burned map[int]bool) int {
+	for i := len(m.Grenades) - 1; i >= 0; i-- {
+		grenade := m.Grenades[i]
+		if !isFireGrenade(grenade.Type) || grenade.DetonateFrame == -1 || grenade.Extinguished {
+			continue
+		}
+		if thrower != nil && !ocom.SamePlayer(grenade.ThrowerSteamID, grenade.ThrowerName, thrower.SteamID64, thrower.Name) {
+			continue
+		}
+		if burned[i] {
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+func isFireGrenade(t common.EquipmentType) bool {
+	return t == common.EqMolotov || t == common.EqIncendiary
+}
+
+// infernoInSmoke returns true if the area of the burning fires of the inferno
+// is covered by the smoke.
+func infernoInSmoke(inferno *common.Inferno, smoke r2.Point) bool {
+	hull := inferno.Fires().Active().ConvexHull2D()
+	for i := range hull {
+		if distanceToSegment(smoke, hull[i], hull[(i+1)%len(hull)]) < smokeRadius {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package match
+
+import (
+	"testing"
+
+	ocom "github.com/lwayneh/dem-replay/common"
+	common "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+// TestInfernoGrenadeBots checks that infernos of bots are attached to the
+// molotovs they threw themselves.
+func TestInfernoGrenadeBots(t *testing.T) {
+	m := &Match{Grenades: []ocom.Grenade{
+		{Type: common.EqMolotov, ThrowerName: "BotA", DetonateFrame: 10},
+		{Type: common.EqIncendiary, ThrowerName: "BotB", DetonateFrame: 12},
+		{Type: common.EqMolotov, ThrowerName: "Human", ThrowerSteamID: 1, DetonateFrame: 12},
+		// still in flight
+		{Type: common.EqMolotov, ThrowerName: "BotA", DetonateFrame: -1},
+	}}
+	burned := make(map[int]bool)
+
+	tests := []struct {
+		thrower *common.Player
+		want    int
+	}{
+		{&common.Player{Name: "BotA"}, 0},
+		{&common.Player{Name: "BotB"}, 1},
+		// the molotov of BotA has an inferno already
+		{&common.Player{Name: "BotA"}, -1},
+		{&common.Player{Name: "BotC"}, -1},
+		{&common.Player{Name: "Renamed", SteamID64: 1}, 2},
+	}
+	for _, test := range tests {
+		got := m.infernoGrenade(test.thrower, burned)
+		if got != test.want {
+			t.Errorf("inferno of %v: got grenade %d, want %d", test.thrower.Name, got, test.want)
+		}
+		if got != -1 {
+			burned[got] = true
+		}
+	}
+}
@@ -1,45 +1,45 @@
+//go:build !headless
+// +build !headless
+
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"image"
 	"image/color"
 	_ "image/jpeg"
 	_ "image/png"
 	"io/ioutil"
 	"log"
 	"math"
+	"net/http"
 	"os"
 	"os/exec"
-	"path/filepath"
-	"runtime"
 	"strings"
 	"time"
 
 	"github.com/faiface/pixel"
-	"github.com/faiface/pixel/imdraw"
 	"github.com/faiface/pixel/pixelgl"
 	"github.com/faiface/pixel/text"
 	"github.com/golang/freetype/truetype"
 	ocom "github.com/lwayneh/dem-replay/common"
-	"github.com/lwayneh/dem-replay/match"
+	"github.com/lwayneh/dem-replay/live"
 	game "github.com/lwayneh/dem-replay/match"
 	part "github.com/lwayneh/dem-replay/particle"
+	"github.com/lwayneh/dem-replay/playback"
+	"github.com/lwayneh/dem-replay/render"
+	"github.com/lwayneh/dem-replay/viewer"
 	"golang.org/x/image/colornames"
 	"golang.org/x/image/font"
 )
 
 var (
-	paused          bool
-	loadCtrl        bool
-	staticCtrl      bool = false
-	curFrame        int
+	session         *viewer.Session
 	spritePath      = "imgSprite.png"
-	lastEffect      = 0
 	ctrlList        = []string{"Play", "Pause", "Rewind", "FastForward", "barsHorizontal"}
 	controls        = make(map[string]*ocom.Control)
-	speed           int
 	playBar         pixel.Rect
 	playPauseCtrl   *ocom.Control
 	rewindCtrl      *ocom.Control
@@ -61,29 +61,10 @@ var (
 	}
 )
 
-// Config contains information the application requires in order to run
-type Config struct {
-	// Path to font file (.ttf)
-	FontPath string
-
-	// Path to overview directory
-	OverviewDir string
-
-	// Fallback GOTV Framerate
-	FrameRate float64
-
-	// Fallback Gameserver Tickrate
-	TickRate float64
-}
-
-// DefaultConfig contains standard parameters for the application.
-var DefaultConfig = Config{
-	FrameRate: -1,
-	TickRate:  -1,
-}
-
 const (
-	fontName          string  = "DejaVuSans.ttf"
+	// size of the font of the text atlas, text is scaled from it
+	atlasFontSize float64 = 52
+
 	mapOverviewWidth  int32   = 1024
 	mapOverviewHeight int32   = 1024
 	mapXOffset        float64 = 300
@@ -92,32 +73,19 @@ const (
 	infoBarHeight     float64 = 110
 )
 
-var conf = DefaultConfig
-
 func init() {
-	flag.Float64Var(&conf.FrameRate, "framerate", conf.FrameRate, "Fallback GOTV Framerate")
-	flag.Float64Var(&conf.TickRate, "tickrate", conf.TickRate, "Fallback Gameserver Tickrate")
-	userHomeDir, err := os.UserHomeDir()
-	if err != nil {
-		log.Fatalln("trying to get user home directory:", err)
-	}
-	defaultFontPath := fmt.Sprintf("%v\\dem-replay\\%v", userHomeDir, fontName)
-	defaultOverviewDirectory := fmt.Sprintf("%v\\dem-replay\\", userHomeDir)
-	flag.StringVar(&conf.FontPath, "fontpath", defaultFontPath, "Path to font file (.ttf)")
-	flag.StringVar(&conf.OverviewDir, "overviewdir", defaultOverviewDirectory, "Path to overview directory")
-	flag.Parse()
-	speed = 5
+	// only the viewer streams its state
+	flag.StringVar(&conf.LiveAddr, "live", conf.LiveAddr, "Address to stream the viewer state on over a websocket, e.g. localhost:8081 (empty to disable)")
+	flag.Float64Var(&conf.LiveRate, "liverate", conf.LiveRate, "Number of states streamed per second")
 }
 
 func run() {
-	mouseIn := make(chan bool)
-
 	var demoFileName string
 
 	if len(flag.Args()) < 1 {
 		demoFileNameB, err := exec.Command("cmd", "/C", "chooser.bat").CombinedOutput()
 		if err != nil {
-			fmt.Println("Usage: ./dem-replay [path to demo]")
+			fmt.Println("Usage: ./dem-replay [path to demo or .json export, - to read from stdin]")
 			panic(err)
 		}
 		demoPath := string(demoFileNameB)
@@ -144,7 +112,7 @@ func run() {
 	win.SetSmooth(true)
 
 	// Load TTF for custom font
-	face, err := loadTTF(conf.FontPath, 52)
+	face, err := loadTTF(conf.FontPath, atlasFontSize)
 	if err != nil {
 		errorString := fmt.Sprintf("trying to load TTF file:\n%v", err)
 		log.Println(errorString)
@@ -156,40 +124,70 @@ func run() {
 	atlas := text.NewAtlas(face, text.ASCII)
 	txt := text.New(win.Bounds().Center(), atlas)
 	txt.LineHeight = atlas.LineHeight() * 1.5
-	txtInfo := text.New(win.Bounds().Center(), atlas)
-	txtInfo.LineHeight = atlas.LineHeight() * 1.5
-	txtScore := text.New(win.Bounds().Center(), atlas)
-	txtScore.LineHeight = atlas.LineHeight() * 1.5
 
 	win.Clear(colornames.Black)
 	lines := []string{
 		"We're processing your demo now!",
 		"This will take a moment, please wait...",
 	}
+	cancelHint := "Press Esc to cancel"
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	progress := make(chan game.Progress, 1)
+	loaded := make(chan struct{})
 	go func() {
-		for match.Progress < 100 || math.IsNaN(match.Progress) {
+		defer close(loaded)
+		var current game.Progress
+		redraw := time.NewTicker(50 * time.Millisecond)
+		defer redraw.Stop()
+		for {
+			if win.Closed() || win.JustPressed(pixelgl.KeyEscape) {
+				cancel()
+			}
 			scaleMat := pixel.IM.Scaled(txt.Dot, .4)
 			for _, line := range lines {
 				txt.Dot.X -= txt.BoundsOf(line).W() / 2
 				fmt.Fprintln(txt, line)
 			}
-			if !math.IsNaN(match.Progress) {
-				txt.Dot.X -= 150
-				fmt.Fprintf(txt, "%9.f", match.Progress)
-				fmt.Fprintln(txt, "%")
+			status := "Reading demo..."
+			if current.Frame > 0 {
+				status = fmt.Sprintf("%.f%% - Round %d - %v remaining", current.Percent(), current.Round, current.ETA.Round(time.Second))
 			}
+			txt.Dot.X -= txt.BoundsOf(status).W() / 2
+			fmt.Fprintln(txt, status)
+			txt.Dot.X -= txt.BoundsOf(cancelHint).W() / 2
+			fmt.Fprintln(txt, cancelHint)
 			win.Clear(colornames.Black)
 			txt.Draw(win, scaleMat)
 			win.Update()
 			txt.Clear()
-		}
-		if match.Progress >= 100 {
-			runtime.Goexit()
+
+			select {
+			case p, ok := <-progress:
+				if !ok {
+					return
+				}
+				current = p
+			case <-redraw.C:
+			}
 		}
 	}()
 	// Load & parse match demo
-	match, err := game.NewMatch(demoFileName, conf.FrameRate, conf.TickRate)
+	opts := game.Options{
+		FallbackFrameRate: conf.FrameRate,
+		FallbackTickRate:  conf.TickRate,
+		CacheDir:          conf.CacheDir,
+		StatesPerSecond:   conf.StatesPerSecond,
+		Progress:          progress,
+	}
+	match, err := openMatch(ctx, demoFileName, opts)
+	<-loaded
+	var canceled *game.CanceledError
+	if errors.As(err, &canceled) {
+		log.Println(canceled)
+		return
+	}
 	if err != nil {
 		errorString := fmt.Sprintf("trying to parse demo file:\n%v", err)
 		log.Println(errorString)
@@ -312,10 +310,10 @@ func run() {
 	fireBatch := pixel.NewBatch(&pixel.TrianglesData{}, fireSheet)
 	batches["fire"] = fireBatch
 
-	// Load map overview .jpg
-	mapOverview, err := loadPicture(filepath.Join(conf.OverviewDir, fmt.Sprintf("%v.jpg", match.MapName)))
+	// The overview is drawn like rendered images
+	scene, err := newScene(match)
 	if err != nil {
-		errorString := fmt.Sprintf("Error loading image .jpg \n%v", err)
+		errorString := fmt.Sprintf("trying to draw the overview:\n%v", err)
 		log.Println(errorString)
 		time.Sleep(2 * time.Second)
 		panic(err)
@@ -328,30 +326,30 @@ func run() {
 	}
 	ctrlSprites := makeSprites(ctrlSheet, ctrlRects)
 
-	infoImg, infoRects, err := part.LoadSpriteSheetAsMap("infoBar.png", "infoBar.csv")
-	if err != nil {
-		errorString := fmt.Sprintf("Error loading image .png \n%v", err)
-		fmt.Printf(errorString)
-	}
-	infoSprites := makeAllSprites(infoImg, infoRects)
-
 	createControls(ctrlSprites)
 	playPauseCtrl = controls["Play"]
 	rewindCtrl = controls["Rewind"]
 	fastForwardCtrl = controls["FastForward"]
 	menuCtrl = controls["barsHorizontal"]
 
-	mapSprite := pixel.NewSprite(mapOverview, mapOverview.Bounds())
 	win.Clear(colornames.Black)
-	canvas := pixelgl.NewCanvas(pixel.R(0, 0, 1624, 1024))
+	canvas := pixelgl.NewCanvas(pixel.R(0, 0, render.Width, render.Height))
 	canvas.SetSmooth(true)
+	backend := newCanvasBackend(canvas, atlas, atlasFontSize)
 	controlBounds := pixel.R(0, 0, win.Bounds().W(), ctrlBarHeight)
 	controlCanvas := pixelgl.NewCanvas(controlBounds)
 	controlCanvas.SetSmooth(true)
 
-	// Create IMDraw Object for drawing shapes
-	imd := imdraw.New(nil)
-	imd.Precision = 64
+	playhead := playback.NewController(match.Timeline())
+	playhead.Play()
+	session = viewer.NewSession(match, playhead)
+	if conf.LiveAddr != "" {
+		go func() {
+			log.Printf("streaming viewer state on ws://%v/", conf.LiveAddr)
+			err := http.ListenAndServe(conf.LiveAddr, live.New(session, conf.LiveRate, conf.LiveAddr))
+			log.Println("live stream stopped:", err)
+		}()
+	}
 
 	// BEGIN MAIN GAME LOOP//
 	last := time.Now()
@@ -364,64 +362,23 @@ func run() {
 		}
 
 		canvas.Clear(colornames.Black)
-
-		imd.Clear()
 		win.Clear(colornames.Black)
 
-		frameStart := time.Now()
-		handleInputs(win, match)
-		go checkMouse(win, controlCanvas, mouseIn, speed, match)
-
-		if paused {
-			time.Sleep(32)
-			updateGraphics(match, win, txt, canvas, mapSprite, imd, parts, batches, &dt, controlCanvas, ctrlSprites, mouseIn, infoSprites, txtInfo, txtScore)
-			//updateWindowTitle(window, match)
-			continue
-		}
+		handleInputs(win)
+		checkMouse(win, controlCanvas)
 
-		updateGraphics(match, win, txt, canvas, mapSprite, imd, parts, batches, &dt, controlCanvas, ctrlSprites, mouseIn, infoSprites, txtInfo, txtScore)
+		// the playback position only depends on the clock of the playhead,
+		// not on how long drawing the last frame took
+		session.Update()
+		updateGraphics(match, win, txt, scene, backend, parts, batches, &dt, controlCanvas, ctrlSprites)
 		canvas.Clear(color.Alpha{0})
 		//updateWindowTitle(window, match)
-
-		var playbackSpeed float64 = 1
-		// frameDuration is in ms
-		frameDuration := float64(time.Since(frameStart) / 1000000)
-
-		if win.Pressed(pixelgl.KeyW) {
-			if win.Pressed(pixelgl.KeyLeftShift) {
-
-				playbackSpeed = 10
-				curFrame += 10
-			} else {
-				playbackSpeed = 5
-				curFrame += 10
-			}
-		}
-		if win.Pressed(pixelgl.KeyS) {
-			if win.Pressed(pixelgl.KeyLeftShift) {
-				playbackSpeed = .1
-				curFrame -= 10
-			} else {
-				playbackSpeed = 0.5
-				curFrame -= 5
-			}
-		}
-		delay := (1/playbackSpeed)*(1000/match.FrameRate) - frameDuration
-		if delay < 0 {
-			delay = 0
-		}
-		time.Sleep(time.Duration(delay) * time.Millisecond)
-		if curFrame < len(match.States)-1 {
-			curFrame++
-		}
-
 	}
 }
 
-func main() {
-
+// runViewer opens the viewer window for the demo given as argument.
+func runViewer() {
 	pixelgl.Run(run)
-
 }
 
 // Helper for loading TTF font files
@@ -448,144 +405,63 @@ func loadTTF(path string, size float64) (font.Face, error) {
 	}), nil
 }
 
-// Helper for loading pictures (.png or .jpg)
-func loadPicture(path string) (pixel.Picture, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-	img, _, err := image.Decode(file)
-	if err != nil {
-		return nil, err
-	}
-	return pixel.PictureDataFromImage(img), nil
-}
-
 // Handles all keyboard inputs
-func handleInputs(win *pixelgl.Window, match *game.Match) {
-	if win.Pressed(pixelgl.KeySpace) {
-		resume()
+func handleInputs(win *pixelgl.Window) {
+	if win.JustPressed(pixelgl.KeySpace) {
+		session.Handle(viewer.TogglePause)
 	}
 
-	if win.Pressed(pixelgl.KeyA) {
-		if win.Pressed(pixelgl.KeyLeftShift) {
-			if curFrame < match.FrameRateRounded*10 {
-				curFrame = 0
-			} else {
-				curFrame -= match.FrameRateRounded * 10
-			}
-		} else {
-			if curFrame < match.FrameRateRounded*5 {
-				curFrame = 0
-			} else {
-				curFrame -= match.FrameRateRounded * 5
-			}
-		}
+	// W and S step through the playback speeds, R plays backwards
+	if win.JustPressed(pixelgl.KeyW) {
+		session.Handle(viewer.Faster)
 	}
-
-	if win.Pressed(pixelgl.KeyD) {
-		if win.Pressed(pixelgl.KeyLeftShift) {
-			if curFrame+match.FrameRateRounded*10 > len(match.States)-1 {
-				curFrame = len(match.States) - 1
-			} else {
-				curFrame += match.FrameRateRounded * 10
-			}
-		} else {
-			if curFrame+match.FrameRateRounded*5 > len(match.States)-1 {
-				curFrame = len(match.States) - 1
-			} else {
-				curFrame += match.FrameRateRounded * 5
-			}
-		}
+	if win.JustPressed(pixelgl.KeyS) {
+		session.Handle(viewer.Slower)
+	}
+	if win.JustPressed(pixelgl.KeyR) {
+		session.Handle(viewer.ToggleReverse)
+	}
+	// the arrow keys pause and step a single frame
+	if win.JustPressed(pixelgl.KeyRight) {
+		session.Handle(viewer.StepForward)
+	}
+	if win.JustPressed(pixelgl.KeyLeft) {
+		session.Handle(viewer.StepBackward)
 	}
 
-	if win.Pressed(pixelgl.KeyQ) {
-		if win.Pressed(pixelgl.KeyLeftShift) {
-			set := false
-			for i, frame := range match.HalfStarts {
-				if curFrame < frame {
-					if i > 1 && curFrame < match.HalfStarts[i-1]+match.FrameRateRounded/2 {
-						curFrame = match.HalfStarts[i-2]
-						set = true
-						break
-					}
-					if i-1 < 0 {
-						curFrame = 0
-						set = true
-						break
-					}
-					curFrame = match.HalfStarts[i-1]
-					set = true
-					break
-				}
-			}
-			// not set -> last round of match
-			if !set {
-				if len(match.HalfStarts) > 1 && curFrame < match.HalfStarts[len(match.HalfStarts)-1]+match.FrameRateRounded/2 {
-					curFrame = match.HalfStarts[len(match.HalfStarts)-2]
-				} else {
-					curFrame = match.HalfStarts[len(match.HalfStarts)-1]
-				}
-			}
-		} else {
-			set := false
-			for i, frame := range match.RoundStarts {
-				if curFrame < frame {
-					if i > 1 && curFrame < match.RoundStarts[i-1]+match.FrameRateRounded/2 {
-						curFrame = match.RoundStarts[i-2]
-						set = true
-						break
-					}
-					if i-1 < 0 {
-						curFrame = 0
-						set = true
-						break
-					}
-					curFrame = match.RoundStarts[i-1]
-					set = true
-					break
-				}
-			}
-			// not set -> last round of match
-			if !set {
-				if len(match.RoundStarts) > 1 && curFrame < match.RoundStarts[len(match.RoundStarts)-1]+match.FrameRateRounded/2 {
-					curFrame = match.RoundStarts[len(match.RoundStarts)-2]
-				} else {
-					curFrame = match.RoundStarts[len(match.RoundStarts)-1]
-				}
-			}
-		}
+	// keep the arcs of all grenades of the round visible
+	if win.JustPressed(pixelgl.KeyG) {
+		session.Handle(viewer.ToggleGrenadeArcs)
 	}
 
-	if win.Pressed(pixelgl.KeyE) {
-		if win.Pressed(pixelgl.KeyLeftShift) {
-			for _, frame := range match.HalfStarts {
-				if curFrame < frame {
-					curFrame = frame
-					break
-				}
-			}
+	shift := win.Pressed(pixelgl.KeyLeftShift)
+	keys := []struct {
+		key          pixelgl.Button
+		cmd, shifted viewer.Command
+	}{
+		{pixelgl.KeyA, viewer.SeekBackward, viewer.SeekBackwardLong},
+		{pixelgl.KeyD, viewer.SeekForward, viewer.SeekForwardLong},
+		{pixelgl.KeyQ, viewer.PreviousRound, viewer.PreviousHalf},
+		{pixelgl.KeyE, viewer.NextRound, viewer.NextHalf},
+	}
+	for _, k := range keys {
+		if !win.Pressed(k.key) {
+			continue
+		}
+		if shift {
+			session.Handle(k.shifted)
 		} else {
-			for _, frame := range match.RoundStarts {
-				if curFrame < frame {
-					curFrame = frame
-					break
-				}
-			}
+			session.Handle(k.cmd)
 		}
 	}
-
 }
 
 // Updates all graphics each frame
-func updateGraphics(match *game.Match, win *pixelgl.Window, txt *text.Text, canvas *pixelgl.Canvas,
-	mapSprite *pixel.Sprite, imd *imdraw.IMDraw, parts map[string]*part.Particles,
+func updateGraphics(match *game.Match, win *pixelgl.Window, txt *text.Text, scene *render.Scene,
+	backend *canvasBackend, parts map[string]*part.Particles,
 	batches map[string]*pixel.Batch, dt *float64, control *pixelgl.Canvas,
-	sprites map[string]*pixel.Sprite, result <-chan bool, infoSprites map[string]*pixel.Sprite, txtInfo *text.Text, txtScore *text.Text) {
-	playerNames = make(map[string]string)
-	canvas.Clear(colornames.Black)
-	mapSprite.Draw(canvas, pixel.IM.Moved(canvas.Bounds().Center()))
+	sprites map[string]*pixel.Sprite) {
+	canvas := backend.canvas
 
 	resizeScale := math.Min(
 		win.Bounds().W()/canvas.Bounds().W(),
@@ -595,92 +471,56 @@ func updateGraphics(match *game.Match, win *pixelgl.Window, txt *text.Text, canv
 	mainMat := pixel.IM.Scaled(pixel.ZV, resizeScale)
 	win.SetMatrix(mainMat)
 	txt.Clear()
-	drawInfoBars(match, canvas, infoSprites, txtInfo)
-	drawKills(match, infoSprites, txt, canvas, mapSprite)
-	drawScore(match, txtInfo, canvas)
-	shots := match.Shots[curFrame]
-	for _, shot := range shots {
-		drawShot(imd, canvas, &shot, match)
-	}
-
-	players := match.States[curFrame].Players
-	for _, player := range players {
-		txt.Clear()
-		drawPlayer(imd, canvas, &player, match, txt, &mainMat)
-	}
+	frame := session.Frame()
+	state := session.State()
+	scene.ShowGrenadeArcs = session.ShowGrenadeArcs()
+	scene.DrawState(backend, state, frame)
 
-	effects := match.GrenadeEffects[curFrame]
+	// particles on top of the effects of the scene
+	effects := match.GrenadeEffectsAt(frame)
 	for _, effect := range effects {
 		drawGrenadeEffect(&effect, match, parts, batches, canvas, dt)
-		lastEffect = effect.GrenadeEntityID
 	}
-
-	grenades := match.States[curFrame].Grenades
-	for _, grenade := range grenades {
-		drawGrenade(imd, &grenade, match)
+	infernos := state.Infernos
+	for _, inferno := range infernos {
+		drawInferno(&inferno, match, parts, batches, canvas, dt)
 	}
 
-	infernos := match.States[curFrame].Infernos
-	for _, inferno := range infernos {
-		drawInferno(imd, &inferno, match, parts, batches, canvas, dt)
-	}
-	bomb := match.States[curFrame].Bomb
-	drawBomb(infoSprites, &bomb, match, canvas)
-
-	select {
-	case loadCtrl = <-result:
-		if loadCtrl {
-			imd.Draw(canvas)
-			canvas.Draw(win, pixel.IM.Moved(canvas.Bounds().Center()))
-			control.Clear(color.RGBA{85, 90, 99, 90})
-			drawControls(control, match, win, sprites)
-			drawFrameBar(control, match, txt)
-			control.Draw(win, pixel.IM.Moved(control.Bounds().Center()))
-			canvas.Clear(colornames.Black)
-		} else {
-			imd.Draw(canvas)
-			canvas.Draw(win, pixel.IM.Moved(canvas.Bounds().Center()))
-			canvas.Clear(colornames.Black)
-		}
-	default:
-		{
-			imd.Draw(canvas)
-			canvas.Draw(win, pixel.IM.Moved(canvas.Bounds().Center()))
-			canvas.Clear(colornames.Black)
-		}
+	if session.ControlsVisible() {
+		canvas.Draw(win, pixel.IM.Moved(canvas.Bounds().Center()))
+		control.Clear(color.RGBA{85, 90, 99, 90})
+		updateControlStatus()
+		drawControls(control, match, win, sprites)
+		drawFrameBar(control, match, txt)
+		control.Draw(win, pixel.IM.Moved(control.Bounds().Center()))
+		canvas.Clear(colornames.Black)
+	} else {
+		drawMenuIcon(canvas)
+		canvas.Draw(win, pixel.IM.Moved(canvas.Bounds().Center()))
+		canvas.Clear(colornames.Black)
 	}
 
-	imd.Clear()
 	win.Update()
 
 }
 
-func checkMouse(win *pixelgl.Window, controlCanvas *pixelgl.Canvas, mouseIn chan bool, speed int, match *game.Match) {
-	controls["FastForward"].Status = none
-	controls["Rewind"].Status = none
+// Handles the mouse on the playback controls. It runs on the main thread like
+// all other input, the session is only changed through commands.
+func checkMouse(win *pixelgl.Window, controlCanvas *pixelgl.Canvas) {
 	mouse1 := pixelgl.MouseButton1
+	hovered := false
 	if win.MouseInsideWindow() {
 		mousePos := win.MousePosition()
 		if controlCanvas.Bounds().Contains(mousePos) {
-			loadCtrl = true
+			hovered = true
 			if win.Pressed(mouse1) {
-				mousePress(mousePos, speed, match, controlCanvas)
+				mousePress(mousePos, controlCanvas)
 			} else if win.JustReleased(mouse1) {
-				mouseClicks(mousePos, match, controlCanvas)
-			}
-		} else {
-			if !staticCtrl {
-				loadCtrl = false
+				mouseClicks(mousePos, controlCanvas)
 			}
 		}
-
-	} else {
-		if !staticCtrl {
-			loadCtrl = false
-		}
 	}
-	mouseIn <- loadCtrl
-
+	session.SetControlsHovered(hovered)
 }
 
 func makeSprites(sheet pixel.Picture, rects map[string]pixel.Rect) map[string]*pixel.Sprite {
@@ -693,16 +533,6 @@ func makeSprites(sheet pixel.Picture, rects map[string]pixel.Rect) map[string]*p
 	}
 	return sprites
 }
-func makeAllSprites(sheet pixel.Picture, rects map[string]pixel.Rect) map[string]*pixel.Sprite {
-	sprites := make(map[string]*pixel.Sprite)
-	for n, s := range rects {
-		name := n
-		rect := s
-		newSprite := pixel.NewSprite(sheet, rect)
-		sprites[name] = newSprite
-	}
-	return sprites
-}
 
 func createControls(ctrls map[string]*pixel.Sprite) {
 	for n, c := range ctrls {
@@ -724,58 +554,44 @@ func createControls(ctrls map[string]*pixel.Sprite) {
 
 }
 
-func resume() {
-	paused = !paused
-	play := controls["Play"]
-	play.Status = selected
-}
-
-func fastForward(speed int, match *game.Match) {
-	if curFrame+match.FrameRateRounded+speed > len(match.States)-1 {
-		curFrame = len(match.States) - 1
-	} else {
-		curFrame += match.FrameRateRounded + speed
-	}
-
-}
-
-func rewind(speed int, match *game.Match) {
-	if curFrame < match.FrameRateRounded+speed {
-		curFrame = 0
-	} else {
-		curFrame -= match.FrameRateRounded + speed
-	}
-}
-
-func mousePress(mousePos pixel.Vec, speed int, match *game.Match, canvas *pixelgl.Canvas) {
+func mousePress(mousePos pixel.Vec, canvas *pixelgl.Canvas) {
 	rewindPos := ctrlPosRect(canvas, rewindCtrl)
 	fastforwardPos := ctrlPosRect(canvas, fastForwardCtrl)
 	if rewindPos.Contains(mousePos) {
-		controls["Rewind"].Status = selected
-		rewind(speed, match)
+		session.Handle(viewer.Rewind)
 	}
 	if fastforwardPos.Contains(mousePos) {
-		controls["FastForward"].Status = selected
-		fastForward(speed, match)
+		session.Handle(viewer.FastForward)
 	}
 }
 
-func mouseClicks(mousePos pixel.Vec, game *game.Match, canvas *pixelgl.Canvas) {
+func mouseClicks(mousePos pixel.Vec, canvas *pixelgl.Canvas) {
 	if playBar.Contains(mousePos) {
-		totalFramesPerc := float64(match.TotalFrames) / 100
-		newFramePerc := mousePos.X / (playBar.W() / 100)
-		newFrame := newFramePerc * totalFramesPerc
-		curFrame = int(newFrame)
+		session.SeekFraction(mousePos.X / playBar.W())
 	}
 	playPos := ctrlPosRect(canvas, playPauseCtrl)
 	menuPos := ctrlPosRect(canvas, menuCtrl)
 	//"Play", "Pause", "Rewind", "FastForward", "barsHorizontal"
 	if playPos.Contains(mousePos) {
-		resume()
+		session.Handle(viewer.TogglePause)
 	}
 	if menuPos.Contains(mousePos) {
-		controls["barsHorizontal"].Status = selected
-		ctrlToggle()
+		session.Handle(viewer.ToggleControls)
+	}
+}
+
+// Shows the controls as selected the way the session reports them
+func updateControlStatus() {
+	for name, c := range map[string]viewer.Control{
+		"Play":           viewer.ControlPlay,
+		"Rewind":         viewer.ControlRewind,
+		"FastForward":    viewer.ControlFastForward,
+		"barsHorizontal": viewer.ControlMenu,
+	} {
+		controls[name].Status = none
+		if session.Selected(c) {
+			controls[name].Status = selected
+		}
 	}
 }
 
@@ -788,17 +604,3 @@ func ctrlPosRect(canvas *pixelgl.Canvas, ctrl *ocom.Control) pixel.Rect {
 	maxY := ctrlCenter.Y + ((ctrl.Rect.H() / 2) * ctrl.Scale)
 	return pixel.R(minX, minY, maxX, maxY)
 }
-
-func ctrlToggle() {
-	ctrl := controls["barsHorizontal"]
-	if !staticCtrl {
-		loadCtrl = true
-		staticCtrl = true
-		ctrl.Status = selected
-
-	} else {
-		staticCtrl = false
-		ctrl.Status = none
-	}
-
-}
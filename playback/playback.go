@@ -0,0 +1,283 @@
+// Package playback keeps the playback position of a replay on a clock of its
+// own, so playback speed doesn't depend on how fast frames are rendered.
+package playback
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// MinSpeed is the slowest supported playback speed.
+	MinSpeed = 0.1
+	// MaxSpeed is the fastest supported playback speed.
+	MaxSpeed = 16
+)
+
+// speeds are the steps of Faster and Slower.
+var speeds = []float64{MinSpeed, .25, .5, 1, 2, 4, 8, MaxSpeed}
+
+// Timeline maps frames to the time elapsed since the first frame.
+// match.Timeline implements it.
+type Timeline interface {
+	// Time returns the time elapsed between the first frame and the frame.
+	Time(frame int) time.Duration
+	// FrameAt returns the first frame at or after the elapsed time.
+	FrameAt(elapsed time.Duration) int
+	// FramePosition returns the last frame at or before the elapsed time and
+	// how far the time is on the way to the next frame, from 0 to 1.
+	FramePosition(elapsed time.Duration) (frame int, fraction float64)
+	// Duration returns the time between the first and the last frame.
+	Duration() time.Duration
+}
+
+// Controller is the playback position of a replay. While playing, the
+// position advances with the time passed on the clock, multiplied by the
+// playback speed. Controller is safe for concurrent use.
+type Controller struct {
+	mu       sync.Mutex
+	timeline Timeline
+	now      func() time.Time
+
+	// position at anchor
+	position time.Duration
+	anchor   time.Time
+	speed    float64
+	reverse  bool
+	paused   bool
+}
+
+// NewController returns a paused controller at the first frame of the
+// timeline, running at normal speed.
+func NewController(timeline Timeline) *Controller {
+	return NewControllerClock(timeline, time.Now)
+}
+
+// NewControllerClock is like NewController, but reads the time from now
+// instead of the system clock.
+func NewControllerClock(timeline Timeline, now func() time.Time) *Controller {
+	return &Controller{
+		timeline: timeline,
+		now:      now,
+		anchor:   now(),
+		speed:    1,
+		paused:   true,
+	}
+}
+
+// advance moves the position to the current time of the clock. It pauses
+// playback when it reaches the start or end of the timeline.
+func (c *Controller) advance() {
+	now := c.now()
+	if !c.paused {
+		elapsed := time.Duration(float64(now.Sub(c.anchor)) * c.speed)
+		if c.reverse {
+			elapsed = -elapsed
+		}
+		c.position += elapsed
+	}
+	c.anchor = now
+
+	if c.position <= 0 {
+		c.position = 0
+		if c.reverse {
+			c.paused = true
+		}
+	}
+	if end := c.timeline.Duration(); c.position >= end {
+		c.position = end
+		if !c.reverse {
+			c.paused = true
+		}
+	}
+}
+
+// Position returns the time elapsed between the first frame and the playback
+// position.
+func (c *Controller) Position() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advance()
+	return c.position
+}
+
+// Frame returns the frame shown at the playback position, which is the last
+// frame at or before it.
+func (c *Controller) Frame() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advance()
+	return c.frame()
+}
+
+// FramePosition returns the frame shown at the playback position and how far
+// the position is on the way to the next frame, from 0 at the frame to 1 at
+// the next one.
+func (c *Controller) FramePosition() (frame int, fraction float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advance()
+	return c.timeline.FramePosition(c.position)
+}
+
+func (c *Controller) frame() int {
+	frame, _ := c.timeline.FramePosition(c.position)
+	return frame
+}
+
+// Paused reports whether playback is paused.
+func (c *Controller) Paused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advance()
+	return c.paused
+}
+
+// Play resumes playback. Playing forward from the end of the timeline, or
+// backwards from its start, starts over.
+func (c *Controller) Play() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advance()
+	c.play()
+}
+
+func (c *Controller) play() {
+	if !c.reverse && c.position >= c.timeline.Duration() {
+		c.position = 0
+	}
+	if c.reverse && c.position <= 0 {
+		c.position = c.timeline.Duration()
+	}
+	c.paused = false
+}
+
+// Pause stops playback at the current position.
+func (c *Controller) Pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advance()
+	c.paused = true
+}
+
+// Toggle pauses playback if it is playing and resumes it otherwise.
+func (c *Controller) Toggle() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advance()
+	if c.paused {
+		c.play()
+	} else {
+		c.paused = true
+	}
+}
+
+// Speed returns the playback speed, 1 being real time.
+func (c *Controller) Speed() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.speed
+}
+
+// SetSpeed sets the playback speed, limited to MinSpeed and MaxSpeed.
+func (c *Controller) SetSpeed(speed float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advance()
+	if speed < MinSpeed {
+		speed = MinSpeed
+	}
+	if speed > MaxSpeed {
+		speed = MaxSpeed
+	}
+	c.speed = speed
+}
+
+// Faster sets the playback speed to the next faster step.
+func (c *Controller) Faster() {
+	speed := c.Speed()
+	for _, step := range speeds {
+		if step > speed {
+			c.SetSpeed(step)
+			return
+		}
+	}
+}
+
+// Slower sets the playback speed to the next slower step.
+func (c *Controller) Slower() {
+	speed := c.Speed()
+	for i := len(speeds) - 1; i >= 0; i-- {
+		if speeds[i] < speed {
+			c.SetSpeed(speeds[i])
+			return
+		}
+	}
+}
+
+// Reverse reports whether playback runs backwards.
+func (c *Controller) Reverse() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reverse
+}
+
+// SetReverse sets whether playback runs backwards.
+func (c *Controller) SetReverse(reverse bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advance()
+	c.reverse = reverse
+}
+
+// Step pauses playback and moves the position by the number of frames,
+// backwards if frames is negative.
+func (c *Controller) Step(frames int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advance()
+	c.paused = true
+	c.seekFrame(c.frame() + frames)
+}
+
+// Seek moves the position to the time elapsed since the first frame.
+func (c *Controller) Seek(position time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advance()
+	c.seek(position)
+}
+
+// SeekBy moves the position by d, backwards if d is negative.
+func (c *Controller) SeekBy(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advance()
+	c.seek(c.position + d)
+}
+
+// SeekFrame moves the position to the frame.
+func (c *Controller) SeekFrame(frame int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advance()
+	c.seekFrame(frame)
+}
+
+func (c *Controller) seekFrame(frame int) {
+	if frame < 0 {
+		frame = 0
+	}
+	c.seek(c.timeline.Time(frame))
+}
+
+// seek sets the position, limited to the timeline.
+func (c *Controller) seek(position time.Duration) {
+	if position < 0 {
+		position = 0
+	}
+	if end := c.timeline.Duration(); position > end {
+		position = end
+	}
+	c.position = position
+}
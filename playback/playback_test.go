@@ -0,0 +1,245 @@
+package playback
+
+import (
+	"testing"
+	"time"
+)
+
+// frameLength is the time between two frames of testTimeline.
+const frameLength = 100 * time.Millisecond
+
+// testTimeline has frames every frameLength, from 0 up to last.
+type testTimeline struct {
+	last int
+}
+
+func (t testTimeline) clamp(frame int) int {
+	if frame < 0 {
+		return 0
+	}
+	if frame > t.last {
+		return t.last
+	}
+	return frame
+}
+
+func (t testTimeline) Time(frame int) time.Duration {
+	return time.Duration(t.clamp(frame)) * frameLength
+}
+
+func (t testTimeline) FrameAt(elapsed time.Duration) int {
+	return t.clamp(int((elapsed + frameLength - 1) / frameLength))
+}
+
+func (t testTimeline) Duration() time.Duration {
+	return t.Time(t.last)
+}
+
+func (t testTimeline) FramePosition(elapsed time.Duration) (frame int, fraction float64) {
+	frame = t.clamp(int(elapsed / frameLength))
+	if frame < t.last {
+		fraction = float64(elapsed-t.Time(frame)) / float64(frameLength)
+	}
+	if fraction < 0 {
+		fraction = 0
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+	return frame, fraction
+}
+
+// fakeClock is a clock that only moves when told to.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// newTestController returns a paused controller on a timeline of 1 second
+// with 11 frames.
+func newTestController() (*Controller, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	return NewControllerClock(testTimeline{last: 10}, clock.Now), clock
+}
+
+func checkPosition(t *testing.T, c *Controller, want time.Duration) {
+	t.Helper()
+	if got := c.Position(); got != want {
+		t.Errorf("got position %v, want %v", got, want)
+	}
+}
+
+func TestControllerPlayPause(t *testing.T) {
+	c, clock := newTestController()
+	if !c.Paused() {
+		t.Error("new controller is playing")
+	}
+	clock.Advance(time.Second)
+	checkPosition(t, c, 0)
+
+	c.Play()
+	clock.Advance(350 * time.Millisecond)
+	checkPosition(t, c, 350*time.Millisecond)
+	if frame, fraction := c.FramePosition(); frame != 3 || fraction != .5 {
+		t.Errorf("got frame %d and fraction %v, want 3 and 0.5", frame, fraction)
+	}
+
+	c.Pause()
+	clock.Advance(time.Second)
+	checkPosition(t, c, 350*time.Millisecond)
+
+	c.Toggle()
+	clock.Advance(100 * time.Millisecond)
+	checkPosition(t, c, 450*time.Millisecond)
+	c.Toggle()
+	if !c.Paused() {
+		t.Error("toggle didn't pause")
+	}
+}
+
+func TestControllerSpeed(t *testing.T) {
+	c, clock := newTestController()
+	c.SetSpeed(2)
+	c.Play()
+	clock.Advance(100 * time.Millisecond)
+	checkPosition(t, c, 200*time.Millisecond)
+
+	// changing the speed keeps the position reached so far
+	c.SetSpeed(.5)
+	clock.Advance(200 * time.Millisecond)
+	checkPosition(t, c, 300*time.Millisecond)
+
+	c.SetSpeed(100)
+	if got := c.Speed(); got != MaxSpeed {
+		t.Errorf("got speed %v, want %v", got, MaxSpeed)
+	}
+	c.Faster()
+	if got := c.Speed(); got != MaxSpeed {
+		t.Errorf("got speed %v after Faster at the maximum, want %v", got, MaxSpeed)
+	}
+	c.SetSpeed(0)
+	if got := c.Speed(); got != MinSpeed {
+		t.Errorf("got speed %v, want %v", got, MinSpeed)
+	}
+	c.Slower()
+	if got := c.Speed(); got != MinSpeed {
+		t.Errorf("got speed %v after Slower at the minimum, want %v", got, MinSpeed)
+	}
+
+	c.SetSpeed(1)
+	c.Faster()
+	if got := c.Speed(); got != 2 {
+		t.Errorf("got speed %v after Faster, want 2", got)
+	}
+	c.Slower()
+	c.Slower()
+	if got := c.Speed(); got != .5 {
+		t.Errorf("got speed %v after Slower twice, want 0.5", got)
+	}
+}
+
+func TestControllerReverse(t *testing.T) {
+	c, clock := newTestController()
+	c.Seek(500 * time.Millisecond)
+	c.SetReverse(true)
+	c.Play()
+	clock.Advance(200 * time.Millisecond)
+	checkPosition(t, c, 300*time.Millisecond)
+
+	// playback stops at the start
+	clock.Advance(time.Second)
+	checkPosition(t, c, 0)
+	if !c.Paused() {
+		t.Error("reverse playback didn't stop at the start")
+	}
+
+	// and starts over from the end
+	c.Play()
+	checkPosition(t, c, time.Second)
+	clock.Advance(100 * time.Millisecond)
+	checkPosition(t, c, 900*time.Millisecond)
+}
+
+func TestControllerEnd(t *testing.T) {
+	c, clock := newTestController()
+	c.Seek(800 * time.Millisecond)
+	c.Play()
+	clock.Advance(time.Second)
+	checkPosition(t, c, time.Second)
+	if !c.Paused() {
+		t.Error("playback didn't stop at the end")
+	}
+	if frame, fraction := c.FramePosition(); frame != 10 || fraction != 0 {
+		t.Errorf("got frame %d and fraction %v at the end, want 10 and 0", frame, fraction)
+	}
+
+	// playing at the end starts over
+	c.Play()
+	checkPosition(t, c, 0)
+}
+
+func TestControllerSeek(t *testing.T) {
+	c, _ := newTestController()
+	tests := []struct {
+		name string
+		seek func()
+		want time.Duration
+	}{
+		{"before start", func() { c.Seek(-time.Second) }, 0},
+		{"after end", func() { c.Seek(5 * time.Second) }, time.Second},
+		{"by", func() { c.Seek(500 * time.Millisecond); c.SeekBy(200 * time.Millisecond) }, 700 * time.Millisecond},
+		{"by before start", func() { c.SeekBy(-5 * time.Second) }, 0},
+		{"by after end", func() { c.SeekBy(5 * time.Second) }, time.Second},
+		{"frame", func() { c.SeekFrame(4) }, 400 * time.Millisecond},
+		{"frame before start", func() { c.SeekFrame(-3) }, 0},
+		{"frame after end", func() { c.SeekFrame(100) }, time.Second},
+	}
+	for _, test := range tests {
+		test.seek()
+		if got := c.Position(); got != test.want {
+			t.Errorf("seek %v: got position %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestControllerStep(t *testing.T) {
+	c, clock := newTestController()
+	c.Play()
+	clock.Advance(250 * time.Millisecond)
+	c.Step(1)
+	if !c.Paused() {
+		t.Error("step didn't pause")
+	}
+	if got := c.Frame(); got != 3 {
+		t.Errorf("got frame %d after stepping forward, want 3", got)
+	}
+	c.Step(-5)
+	if got := c.Frame(); got != 0 {
+		t.Errorf("got frame %d after stepping before the start, want 0", got)
+	}
+	c.Step(20)
+	if got := c.Frame(); got != 10 {
+		t.Errorf("got frame %d after stepping past the end, want 10", got)
+	}
+}
+
+func TestControllerFramePosition(t *testing.T) {
+	c, _ := newTestController()
+	for position := -50 * time.Millisecond; position <= 1050*time.Millisecond; position += 10 * time.Millisecond {
+		c.Seek(position)
+		frame, fraction := c.FramePosition()
+		if fraction < 0 || fraction > 1 {
+			t.Errorf("got fraction %v at %v", fraction, position)
+		}
+		if got := c.Frame(); got != frame {
+			t.Errorf("Frame() = %d, but FramePosition() = %d at %v", got, frame, position)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/freetype/truetype"
+	game "github.com/lwayneh/dem-replay/match"
+	"github.com/lwayneh/dem-replay/render"
+)
+
+// renderCommand renders a single tick of a demo into a PNG file without
+// opening a window.
+func renderCommand(args []string) error {
+	flags := flag.NewFlagSet("render", flag.ExitOnError)
+	configFlags(flags)
+	tick := flags.Int("tick", 0, "Ingame tick to render, the first tick of the demo if 0")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: ./dem-replay render [flags] [path to demo, - to read from stdin] [output .png]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errors.New("render needs a demo and an output file")
+	}
+
+	match, scene, err := openScene(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	frame := 0
+	if *tick > 0 {
+		frame = match.Timeline().FrameOfTick(*tick)
+	}
+
+	backend := render.NewImage(render.Width, render.Height, loadFont(conf.FontPath))
+	scene.Draw(backend, frame, 0)
+	return writePNG(flags.Arg(1), backend.RGBA())
+}
+
+// openScene parses the demo and prepares drawing it without a window.
+func openScene(demoFileName string) (*game.Match, *render.Scene, error) {
+	opts := game.Options{
+		FallbackFrameRate: conf.FrameRate,
+		FallbackTickRate:  conf.TickRate,
+		CacheDir:          conf.CacheDir,
+		StatesPerSecond:   conf.StatesPerSecond,
+	}
+	match, err := openMatch(context.Background(), demoFileName, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("trying to parse demo file: %w", err)
+	}
+	scene, err := newScene(match)
+	if err != nil {
+		return nil, nil, err
+	}
+	return match, scene, nil
+}
+
+// newScene prepares drawing the match on the overview of its map with the
+// icons of the info bars.
+func newScene(match *game.Match) (*render.Scene, error) {
+	overview, err := loadOverview(match.MapName)
+	if err != nil {
+		return nil, err
+	}
+	icons, err := render.LoadIcons("infoBar.png", "infoBar.csv")
+	if err != nil {
+		log.Println("drawing without icons:", err)
+	}
+	return render.NewScene(match, overview, icons)
+}
+
+// loadOverview loads the overview image of the map from the overview
+// directory.
+func loadOverview(mapName string) (image.Image, error) {
+	overview, err := render.LoadImage(filepath.Join(conf.OverviewDir, fmt.Sprintf("%v.jpg", mapName)))
+	if err != nil {
+		return nil, fmt.Errorf("trying to load map overview: %w", err)
+	}
+	return overview, nil
+}
+
+// loadFont loads a TTF font file. Text is drawn with a built-in font if it
+// can't be loaded.
+func loadFont(path string) *truetype.Font {
+	bytes, err := ioutil.ReadFile(path)
+	if err == nil {
+		var font *truetype.Font
+		font, err = truetype.Parse(bytes)
+		if err == nil {
+			return font
+		}
+	}
+	log.Println("drawing text with the built-in font:", err)
+	return nil
+}
+
+func writePNG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
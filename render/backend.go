@@ -0,0 +1,39 @@
+// Package render draws the 2D overview of a match without a window. The
+// drawing primitives are behind the Backend interface, so the same scene can
+// be drawn into an image or any other target.
+package render
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/golang/geo/r2"
+)
+
+// Backend draws primitives. Coordinates are in pixels, with the origin in the
+// top left corner and y growing downwards. A thickness of 0 fills a shape
+// instead of outlining it.
+type Backend interface {
+	// Bounds returns the area that can be drawn in.
+	Bounds() r2.Rect
+	// Clear fills the whole area with the color.
+	Clear(c color.Color)
+	// Image draws the image scaled by scale, centered at center.
+	Image(img image.Image, center r2.Point, scale float64)
+	// Circle draws a circle around center.
+	Circle(center r2.Point, radius, thickness float64, c color.Color)
+	// Arc draws a part of a circle outline from angle start to end, in
+	// radians counted clockwise from 12 o'clock.
+	Arc(center r2.Point, radius, start, end, thickness float64, c color.Color)
+	// Line draws a line through the points.
+	Line(points []r2.Point, thickness float64, c color.Color)
+	// Polygon fills the polygon with the corners.
+	Polygon(points []r2.Point, c color.Color)
+	// Rect draws the rectangle.
+	Rect(rect r2.Rect, thickness float64, c color.Color)
+	// Text draws the text with its baseline starting at dot and returns the
+	// position after the text.
+	Text(dot r2.Point, size float64, c color.Color, s string) r2.Point
+	// TextWidth returns the width of the text if drawn at the size.
+	TextWidth(size float64, s string) float64
+}
@@ -0,0 +1,172 @@
+package render
+
+import (
+	"bufio"
+	"compress/lzw"
+	"errors"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"io"
+)
+
+// ErrNoFrames is returned when closing a GIFEncoder without frames.
+var ErrNoFrames = errors.New("gif has no frames")
+
+// GIFEncoder writes an animated GIF frame by frame, so only the frame being
+// written is held in memory, unlike gif.EncodeAll. Frames are reduced to the
+// Plan 9 palette with Floyd-Steinberg dithering, which avoids the banding of
+// matching every pixel to its nearest color on the gradients of overviews.
+type GIFEncoder struct {
+	w *bufio.Writer
+	// frame is reused for every frame
+	frame  *image.Paletted
+	frames int
+	err    error
+}
+
+// NewGIFEncoder returns an encoder of frames of the size. The animation loops
+// forever.
+func NewGIFEncoder(w io.Writer, width, height int) *GIFEncoder {
+	return &GIFEncoder{
+		w:     bufio.NewWriter(w),
+		frame: image.NewPaletted(image.Rect(0, 0, width, height), palette.Plan9),
+	}
+}
+
+// Encode writes the image as the next frame, shown for delay hundredths of a
+// second. It has to have the size of the encoder.
+func (e *GIFEncoder) Encode(img image.Image, delay int) error {
+	if e.err != nil {
+		return e.err
+	}
+	bounds := e.frame.Bounds()
+	if img.Bounds().Size() != bounds.Size() {
+		return fmt.Errorf("frame of %v doesn't fit into a gif of %v", img.Bounds().Size(), bounds.Size())
+	}
+	if e.frames == 0 {
+		e.writeHeader()
+	}
+	draw.FloydSteinberg.Draw(e.frame, bounds, img, img.Bounds().Min)
+
+	// graphic control extension with the delay
+	e.write(0x21, 0xf9, 0x04, 0x00)
+	e.writeUint16(delay)
+	e.write(0x00, 0x00)
+	// image descriptor of the whole screen, using the global color table
+	e.write(0x2c)
+	e.writeUint16(0)
+	e.writeUint16(0)
+	e.writeUint16(bounds.Dx())
+	e.writeUint16(bounds.Dy())
+	e.write(0x00)
+	// the minimum code size of 256 colors
+	e.write(0x08)
+	blocks := &blockWriter{w: e.w}
+	lzwWriter := lzw.NewWriter(blocks, lzw.LSB, 8)
+	if _, err := lzwWriter.Write(e.frame.Pix); err != nil && e.err == nil {
+		e.err = err
+	}
+	if err := lzwWriter.Close(); err != nil && e.err == nil {
+		e.err = err
+	}
+	if err := blocks.close(); err != nil && e.err == nil {
+		e.err = err
+	}
+	e.frames++
+	return e.err
+}
+
+// Close writes the end of the GIF. It doesn't close the underlying writer.
+func (e *GIFEncoder) Close() error {
+	if e.err != nil {
+		return e.err
+	}
+	if e.frames == 0 {
+		return ErrNoFrames
+	}
+	e.write(0x3b)
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+// writeHeader writes the header with the palette as global color table and
+// the extension that loops the animation.
+func (e *GIFEncoder) writeHeader() {
+	size := e.frame.Bounds().Size()
+	e.writeString("GIF89a")
+	e.writeUint16(size.X)
+	e.writeUint16(size.Y)
+	// global color table of 2^(7+1) colors with 8 bits per channel
+	e.write(0xf7, 0x00, 0x00)
+	for _, c := range e.frame.Palette {
+		r, g, b, _ := c.RGBA()
+		e.write(byte(r>>8), byte(g>>8), byte(b>>8))
+	}
+	e.write(0x21, 0xff, 0x0b)
+	e.writeString("NETSCAPE2.0")
+	// loop forever
+	e.write(0x03, 0x01, 0x00, 0x00, 0x00)
+}
+
+func (e *GIFEncoder) write(b ...byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+func (e *GIFEncoder) writeString(s string) {
+	if e.err == nil {
+		_, e.err = e.w.WriteString(s)
+	}
+}
+
+func (e *GIFEncoder) writeUint16(v int) {
+	e.write(byte(v), byte(v>>8))
+}
+
+// blockWriter splits image data into the sub-blocks of at most 255 bytes GIF
+// stores it in.
+type blockWriter struct {
+	w   io.Writer
+	buf [256]byte
+	n   int
+}
+
+func (b *blockWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := copy(b.buf[1+b.n:], p)
+		b.n += n
+		written += n
+		p = p[n:]
+		if b.n == 255 {
+			if err := b.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (b *blockWriter) flush() error {
+	if b.n == 0 {
+		return nil
+	}
+	b.buf[0] = byte(b.n)
+	_, err := b.w.Write(b.buf[:1+b.n])
+	b.n = 0
+	return err
+}
+
+// close writes the last sub-block and the terminator of the data.
+func (b *blockWriter) close() error {
+	if err := b.flush(); err != nil {
+		return err
+	}
+	_, err := b.w.Write([]byte{0x00})
+	return err
+}
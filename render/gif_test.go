@@ -0,0 +1,63 @@
+package render
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"testing"
+)
+
+func TestGIFEncoder(t *testing.T) {
+	colors := []color.RGBA{
+		{255, 0, 0, 255},
+		{0, 255, 0, 255},
+		{0, 0, 255, 255},
+	}
+	var buf bytes.Buffer
+	encoder := NewGIFEncoder(&buf, 300, 200)
+	for i, c := range colors {
+		img := image.NewRGBA(image.Rect(0, 0, 300, 200))
+		draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+		if err := encoder.Encode(img, 6+i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	anim, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != len(colors) {
+		t.Fatalf("got %d frames, want %d", len(anim.Image), len(colors))
+	}
+	if anim.LoopCount != 0 {
+		t.Errorf("got loop count %d, want 0 to loop forever", anim.LoopCount)
+	}
+	for i, frame := range anim.Image {
+		if frame.Bounds() != image.Rect(0, 0, 300, 200) {
+			t.Errorf("frame %d: got bounds %v", i, frame.Bounds())
+		}
+		if anim.Delay[i] != 6+i {
+			t.Errorf("frame %d: got delay %d, want %d", i, anim.Delay[i], 6+i)
+		}
+		if !similar(frame.At(150, 100), colors[i]) {
+			t.Errorf("frame %d: got %v, want %v", i, frame.At(150, 100), colors[i])
+		}
+	}
+}
+
+func TestGIFEncoderErrors(t *testing.T) {
+	var buf bytes.Buffer
+	encoder := NewGIFEncoder(&buf, 300, 200)
+	if err := encoder.Encode(image.NewRGBA(image.Rect(0, 0, 100, 100)), 6); err == nil {
+		t.Error("encoded a frame of the wrong size")
+	}
+	if err := encoder.Close(); err != ErrNoFrames {
+		t.Errorf("got %v closing without frames, want %v", err, ErrNoFrames)
+	}
+}
@@ -0,0 +1,75 @@
+package render
+
+import (
+	"encoding/csv"
+	"image"
+	_ "image/jpeg" // overview images
+	_ "image/png"  // sprite sheets
+	"io"
+	"os"
+	"strconv"
+)
+
+// subImager is implemented by all image types of the standard library.
+type subImager interface {
+	SubImage(r image.Rectangle) image.Image
+}
+
+// LoadImage loads a .png or .jpg image.
+func LoadImage(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	return img, err
+}
+
+// LoadIcons loads the icons of a sprite sheet by their names. Every line of
+// the description is a name followed by x, y, width and height of the icon
+// in the sheet.
+func LoadIcons(sheetPath, descriptionPath string) (map[string]image.Image, error) {
+	sheet, err := LoadImage(sheetPath)
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := sheet.(subImager)
+	if !ok {
+		rgba := image.NewRGBA(sheet.Bounds())
+		for y := sheet.Bounds().Min.Y; y < sheet.Bounds().Max.Y; y++ {
+			for x := sheet.Bounds().Min.X; x < sheet.Bounds().Max.X; x++ {
+				rgba.Set(x, y, sheet.At(x, y))
+			}
+		}
+		sub = rgba
+	}
+
+	descriptionFile, err := os.Open(descriptionPath)
+	if err != nil {
+		return nil, err
+	}
+	defer descriptionFile.Close()
+
+	icons := make(map[string]image.Image)
+	description := csv.NewReader(descriptionFile)
+	for {
+		record, err := description.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var rect [4]int
+		for i := range rect {
+			rect[i], err = strconv.Atoi(record[i+1])
+			if err != nil {
+				return nil, err
+			}
+		}
+		min := sheet.Bounds().Min.Add(image.Pt(rect[0], rect[1]))
+		icons[record[0]] = sub.SubImage(image.Rectangle{Min: min, Max: min.Add(image.Pt(rect[2], rect[3]))})
+	}
+	return icons, nil
+}
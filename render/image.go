@@ -0,0 +1,205 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sync"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/golang/geo/r2"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// circleSegments is the number of straight segments a full circle is made of.
+const circleSegments = 64
+
+// Image is a Backend drawing into an image.RGBA in pure Go, so it works
+// without a display or OpenGL.
+type Image struct {
+	rgba *image.RGBA
+	ttf  *truetype.Font
+
+	facesMu sync.Mutex
+	faces   map[float64]font.Face
+}
+
+// NewImage returns a backend drawing into a new image of the size. Text is
+// drawn with the font, or with a small fixed size font if ttf is nil.
+func NewImage(width, height int, ttf *truetype.Font) *Image {
+	return &Image{
+		rgba:  image.NewRGBA(image.Rect(0, 0, width, height)),
+		ttf:   ttf,
+		faces: make(map[float64]font.Face),
+	}
+}
+
+// RGBA returns the image drawn into.
+func (b *Image) RGBA() *image.RGBA {
+	return b.rgba
+}
+
+// Bounds implements Backend.
+func (b *Image) Bounds() r2.Rect {
+	size := b.rgba.Bounds().Size()
+	return r2.RectFromPoints(r2.Point{}, r2.Point{X: float64(size.X), Y: float64(size.Y)})
+}
+
+// Clear implements Backend.
+func (b *Image) Clear(c color.Color) {
+	draw.Draw(b.rgba, b.rgba.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+}
+
+// Image implements Backend.
+func (b *Image) Image(img image.Image, center r2.Point, scale float64) {
+	size := img.Bounds().Size()
+	w, h := float64(size.X)*scale, float64(size.Y)*scale
+	dst := image.Rect(
+		int(math.Round(center.X-w/2)), int(math.Round(center.Y-h/2)),
+		int(math.Round(center.X+w/2)), int(math.Round(center.Y+h/2)),
+	)
+	if scale == 1 {
+		draw.Draw(b.rgba, dst, img, img.Bounds().Min, draw.Over)
+		return
+	}
+	xdraw.ApproxBiLinear.Scale(b.rgba, dst, img, img.Bounds(), draw.Over, nil)
+}
+
+// Circle implements Backend.
+func (b *Image) Circle(center r2.Point, radius, thickness float64, c color.Color) {
+	if thickness <= 0 {
+		b.fill(c, circle(center, radius, 0, 2*math.Pi))
+		return
+	}
+	outer := circle(center, radius+thickness/2, 0, 2*math.Pi)
+	inner := circle(center, math.Max(radius-thickness/2, 0), 0, 2*math.Pi)
+	// the inner path runs the other way and cuts a hole into the outer one
+	for i, j := 0, len(inner)-1; i < j; i, j = i+1, j-1 {
+		inner[i], inner[j] = inner[j], inner[i]
+	}
+	b.fill(c, outer, inner)
+}
+
+// Arc implements Backend.
+func (b *Image) Arc(center r2.Point, radius, start, end, thickness float64, c color.Color) {
+	b.Line(circle(center, radius, start, end), thickness, c)
+}
+
+// Line implements Backend.
+func (b *Image) Line(points []r2.Point, thickness float64, c color.Color) {
+	if thickness <= 0 {
+		thickness = 1
+	}
+	quads := make([][]r2.Point, 0, len(points))
+	for i := 1; i < len(points); i++ {
+		from, to := points[i-1], points[i]
+		dir := to.Sub(from)
+		if dir.Norm() == 0 {
+			continue
+		}
+		n := dir.Normalize().Ortho().Mul(thickness / 2)
+		quads = append(quads, []r2.Point{from.Add(n), to.Add(n), to.Sub(n), from.Sub(n)})
+	}
+	b.fill(c, quads...)
+}
+
+// Polygon implements Backend.
+func (b *Image) Polygon(points []r2.Point, c color.Color) {
+	b.fill(c, points)
+}
+
+// Rect implements Backend.
+func (b *Image) Rect(rect r2.Rect, thickness float64, c color.Color) {
+	corners := []r2.Point{rect.Lo(), {X: rect.X.Hi, Y: rect.Y.Lo}, rect.Hi(), {X: rect.X.Lo, Y: rect.Y.Hi}}
+	if thickness <= 0 {
+		b.fill(c, corners)
+		return
+	}
+	b.Line(append(corners, corners[0]), thickness, c)
+}
+
+// Text implements Backend.
+func (b *Image) Text(dot r2.Point, size float64, c color.Color, s string) r2.Point {
+	d := font.Drawer{
+		Dst:  b.rgba,
+		Src:  image.NewUniform(c),
+		Face: b.face(size),
+		Dot:  fixed.Point26_6{X: fixed.Int26_6(dot.X * 64), Y: fixed.Int26_6(dot.Y * 64)},
+	}
+	d.DrawString(s)
+	return r2.Point{X: float64(d.Dot.X) / 64, Y: dot.Y}
+}
+
+// TextWidth implements Backend.
+func (b *Image) TextWidth(size float64, s string) float64 {
+	return float64(font.MeasureString(b.face(size), s)) / 64
+}
+
+func (b *Image) face(size float64) font.Face {
+	if b.ttf == nil {
+		return basicfont.Face7x13
+	}
+	b.facesMu.Lock()
+	defer b.facesMu.Unlock()
+	face, ok := b.faces[size]
+	if !ok {
+		face = truetype.NewFace(b.ttf, &truetype.Options{Size: size})
+		b.faces[size] = face
+	}
+	return face
+}
+
+// fill fills the paths with antialiasing. Overlapping paths running in the
+// same direction are merged, paths running in opposite directions cut holes
+// into each other.
+func (b *Image) fill(c color.Color, paths ...[]r2.Point) {
+	bounds := image.Rectangle{}
+	for _, path := range paths {
+		for _, p := range path {
+			bounds = bounds.Union(image.Rect(int(math.Floor(p.X)), int(math.Floor(p.Y)), int(math.Ceil(p.X))+1, int(math.Ceil(p.Y))+1))
+		}
+	}
+	bounds = bounds.Intersect(b.rgba.Bounds())
+	if bounds.Empty() {
+		return
+	}
+
+	// rasterize only the area covered by the paths
+	z := vector.NewRasterizer(bounds.Dx(), bounds.Dy())
+	offset := r2.Point{X: float64(bounds.Min.X), Y: float64(bounds.Min.Y)}
+	for _, path := range paths {
+		if len(path) < 3 {
+			continue
+		}
+		for i, p := range path {
+			p = p.Sub(offset)
+			if i == 0 {
+				z.MoveTo(float32(p.X), float32(p.Y))
+			} else {
+				z.LineTo(float32(p.X), float32(p.Y))
+			}
+		}
+		z.ClosePath()
+	}
+	z.Draw(b.rgba, bounds, image.NewUniform(c), image.Point{})
+}
+
+// circle returns the points on a circle from angle start to end, in radians
+// counted clockwise from 12 o'clock.
+func circle(center r2.Point, radius, start, end float64) []r2.Point {
+	segments := int(math.Ceil(math.Abs(end-start) / (2 * math.Pi) * circleSegments))
+	if segments < 1 {
+		segments = 1
+	}
+	points := make([]r2.Point, segments+1)
+	for i := range points {
+		angle := start + (end-start)*float64(i)/float64(segments)
+		points[i] = r2.Point{X: center.X + radius*math.Sin(angle), Y: center.Y - radius*math.Cos(angle)}
+	}
+	return points
+}
@@ -0,0 +1,141 @@
+package render
+
+import (
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/geo/r2"
+	"golang.org/x/image/colornames"
+)
+
+var update = flag.Bool("update", false, "update the golden images in testdata")
+
+// tolerance is how far the channels of a pixel may be off from the golden
+// image, e.g. by rounding differences of the rasterizer between platforms.
+const tolerance = 8
+
+// checkGolden compares the image to testdata/name.png, or writes it there
+// with -update.
+func checkGolden(t *testing.T, name string, got *image.RGBA) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".png")
+	if *update {
+		if err := writeTestPNG(path, got); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("%v, run the tests with -update to create it", err)
+	}
+	defer file.Close()
+	want, err := png.Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Bounds() != want.Bounds() {
+		t.Fatalf("got an image of %v, want %v", got.Bounds(), want.Bounds())
+	}
+
+	differing := 0
+	first := image.Point{}
+	for y := got.Bounds().Min.Y; y < got.Bounds().Max.Y; y++ {
+		for x := got.Bounds().Min.X; x < got.Bounds().Max.X; x++ {
+			if !similar(got.At(x, y), want.At(x, y)) {
+				if differing == 0 {
+					first = image.Pt(x, y)
+				}
+				differing++
+			}
+		}
+	}
+	if differing == 0 {
+		return
+	}
+	out, err := ioutil.TempFile("", name+"-*.png")
+	if err == nil {
+		out.Close()
+		err = writeTestPNG(out.Name(), got)
+	}
+	if err != nil {
+		t.Fatalf("%d pixels differ from %v, starting at %v", differing, path, first)
+	}
+	t.Fatalf("%d pixels differ from %v, starting at %v, got %v", differing, path, first, out.Name())
+}
+
+func similar(a, b color.Color) bool {
+	ar, ag, ab, aa := a.RGBA()
+	br, bg, bb, ba := b.RGBA()
+	for _, d := range []float64{
+		float64(ar) - float64(br), float64(ag) - float64(bg),
+		float64(ab) - float64(bb), float64(aa) - float64(ba),
+	} {
+		// RGBA returns 16 bit channels
+		if math.Abs(d) > tolerance*0x101 {
+			return false
+		}
+	}
+	return true
+}
+
+func writeTestPNG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// testIcon returns an icon of the size with a border, so scaling shows.
+func testIcon(width, height int, c color.Color) *image.RGBA {
+	icon := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x == 0 || y == 0 || x == width-1 || y == height-1 {
+				icon.Set(x, y, colornames.White)
+			} else {
+				icon.Set(x, y, c)
+			}
+		}
+	}
+	return icon
+}
+
+func TestImagePrimitives(t *testing.T) {
+	b := NewImage(240, 160, nil)
+	if got, want := b.Bounds(), r2.RectFromPoints(r2.Point{}, r2.Point{X: 240, Y: 160}); got != want {
+		t.Errorf("got bounds %v, want %v", got, want)
+	}
+
+	b.Clear(colornames.Black)
+	b.Circle(r2.Point{X: 30, Y: 30}, 20, 0, colornames.Dodgerblue)
+	b.Circle(r2.Point{X: 80, Y: 30}, 20, 3, colornames.Darkorange)
+	b.Arc(r2.Point{X: 130, Y: 30}, 20, 0, math.Pi*3/2, 2, colornames.Limegreen)
+	b.Line([]r2.Point{{X: 160, Y: 10}, {X: 230, Y: 50}, {X: 170, Y: 50}}, 2.5, colornames.Crimson)
+	b.Polygon([]r2.Point{{X: 10, Y: 70}, {X: 60, Y: 70}, {X: 35, Y: 110}}, color.NRGBA{255, 69, 0, 140})
+	b.Rect(r2.RectFromPoints(r2.Point{X: 70, Y: 70}, r2.Point{X: 110, Y: 110}), 0, color.RGBA{85, 90, 99, 230})
+	b.Rect(r2.RectFromPoints(r2.Point{X: 70, Y: 70}, r2.Point{X: 110, Y: 110}), 1, colornames.White)
+	b.Image(testIcon(20, 10, colornames.Salmon), r2.Point{X: 140, Y: 80}, 1)
+	b.Image(testIcon(20, 10, colornames.Salmon), r2.Point{X: 190, Y: 80}, 2)
+
+	dot := b.Text(r2.Point{X: 10, Y: 140}, 13, colornames.Greenyellow, "$800")
+	if want := 10 + b.TextWidth(13, "$800"); dot.X != want || dot.Y != 140 {
+		t.Errorf("text ended at %v, want x %v", dot, want)
+	}
+	b.Text(dot, 13, colornames.Ghostwhite, " K: 1 A: 0 D: 2")
+
+	checkGolden(t, "primitives", b.RGBA())
+}
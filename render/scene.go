@@ -0,0 +1,590 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/geo/r2"
+	"github.com/golang/geo/r3"
+	ocom "github.com/lwayneh/dem-replay/common"
+	"github.com/lwayneh/dem-replay/match"
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	meta "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/metadata"
+	"golang.org/x/image/colornames"
+)
+
+// Layout of a rendered frame: the info bars of the counter-terrorists, the
+// map overview and the info bars of the terrorists next to each other.
+const (
+	Width  = 1624
+	Height = 1024
+
+	mapXOffset     = 300
+	mapSize        = 1024
+	infoBarWidth   = 300
+	infoBarHeight  = 110
+	radiusPlayer   = 10
+	radiusSmoke    = 25
+	radiusGrenade  = 3
+	killfeedY      = 624
+	killfeedSize   = 6
+	killfeedHeight = 26
+	timerY         = 724
+)
+
+var (
+	colorTerror  = colornames.Darkorange
+	colorCounter = colornames.Dodgerblue
+	colorPanel   = color.RGBA{85, 90, 99, 230}
+
+	// blinded players are drawn white while more than this is remaining
+	flashed = 500 * time.Millisecond
+)
+
+// ErrUnknownMap is returned for matches on maps without overview metadata.
+var ErrUnknownMap = errors.New("no overview metadata for map")
+
+// Scene draws frames of a match.
+type Scene struct {
+	// ShowGrenadeArcs draws the arcs of all grenades of the round instead of
+	// only the ones in flight.
+	ShowGrenadeArcs bool
+
+	match    *match.Match
+	overview image.Image
+	icons    map[string]image.Image
+	mapMeta  meta.Map
+	teamOne  ocom.Clan
+	teamTwo  ocom.Clan
+}
+
+// NewScene returns a scene of the match on the overview image of its map.
+// Icons are the sprites of weapons, equipment and the bomb by their names in
+// infoBar.csv; icons that are missing are left out or replaced by text.
+func NewScene(m *match.Match, overview image.Image, icons map[string]image.Image) (*Scene, error) {
+	mapMeta, ok := meta.MapNameToMap[m.MapName]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrUnknownMap, m.MapName)
+	}
+	if icons == nil {
+		icons = make(map[string]image.Image)
+	}
+	teamOne, teamTwo := m.GetTeamTags()
+	return &Scene{
+		match:    m,
+		overview: overview,
+		icons:    icons,
+		mapMeta:  mapMeta,
+		teamOne:  teamOne,
+		teamTwo:  teamTwo,
+	}, nil
+}
+
+// Draw draws the state between the frame and the next one, see
+// match.InterpolatedState.
+func (s *Scene) Draw(b Backend, frame int, fraction float64) {
+	s.DrawState(b, s.match.InterpolatedState(frame, fraction), frame)
+}
+
+// DrawState draws the state with the events of the frame, e.g. the state a
+// viewer.Session shows.
+func (s *Scene) DrawState(b Backend, state ocom.OverviewState, frame int) {
+	b.Clear(colornames.Black)
+	if s.overview != nil {
+		b.Image(s.overview, r2.Point{X: mapXOffset + mapSize/2, Y: mapSize / 2}, 1)
+	}
+
+	s.drawInfoBars(b, state, frame)
+	s.drawKills(b, state, frame)
+	s.drawScore(b, state)
+
+	for _, shot := range s.match.ShotsAt(frame) {
+		s.drawShot(b, shot)
+	}
+	for _, effect := range s.match.GrenadeEffectsAt(frame) {
+		s.drawGrenadeEffect(b, effect)
+	}
+	for _, inferno := range state.Infernos {
+		s.drawInferno(b, inferno)
+	}
+	for _, player := range state.Players {
+		s.drawPlayer(b, player, frame)
+	}
+	s.drawFlashLinks(b, state, frame)
+	arcs := s.match.GrenadesInFlight(frame)
+	if s.ShowGrenadeArcs {
+		arcs = s.match.RoundGrenades(frame)
+	}
+	for _, grenade := range arcs {
+		s.drawTrajectory(b, grenade, frame)
+	}
+	for _, grenade := range state.Grenades {
+		pos := grenade.Trajectory[len(grenade.Trajectory)-1]
+		b.Circle(s.position(pos), radiusGrenade, 0, grenadeColor(grenade.WeaponInstance.Type))
+	}
+	s.drawBomb(b, state, frame)
+	s.drawTimer(b, state.Timer)
+	s.drawRoundDamage(b, state, frame)
+}
+
+// position returns the position in the frame of a position in the world.
+func (s *Scene) position(pos r3.Vector) r2.Point {
+	x, y := s.mapMeta.TranslateScale(pos.X, pos.Y)
+	return r2.Point{X: x + mapXOffset, Y: y}
+}
+
+// direction returns the unit vector of a view direction in degrees.
+func direction(viewDirectionX float32) r2.Point {
+	angle := float64(viewDirectionX) * math.Pi / 180
+	return r2.Point{X: math.Cos(angle), Y: -math.Sin(angle)}
+}
+
+func (s *Scene) drawPlayer(b Backend, player ocom.Player, frame int) {
+	if player.Health <= 0 {
+		return
+	}
+	c := colorCounter
+	if player.Team == common.TeamTerrorists {
+		c = colorTerror
+	}
+	center := s.position(player.LastAlivePosition)
+	dir := direction(player.ViewDirectionX)
+
+	if player.FlashRemaining > flashed {
+		blind := player.FlashRemaining.Seconds() / 5.5
+		b.Circle(center, radiusPlayer-1, 0, color.NRGBA{255, 255, 255, uint8(math.Min(blind, 1) * 255)})
+	}
+	b.Circle(center, radiusPlayer, 1.5, c)
+
+	// the view line shows the active weapon
+	if weapon := player.ActiveWeapon; weapon != nil {
+		switch {
+		case weapon.Type.Class() == common.EqClassGrenade:
+			b.Circle(center.Add(dir.Mul(radiusPlayer+1)), radiusGrenade, 0, grenadeColor(weapon.Type))
+		case weapon.Type == common.EqAWP:
+			b.Line([]r2.Point{center.Add(dir.Mul(radiusPlayer + 1)), center.Add(dir.Mul(28))}, 3.5, colornames.Darkturquoise)
+		default:
+			b.Line([]r2.Point{center.Add(dir.Mul(radiusPlayer + 1)), center.Add(dir.Mul(18))}, 3.5, colornames.Crimson)
+		}
+	}
+
+	for _, w := range player.Weapons() {
+		if w.Type == common.EqBomb {
+			b.Circle(center, radiusPlayer-5, 0, colornames.Salmon)
+		}
+	}
+
+	if player.IsDefusing || player.IsPlanting {
+		for _, action := range s.match.BombActions(frame) {
+			start := action.Start
+			if !ocom.SamePlayer(start.PlayerSteamID, start.PlayerName, player.SteamID64, player.Name) {
+				continue
+			}
+			ring := colornames.Turquoise
+			if start.Type == ocom.BombDefuseStart && start.HasKit {
+				ring = colornames.Limegreen
+			}
+			b.Arc(center, radiusPlayer+3, 0, action.Progress*2*math.Pi, 2, ring)
+		}
+	}
+
+	b.Text(center.Add(r2.Point{X: radiusPlayer + 2, Y: -radiusPlayer}), 12, colornames.Floralwhite, s.shortName(player))
+}
+
+func (s *Scene) drawShot(b Backend, shot ocom.Shot) {
+	c := colornames.Floralwhite
+	if shot.IsAwpShot {
+		c = colornames.Crimson
+	}
+	from := s.position(shot.Position)
+	dir := direction(shot.ViewDirectionX)
+	b.Line([]r2.Point{from.Add(dir.Mul(radiusPlayer + 1)), from.Add(dir.Mul(1400))}, 1, c)
+}
+
+func (s *Scene) drawGrenadeEffect(b Backend, effect ocom.GrenadeEffect) {
+	center := s.position(effect.Position)
+	switch effect.GrenadeType {
+	case common.EqSmoke:
+		b.Circle(center, radiusSmoke, 0, color.NRGBA{128, 128, 128, 200})
+	case common.EqFlash:
+		b.Circle(center, 15, 0, color.NRGBA{255, 250, 240, 160})
+	case common.EqHE:
+		b.Circle(center, 15, 0, color.NRGBA{247, 203, 43, 160})
+	case common.EqDecoy:
+		b.Circle(center, 5, 1, colornames.Saddlebrown)
+	}
+}
+
+func (s *Scene) drawInferno(b Backend, inferno ocom.Inferno) {
+	points := make([]r2.Point, len(inferno.ConvexHull))
+	for i, p := range inferno.ConvexHull {
+		points[i] = s.position(r3.Vector{X: p.X, Y: p.Y})
+	}
+	b.Polygon(points, color.NRGBA{255, 69, 0, 140})
+}
+
+// drawFlashLinks connects popped flashbangs to the players they blinded for
+// as long as they are blind. Team flashes are drawn red.
+func (s *Scene) drawFlashLinks(b Backend, state ocom.OverviewState, frame int) {
+	for _, flash := range s.match.ActiveFlashes(frame) {
+		from := s.position(flash.DetonatePosition)
+		for _, blinded := range flash.Flashed {
+			for _, player := range state.Players {
+				if !ocom.SamePlayer(player.SteamID64, player.Name, blinded.PlayerSteamID, blinded.PlayerName) || player.FlashRemaining <= 0 {
+					continue
+				}
+				c := colornames.Floralwhite
+				if flash.IsTeamFlash(blinded) || flash.IsSelfFlash(blinded) {
+					c = colornames.Red
+				}
+				b.Line([]r2.Point{from, s.position(player.LastAlivePosition)}, 1, c)
+			}
+		}
+	}
+}
+
+// drawTrajectory draws the path of the grenade up to the frame. Arcs of
+// grenades that already detonated are drawn faded.
+func (s *Scene) drawTrajectory(b Backend, grenade *ocom.Grenade, frame int) {
+	points := make([]r2.Point, 0, len(grenade.Trajectory))
+	for _, point := range grenade.Trajectory {
+		if point.Frame > frame {
+			break
+		}
+		points = append(points, s.position(point.Position))
+	}
+	c := grenadeColor(grenade.Type)
+	if !grenade.InFlight(frame) {
+		c = fade(c, .4)
+	}
+	b.Line(points, 1, c)
+}
+
+func (s *Scene) drawBomb(b Backend, state ocom.OverviewState, frame int) {
+	center := s.position(state.Bomb.Position())
+	name := ""
+	if last, ok := s.match.LastBombEvent(frame); ok && last.Type == ocom.BombDefused {
+		name = "bombDefused"
+	} else if state.Timer.Phase == ocom.PhasePlanted {
+		name = "bombRed"
+	} else if state.Bomb.Carrier == nil {
+		name = "bombCarry"
+	}
+	if name == "" {
+		return
+	}
+	if icon, ok := s.icons[name]; ok {
+		b.Image(icon, center, .5)
+		return
+	}
+	b.Rect(r2.RectFromCenterSize(center, r2.Point{X: 10, Y: 10}), 0, colornames.Red)
+}
+
+func (s *Scene) drawTimer(b Backend, timer ocom.Timer) {
+	text := "Warm Up"
+	c := colornames.Floralwhite
+	if timer.Phase != ocom.PhaseWarmup {
+		seconds := int(timer.TimeRemaining.Seconds())
+		text = fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+		switch timer.Phase {
+		case ocom.PhasePlanted:
+			c = colornames.Red
+		case ocom.PhaseRestart:
+			c = colornames.Greenyellow
+		}
+	}
+	b.Text(r2.Point{X: 10, Y: timerY}, 24, c, text)
+}
+
+func (s *Scene) drawScore(b Backend, state ocom.OverviewState) {
+	const size = 20
+	ct := fmt.Sprintf("%v:%d  ", state.TeamCounterTerrorists.ClanName, state.TeamCounterTerrorists.Score)
+	t := fmt.Sprintf("  %v:%d", state.TeamTerrorists.ClanName, state.TeamTerrorists.Score)
+	width := b.TextWidth(size, ct) + b.TextWidth(size, t)
+	center := float64(mapXOffset + mapSize/2)
+	box := r2.RectFromPoints(r2.Point{X: center - width/2 - 8, Y: 2}, r2.Point{X: center + width/2 + 8, Y: 40})
+	b.Rect(box, 0, colorPanel)
+	b.Rect(box, 1, colornames.White)
+	dot := b.Text(r2.Point{X: center - width/2, Y: 28}, size, colorCounter, ct)
+	b.Text(dot, size, colorTerror, t)
+}
+
+// drawRoundDamage lists the damage each player dealt to enemies on the
+// overview once the round at the frame has ended.
+func (s *Scene) drawRoundDamage(b Backend, state ocom.OverviewState, frame int) {
+	const (
+		size       = 13
+		lineHeight = 20
+	)
+	roundIndex := s.match.RoundIndexAt(frame)
+	if roundIndex == -1 {
+		return
+	}
+	round := s.match.Rounds[roundIndex]
+	if round.EndFrame == -1 || frame < round.EndFrame {
+		return
+	}
+
+	type summary struct {
+		name    string
+		team    common.Team
+		total   int
+		victims []string
+	}
+	summaries := make([]*summary, 0)
+	byName := make(map[string]*summary)
+	for _, d := range s.match.RoundDamage(roundIndex) {
+		if d.AttackerTeam == common.TeamUnassigned || d.AttackerTeam == d.VictimTeam {
+			continue
+		}
+		sum, ok := byName[d.AttackerName]
+		if !ok {
+			sum = &summary{name: d.AttackerName, team: d.AttackerTeam}
+			byName[d.AttackerName] = sum
+			summaries = append(summaries, sum)
+		}
+		sum.total += d.HealthDamage
+		sum.victims = append(sum.victims, fmt.Sprintf("%v %d", s.shortNameOf(state, d.VictimName), d.HealthDamage))
+	}
+	if len(summaries) == 0 {
+		return
+	}
+	sort.SliceStable(summaries, func(i, j int) bool {
+		if summaries[i].team != summaries[j].team {
+			return summaries[i].team > summaries[j].team
+		}
+		return summaries[i].total > summaries[j].total
+	})
+
+	totals := make([]string, len(summaries))
+	victims := make([]string, len(summaries))
+	width := 0.0
+	for i, sum := range summaries {
+		totals[i] = fmt.Sprintf("%v: %d", s.shortNameOf(state, sum.name), sum.total)
+		victims[i] = fmt.Sprintf("  (%v)", strings.Join(sum.victims, ", "))
+		width = math.Max(width, b.TextWidth(size, totals[i])+b.TextWidth(size, victims[i]))
+	}
+	topLeft := r2.Point{X: mapXOffset + 20, Y: float64(mapSize/2 - len(summaries)*lineHeight/2)}
+	bottomRight := topLeft.Add(r2.Point{X: width, Y: float64(len(summaries) * lineHeight)})
+	b.Rect(r2.RectFromPoints(topLeft.Sub(r2.Point{X: 8, Y: 8}), bottomRight.Add(r2.Point{X: 8, Y: 8})), 0, color.RGBA{85, 90, 99, 200})
+	for i, sum := range summaries {
+		dot := b.Text(topLeft.Add(r2.Point{Y: float64((i+1)*lineHeight) - 5}), size, teamColor(sum.team), totals[i])
+		b.Text(dot, size, colornames.Ghostwhite, victims[i])
+	}
+}
+
+// drawKills draws the killfeed next to the overview.
+func (s *Scene) drawKills(b Backend, state ocom.OverviewState, frame int) {
+	const size = 13
+	kills := s.match.KillsAt(frame)
+	if len(kills) > killfeedSize {
+		kills = kills[len(kills)-killfeedSize:]
+	}
+	y := float64(killfeedY)
+	for _, kill := range kills {
+		killer := s.shortNameOf(state, kill.KillerName)
+		if kill.AssisterName != "" {
+			killer += " + " + s.shortNameOf(state, kill.AssisterName)
+		}
+		b.Rect(r2.RectFromPoints(r2.Point{X: mapXOffset + mapSize, Y: y - killfeedHeight + 6}, r2.Point{X: Width, Y: y + 6}), 0, colorPanel)
+		dot := b.Text(r2.Point{X: mapXOffset + mapSize + 4, Y: y}, size, teamColor(kill.KillerTeam), killer)
+		dot.X += 4
+
+		icons := make([]string, 0)
+		if kill.IsFlashAssist || kill.AttackerBlind {
+			icons = append(icons, "Flashbang")
+		}
+		icons = append(icons, kill.Weapon)
+		if kill.NoScope {
+			icons = append(icons, "crosshair")
+		}
+		if kill.ThroughSmoke {
+			icons = append(icons, "Smoke Grenade")
+		}
+		if kill.IsWallbang() {
+			icons = append(icons, "penetrate")
+		}
+		if kill.IsHeadshot {
+			icons = append(icons, "headshot")
+		}
+		for _, name := range icons {
+			dot.X = s.drawKillIcon(b, name, dot, size)
+		}
+
+		b.Text(dot, size, teamColor(kill.VictimTeam), s.shortNameOf(state, kill.VictimName))
+		y += killfeedHeight
+	}
+}
+
+// drawKillIcon draws the icon with its left edge at the dot, or its name if
+// there is no icon, and returns the x coordinate for the next icon.
+func (s *Scene) drawKillIcon(b Backend, name string, dot r2.Point, size float64) float64 {
+	icon, ok := s.icons[name]
+	if !ok {
+		return b.Text(dot, size, colornames.Ghostwhite, "["+name+"]").X + 4
+	}
+	scale := 16 / float64(icon.Bounds().Dy())
+	width := float64(icon.Bounds().Dx()) * scale
+	b.Image(icon, r2.Point{X: dot.X + width/2, Y: dot.Y - 5}, scale)
+	return dot.X + width + 4
+}
+
+func (s *Scene) drawInfoBars(b Backend, state ocom.OverviewState, frame int) {
+	var cts, ts []ocom.Player
+	for _, player := range state.Players {
+		switch player.Team {
+		case common.TeamCounterTerrorists:
+			cts = append(cts, player)
+		case common.TeamTerrorists:
+			ts = append(ts, player)
+		}
+	}
+	sort.Slice(cts, func(i, j int) bool { return cts[i].SteamID64 < cts[j].SteamID64 })
+	sort.Slice(ts, func(i, j int) bool { return ts[i].SteamID64 < ts[j].SteamID64 })
+	for i, player := range cts {
+		s.drawInfoBar(b, player, r2.Point{X: 0, Y: float64(i * infoBarHeight)}, colorCounter, frame)
+	}
+	for i, player := range ts {
+		s.drawInfoBar(b, player, r2.Point{X: mapXOffset + mapSize, Y: float64(i * infoBarHeight)}, colorTerror, frame)
+	}
+}
+
+// drawInfoBar draws the health, money, stats and equipment of the player in
+// the info bar with its top left corner at pos.
+func (s *Scene) drawInfoBar(b Backend, player ocom.Player, pos r2.Point, c color.Color, frame int) {
+	const size = 14
+	text := func(dx, dy float64, c color.Color, s string) {
+		b.Text(pos.Add(r2.Point{X: dx, Y: dy}), size, c, s)
+	}
+	stats := fmt.Sprintf("K: %d A: %d D: %d ADR: %d", player.Kills, player.Assists, player.Deaths, int(s.match.ADR(player.SteamID64, player.Name, frame)))
+	flashes := s.match.FlashStatsOf(player.SteamID64, player.Name, frame)
+	flashSummary := fmt.Sprintf("EF: %d TF: %d Blind: %.1fs", flashes.EnemiesFlashed, flashes.TeammatesFlashed, flashes.EnemyBlindTime.Seconds())
+
+	if player.Health <= 0 {
+		faded := color.NRGBA{255, 255, 255, 128}
+		text(4, 18, faded, s.shortName(player))
+		text(240, 18, faded, "HP: 0")
+		text(4, 40, faded, fmt.Sprintf("$%d  %v", player.Money, flashSummary))
+		text(4, 62, faded, stats)
+		return
+	}
+
+	b.Line([]r2.Point{pos, pos.Add(r2.Point{X: float64(player.Health) * infoBarWidth / 100})}, 3, c)
+	text(4, 18, colornames.Ghostwhite, s.shortName(player))
+	hp := colornames.Ghostwhite
+	switch {
+	case player.Health < 30:
+		hp = colornames.Red
+	case player.Health < 50:
+		hp = colornames.Darkorange
+	case player.Health < 75:
+		hp = colornames.Yellow
+	}
+	text(240, 18, hp, fmt.Sprintf("HP: %d", player.Health))
+	dot := b.Text(pos.Add(r2.Point{X: 4, Y: 40}), size, colornames.Greenyellow, fmt.Sprintf("$%d", player.Money))
+	b.Text(dot, size, colornames.Ghostwhite, "  "+flashSummary)
+	text(4, 62, colornames.Ghostwhite, stats)
+
+	// equipment
+	x := 4.0
+	icon := func(name string) {
+		if img, ok := s.icons[name]; ok {
+			scale := 18 / float64(img.Bounds().Dy())
+			width := float64(img.Bounds().Dx()) * scale
+			b.Image(img, pos.Add(r2.Point{X: x + width/2, Y: 88}), scale)
+			x += width + 6
+			return
+		}
+		dot := b.Text(pos.Add(r2.Point{X: x, Y: 94}), 11, colornames.Ghostwhite, name)
+		x = dot.X - pos.X + 6
+	}
+	weapons := player.Weapons()
+	sort.Slice(weapons, func(i, j int) bool { return weapons[i].Type > weapons[j].Type })
+	for _, w := range weapons {
+		switch w.Class() {
+		case common.EqClassSMG, common.EqClassHeavy, common.EqClassRifle, common.EqClassPistols:
+			icon(w.String())
+		}
+	}
+	if player.Armor > 0 && player.Helmet {
+		icon("armor_helmet")
+	} else if player.Armor > 0 {
+		icon("armor")
+	}
+	if player.Kit {
+		icon("defuser")
+	}
+	for _, w := range weapons {
+		if w.Type == common.EqBomb {
+			icon("bombCarry")
+		}
+	}
+	for _, grenade := range player.Grenades {
+		switch grenade {
+		case common.EqMolotov, common.EqIncendiary:
+			icon("molotov")
+		default:
+			icon(grenade.String())
+		}
+	}
+}
+
+// shortName returns the name of the player without the tag of its team.
+func (s *Scene) shortName(player ocom.Player) string {
+	if player.ClanName == s.teamOne.ClanName {
+		return strings.Replace(player.Name, s.teamOne.Tag, "", 1)
+	}
+	if player.ClanName == s.teamTwo.ClanName {
+		return strings.Replace(player.Name, s.teamTwo.Tag, "", 1)
+	}
+	return player.Name
+}
+
+func (s *Scene) shortNameOf(state ocom.OverviewState, name string) string {
+	for _, player := range state.Players {
+		if player.Name == name {
+			return s.shortName(player)
+		}
+	}
+	return name
+}
+
+func teamColor(team common.Team) color.Color {
+	switch team {
+	case common.TeamCounterTerrorists:
+		return colorCounter
+	case common.TeamTerrorists:
+		return colorTerror
+	}
+	return colornames.Ghostwhite
+}
+
+func grenadeColor(grenadeType common.EquipmentType) color.RGBA {
+	switch grenadeType {
+	case common.EqDecoy:
+		return colornames.Saddlebrown
+	case common.EqMolotov, common.EqIncendiary:
+		return colornames.Orangered
+	case common.EqFlash:
+		return colornames.Floralwhite
+	case common.EqSmoke:
+		return colornames.Darkgray
+	case common.EqHE:
+		return colornames.Lawngreen
+	}
+	return colornames.Floralwhite
+}
+
+// fade returns the color with its opacity multiplied by alpha.
+func fade(c color.RGBA, alpha float64) color.RGBA {
+	scale := func(v uint8) uint8 {
+		return uint8(float64(v) * alpha)
+	}
+	return color.RGBA{scale(c.R), scale(c.G), scale(c.B), scale(c.A)}
+}
@@ -0,0 +1,243 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r2"
+	ocom "github.com/lwayneh/dem-replay/common"
+	"github.com/lwayneh/dem-replay/match"
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	"golang.org/x/image/colornames"
+)
+
+const (
+	teamT  = int(common.TeamTerrorists)
+	teamCT = int(common.TeamCounterTerrorists)
+)
+
+// testPlayer returns a player in the middle of de_dust2, moved by dx and dy
+// world units.
+func testPlayer(name string, steamID uint64, team int, dx, dy float32) match.JSONPlayer {
+	return match.JSONPlayer{
+		Name:         name,
+		SteamID:      steamID,
+		UserID:       int(steamID),
+		Team:         team,
+		X:            -223 + dx,
+		Y:            986 + dy,
+		ViewX:        float32(steamID * 70),
+		Health:       100,
+		Armor:        100,
+		Money:        800 * int(steamID),
+		Connected:    true,
+		Helmet:       steamID%2 == 0,
+		ActiveWeapon: int(common.EqAK47),
+		Weapons:      []int{int(common.EqKnife), int(common.EqAK47)},
+		Grenades:     []int{int(common.EqFlash), int(common.EqSmoke)},
+	}
+}
+
+func testRef(name string, steamID uint64, team int) match.JSONPlayerRef {
+	return match.JSONPlayerRef{Name: name, SteamID: steamID, Team: team}
+}
+
+// newTestMatch returns a round of 60 frames on de_dust2: a flashbang is
+// thrown at frame 18 and blinds Bravo, Alpha is killed by Charlie at frame 30
+// and the round ends at frame 40.
+func newTestMatch(t *testing.T) *match.Match {
+	t.Helper()
+	alpha, bravo := testRef("Alpha", 1, teamT), testRef("Bravo", 2, teamT)
+	charlie := testRef("Charlie", 3, teamCT)
+	doc := match.JSONMatch{
+		Version:     match.JSONVersion,
+		Map:         "de_dust2",
+		TickRate:    64,
+		FrameRate:   16,
+		DemoFrames:  60,
+		TeamOne:     match.JSONClan{Name: "Orange"},
+		TeamTwo:     match.JSONClan{Name: "Blue"},
+		HalfStarts:  []int{0},
+		RoundStarts: []int{0},
+		Rounds: []match.JSONRound{{
+			Number: 1, StartFrame: 0, FreezeEndFrame: 5, PlantFrame: match.JSONNever, EndFrame: 40, OfficialEndFrame: 55,
+			Winner: teamCT, EndReason: 8, ScoreCT: 1,
+		}},
+		Kills: []match.JSONKill{{
+			Frame: 30, Tick: 120, Killer: charlie, Victim: alpha, Weapon: "AK-47", Headshot: true,
+		}},
+		Shots: []match.JSONShot{{
+			Tick: 116, StartFrame: 29, EndFrame: 31, Position: match.JSONVector{X: -123, Y: 886}, ViewX: 135,
+		}},
+		Damage: []match.JSONDamage{{
+			Frame: 30, Tick: 120, Attacker: charlie, Victim: alpha, Weapon: "AK-47",
+			HitGroup: 1, Health: 112, HealthTaken: 100, Armor: 20,
+		}},
+		Grenades: []match.JSONGrenade{{
+			ID: 1, EntityID: 100, Type: int(common.EqFlash), Thrower: charlie,
+			ThrowFrame: 18, ThrowTick: 72, Throw: match.JSONVector{X: -123, Y: 886},
+			Trajectory: []match.JSONTrajPoint{
+				{Frame: 18, Position: match.JSONVector{X: -123, Y: 886}},
+				{Frame: 20, Position: match.JSONVector{X: -173, Y: 946}},
+				{Frame: 22, Position: match.JSONVector{X: -243, Y: 976}},
+				{Frame: 24, Position: match.JSONVector{X: -303, Y: 966}},
+			},
+			DetonateFrame: 24, DetonateTick: 96, Detonate: match.JSONVector{X: -303, Y: 966}, ExpireFrame: 24,
+			Flashed: []match.JSONFlashedPlayer{{Player: bravo, DurationMs: 3000}},
+		}},
+		GrenadeEffects: []match.JSONGrenadeEffect{{
+			Type: int(common.EqSmoke), EntityID: 101, Position: match.JSONVector{X: -23, Y: 1186},
+			Thrower: charlie, StartFrame: 10, EndFrame: 50,
+		}},
+		BombEvents: make([]match.JSONBombEvent, 0),
+		Samples:    make([]match.JSONSample, 60),
+	}
+	for f := range doc.Samples {
+		step := float32(f)
+		players := []match.JSONPlayer{
+			testPlayer("Alpha", 1, teamT, -200+step, 100),
+			testPlayer("Bravo", 2, teamT, -250+step, -50),
+			testPlayer("Charlie", 3, teamCT, 100, -100+step),
+		}
+		players[1].HasBomb = true
+		if f >= 30 {
+			players[0].Health = 0
+		}
+		if f >= 24 {
+			players[1].FlashMs = 3000 - (f-24)*1000/16
+		}
+		sample := match.JSONSample{
+			Tick:        f * 4,
+			Phase:       1,
+			RemainingMs: 115000 - f*1000/16,
+			ScoreCT:     0,
+			ClanNameCT:  "Blue",
+			ClanNameT:   "Orange",
+			Players:     players,
+		}
+		if f >= 40 {
+			sample.ScoreCT = 1
+		}
+		if f >= 18 && f < 24 {
+			sample.Grenades = []match.JSONProjectile{{ID: 1, Type: int(common.EqFlash), X: -243, Y: 976}}
+		}
+		if f >= 20 {
+			sample.Infernos = []match.JSONInferno{{ID: 2, Hull: []match.JSONPoint{
+				{X: -523, Y: 786}, {X: -443, Y: 786}, {X: -463, Y: 866}, {X: -523, Y: 846},
+			}}}
+		}
+		doc.Samples[f] = sample
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(doc); err != nil {
+		t.Fatal(err)
+	}
+	m, err := match.ReadJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// testOverview returns an overview of large squares, which compress well in
+// the golden images.
+func testOverview() image.Image {
+	overview := image.NewRGBA(image.Rect(0, 0, mapSize, mapSize))
+	for y := 0; y < mapSize; y++ {
+		for x := 0; x < mapSize; x++ {
+			c := color.RGBA{40, 44, 40, 255}
+			if (x/256+y/256)%2 == 0 {
+				c = color.RGBA{60, 56, 48, 255}
+			}
+			overview.SetRGBA(x, y, c)
+		}
+	}
+	return overview
+}
+
+func newTestScene(t *testing.T) *Scene {
+	t.Helper()
+	icons := map[string]image.Image{
+		"AK-47":     testIcon(48, 16, colornames.Gray),
+		"headshot":  testIcon(16, 16, colornames.Red),
+		"bombCarry": testIcon(24, 24, colornames.Salmon),
+	}
+	scene, err := NewScene(newTestMatch(t), testOverview(), icons)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return scene
+}
+
+func TestSceneGolden(t *testing.T) {
+	scene := newTestScene(t)
+	tests := []struct {
+		name     string
+		frame    int
+		fraction float64
+		arcs     bool
+	}{
+		// the flashbang in flight next to the smoke and the fire
+		{"scene-flash", 22, .5, false},
+		// Bravo is blind and the killfeed shows the kill
+		{"scene-kill", 30, 0, false},
+		// the round is over and the damage of the round is listed
+		{"scene-round-end", 45, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := NewImage(Width, Height, nil)
+			scene.ShowGrenadeArcs = test.arcs
+			scene.Draw(b, test.frame, test.fraction)
+			checkGolden(t, test.name, b.RGBA())
+		})
+	}
+}
+
+func TestNewSceneUnknownMap(t *testing.T) {
+	m := newTestMatch(t)
+	m.MapName = "de_unknown"
+	if _, err := NewScene(m, nil, nil); !errors.Is(err, ErrUnknownMap) {
+		t.Errorf("got error %v, want %v", err, ErrUnknownMap)
+	}
+}
+
+// lineCounter counts the lines drawn into an image.
+type lineCounter struct {
+	Backend
+	lines int
+}
+
+func (c *lineCounter) Line(points []r2.Point, thickness float64, col color.Color) {
+	c.lines++
+	c.Backend.Line(points, thickness, col)
+}
+
+// TestFlashLinksBots checks that only the blinded bot is linked to the
+// flashbang.
+func TestFlashLinksBots(t *testing.T) {
+	scene := newTestScene(t)
+	flash := &scene.match.Grenades[0]
+	flash.ThrowerName, flash.ThrowerSteamID = "BotC", 0
+	flash.Flashed = []ocom.FlashedPlayer{{PlayerName: "BotB", PlayerTeam: common.TeamTerrorists, Duration: 3 * time.Second}}
+
+	state := ocom.OverviewState{}
+	for _, name := range []string{"BotA", "BotB", "BotC"} {
+		var p ocom.Player
+		p.Name = name
+		p.Team = common.TeamTerrorists
+		p.FlashRemaining = 2 * time.Second
+		state.Players = append(state.Players, p)
+	}
+	b := &lineCounter{Backend: NewImage(Width, Height, nil)}
+	scene.drawFlashLinks(b, state, 30)
+	if b.lines != 1 {
+		t.Errorf("got %d flash links, want 1", b.lines)
+	}
+}
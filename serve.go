@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+
+	game "github.com/lwayneh/dem-replay/match"
+	"github.com/lwayneh/dem-replay/server"
+)
+
+// serveCommand serves the demos of a directory as a JSON HTTP API.
+func serveCommand(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	configFlags(flags)
+	dir := flags.String("dir", ".", "Directory containing the demos to serve")
+	addr := flags.String("addr", "localhost:8080", "Address to listen on")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: ./dem-replay serve [flags]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return errors.New("serve takes no arguments")
+	}
+
+	opts := game.Options{
+		FallbackFrameRate: conf.FrameRate,
+		FallbackTickRate:  conf.TickRate,
+		CacheDir:          conf.CacheDir,
+		StatesPerSecond:   conf.StatesPerSecond,
+	}
+	log.Printf("serving demos of %v on http://%v/api/matches", *dir, *addr)
+	return http.ListenAndServe(*addr, server.New(*dir, conf.OverviewDir, opts))
+}
@@ -0,0 +1,445 @@
+// Package server serves the matches of a directory of demos as JSON over
+// HTTP. Demos are parsed on the first request and kept in memory, so tools
+// can query them without parsing demos themselves.
+//
+// All endpoints answer GET requests below /api/matches:
+//
+//	/api/matches                     all demos in the directory
+//	/api/matches/{name}              header of the match
+//	/api/matches/{name}/rounds       rounds and their results
+//	/api/matches/{name}/state?tick=  state at the ingame tick
+//	/api/matches/{name}/events?from=&to=
+//	                                 events between two ingame ticks
+//	/api/matches/{name}/players      statistics of every player
+//	/api/matches/{name}/overview     overview image of the map
+//
+// States and events use the schema of match.WriteJSON.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ocom "github.com/lwayneh/dem-replay/common"
+	"github.com/lwayneh/dem-replay/match"
+)
+
+// maxLoaded is the number of parsed matches kept in memory. The match that
+// wasn't used for the longest time is dropped first.
+const maxLoaded = 8
+
+// apiPrefix is the path all endpoints are below.
+const apiPrefix = "/api/matches"
+
+// demoSuffixes are the endings of the file names that are served.
+var demoSuffixes = []string{".dem", ".dem.gz", ".dem.bz2", ".zip", ".json"}
+
+// errNotFound is returned for unknown matches and endpoints.
+var errNotFound = errors.New("not found")
+
+// Server serves the matches of a directory.
+type Server struct {
+	dir         string
+	overviewDir string
+	opts        match.Options
+
+	mu      sync.Mutex
+	matches map[string]*entry
+}
+
+// entry is a match that is being parsed or was parsed.
+type entry struct {
+	// done is closed when parsing finished
+	done     chan struct{}
+	modTime  time.Time
+	lastUsed time.Time
+	match    *match.Match
+	err      error
+}
+
+// New returns a server for the demos in dir. Overviews are loaded from
+// overviewDir. opts.Progress is ignored and opts.CacheDir is used like
+// everywhere else, so demos are only parsed once.
+func New(dir, overviewDir string, opts match.Options) *Server {
+	opts.Progress = nil
+	return &Server{
+		dir:         dir,
+		overviewDir: overviewDir,
+		opts:        opts,
+		matches:     make(map[string]*entry),
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	if r.URL.Path != apiPrefix && !strings.HasPrefix(r.URL.Path, apiPrefix+"/") {
+		writeError(w, http.StatusNotFound, errNotFound)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, apiPrefix), "/"), "/")
+	if parts[0] == "" {
+		s.serveList(w)
+		return
+	}
+	if len(parts) > 2 {
+		writeError(w, http.StatusNotFound, errNotFound)
+		return
+	}
+
+	name := parts[0]
+	m, err := s.load(r.Context(), name)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errNotFound) {
+			status = http.StatusNotFound
+		} else if errors.Is(err, context.Canceled) {
+			return
+		}
+		writeError(w, status, err)
+		return
+	}
+	if m.StateCount() == 0 {
+		writeError(w, http.StatusUnprocessableEntity, errors.New("match contains no states"))
+		return
+	}
+
+	endpoint := ""
+	if len(parts) == 2 {
+		endpoint = parts[1]
+	}
+	switch endpoint {
+	case "":
+		writeJSON(w, newHeader(name, m))
+	case "rounds":
+		events, err := m.JSONEvents(0, m.StateCount())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, events.Rounds)
+	case "state":
+		s.serveState(w, r, m)
+	case "events":
+		s.serveEvents(w, r, m)
+	case "players":
+		writeJSON(w, playerStatsOf(m))
+	case "overview":
+		http.ServeFile(w, r, filepath.Join(s.overviewDir, m.MapName+".jpg"))
+	default:
+		writeError(w, http.StatusNotFound, errNotFound)
+	}
+}
+
+// demoInfo describes a demo in the directory.
+type demoInfo struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	// Loaded is true if the match is parsed and in memory.
+	Loaded bool `json:"loaded"`
+}
+
+func (s *Server) serveList(w http.ResponseWriter) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.mu.Lock()
+	demos := make([]demoInfo, 0, len(files))
+	for _, file := range files {
+		if file.IsDir() || !isDemo(file.Name()) {
+			continue
+		}
+		e, ok := s.matches[file.Name()]
+		demos = append(demos, demoInfo{
+			Name:     file.Name(),
+			Size:     file.Size(),
+			Modified: file.ModTime(),
+			Loaded:   ok && e.modTime.Equal(file.ModTime()) && e.match != nil,
+		})
+	}
+	s.mu.Unlock()
+	writeJSON(w, demos)
+}
+
+// stateResponse is the state of a match at a frame.
+type stateResponse struct {
+	Frame  int              `json:"frame"`
+	Sample match.JSONSample `json:"sample"`
+}
+
+func (s *Server) serveState(w http.ResponseWriter, r *http.Request, m *match.Match) {
+	tick, err := intParam(r, "tick", -1)
+	if err == nil && tick < 0 {
+		err = errors.New("tick is required")
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	frame := m.Timeline().FrameOfTick(tick)
+	writeJSON(w, stateResponse{Frame: frame, Sample: m.JSONSample(frame)})
+}
+
+func (s *Server) serveEvents(w http.ResponseWriter, r *http.Request, m *match.Match) {
+	timeline := m.Timeline()
+	from, err := intParam(r, "from", timeline.Tick(0))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	to, err := intParam(r, "to", timeline.Tick(m.StateCount()-1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if to < from {
+		writeError(w, http.StatusBadRequest, errors.New("to is before from"))
+		return
+	}
+	events, err := m.JSONEvents(timeline.FrameOfTick(from), timeline.FrameOfTick(to)+1)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, events)
+}
+
+// load returns the match of the demo with the name, parsing it if it isn't
+// in memory or the file changed since.
+func (s *Server) load(ctx context.Context, name string) (*match.Match, error) {
+	if name != filepath.Base(name) || strings.HasPrefix(name, ".") || !isDemo(name) {
+		return nil, errNotFound
+	}
+	path := filepath.Join(s.dir, name)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	e, ok := s.matches[name]
+	parse := !ok || !e.modTime.Equal(info.ModTime())
+	if parse {
+		// used now, so evict doesn't drop it as the oldest
+		e = &entry{done: make(chan struct{}), modTime: info.ModTime(), lastUsed: time.Now()}
+		s.matches[name] = e
+		s.evict()
+	} else {
+		e.lastUsed = time.Now()
+	}
+	s.mu.Unlock()
+
+	if parse {
+		// parsing isn't bound to the request, other requests may wait for it
+		m, err := s.parse(path)
+		s.mu.Lock()
+		e.match, e.err = m, err
+		if err != nil {
+			log.Printf("parsing %v: %v", name, err)
+			// the next request parses the file again
+			if s.matches[name] == e {
+				delete(s.matches, name)
+			}
+		}
+		s.mu.Unlock()
+		close(e.done)
+	}
+
+	select {
+	case <-e.done:
+		return e.match, e.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *Server) parse(path string) (*match.Match, error) {
+	if strings.HasSuffix(strings.ToLower(path), ".json") {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return match.ReadJSON(file)
+	}
+	return match.NewMatchContext(context.Background(), path, s.opts)
+}
+
+// evict drops the matches used longest ago until at most maxLoaded are
+// left. The caller must hold mu.
+func (s *Server) evict() {
+	for len(s.matches) > maxLoaded {
+		oldest := ""
+		for name, e := range s.matches {
+			if oldest == "" || e.lastUsed.Before(s.matches[oldest].lastUsed) {
+				oldest = name
+			}
+		}
+		delete(s.matches, oldest)
+	}
+}
+
+// header contains general information about a match.
+type header struct {
+	Name       string         `json:"name"`
+	Version    int            `json:"version"`
+	Map        string         `json:"map"`
+	TickRate   float64        `json:"tickRate"`
+	FrameRate  float64        `json:"frameRate"`
+	Frames     int            `json:"frames"`
+	FirstTick  int            `json:"firstTick"`
+	LastTick   int            `json:"lastTick"`
+	DurationMs int64          `json:"durationMs"`
+	TeamOne    match.JSONClan `json:"teamOne"`
+	TeamTwo    match.JSONClan `json:"teamTwo"`
+	Rounds     int            `json:"rounds"`
+	// ScoreCT and ScoreT are the scores at the end of the demo.
+	ScoreCT int `json:"scoreCT"`
+	ScoreT  int `json:"scoreT"`
+}
+
+func newHeader(name string, m *match.Match) header {
+	timeline := m.Timeline()
+	last := m.StateCount() - 1
+	state := m.State(last)
+	teamOne, teamTwo := m.GetTeamTags()
+	return header{
+		Name:       name,
+		Version:    match.JSONVersion,
+		Map:        m.MapName,
+		TickRate:   m.TickRate,
+		FrameRate:  m.FrameRate,
+		Frames:     m.StateCount(),
+		FirstTick:  timeline.Tick(0),
+		LastTick:   timeline.Tick(last),
+		DurationMs: int64(timeline.Duration() / time.Millisecond),
+		TeamOne:    match.JSONClan{Name: teamOne.ClanName, Tag: teamOne.Tag},
+		TeamTwo:    match.JSONClan{Name: teamTwo.ClanName, Tag: teamTwo.Tag},
+		Rounds:     len(m.Rounds),
+		ScoreCT:    state.TeamCounterTerrorists.Score,
+		ScoreT:     state.TeamTerrorists.Score,
+	}
+}
+
+// playerStats sums up the match of a player.
+type playerStats struct {
+	Name      string  `json:"name"`
+	SteamID   uint64  `json:"steamId,string"`
+	Team      int     `json:"team"`
+	Kills     int     `json:"kills"`
+	Deaths    int     `json:"deaths"`
+	Assists   int     `json:"assists"`
+	Headshots int     `json:"headshots"`
+	ADR       float64 `json:"adr"`
+	// Damage is the health damage dealt to enemies.
+	Damage           int `json:"damage"`
+	FlashesThrown    int `json:"flashesThrown"`
+	EnemiesFlashed   int `json:"enemiesFlashed"`
+	TeammatesFlashed int `json:"teammatesFlashed"`
+	EnemyBlindMs     int `json:"enemyBlindMs"`
+}
+
+// playerStatsOf returns the statistics of all players at the end of the
+// demo, including players that left before it ended.
+func playerStatsOf(m *match.Match) []playerStats {
+	last := m.StateCount() - 1
+	players := m.Players()
+	damage := m.DamageBetween(0, last)
+
+	stats := make([]playerStats, 0, len(players))
+	for _, p := range players {
+		flashes := m.FlashStatsOf(p.SteamID64, p.Name, last)
+		s := playerStats{
+			Name:             p.Name,
+			SteamID:          p.SteamID64,
+			Team:             int(p.Team),
+			Kills:            p.Kills,
+			Deaths:           p.Deaths,
+			Assists:          p.Assists,
+			ADR:              m.ADR(p.SteamID64, p.Name, m.TotalFrames),
+			FlashesThrown:    flashes.Thrown,
+			EnemiesFlashed:   flashes.EnemiesFlashed,
+			TeammatesFlashed: flashes.TeammatesFlashed,
+			EnemyBlindMs:     int(flashes.EnemyBlindTime / time.Millisecond),
+		}
+		for _, kill := range m.Kills {
+			if kill.IsHeadshot && ocom.SamePlayer(kill.KillerSteamID, kill.KillerName, p.SteamID64, p.Name) {
+				s.Headshots++
+			}
+		}
+		for _, d := range damage {
+			if ocom.SamePlayer(d.AttackerSteamID, d.AttackerName, p.SteamID64, p.Name) && d.AttackerTeam != d.VictimTeam {
+				s.Damage += d.HealthDamage
+			}
+		}
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Team != stats[j].Team {
+			return stats[i].Team < stats[j].Team
+		}
+		return stats[i].Kills > stats[j].Kills
+	})
+	return stats
+}
+
+func isDemo(name string) bool {
+	name = strings.ToLower(name)
+	for _, suffix := range demoSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// intParam returns the integer query parameter, or def if it's missing.
+func intParam(r *http.Request, name string, def int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%v is not a number: %q", name, value)
+	}
+	return i, nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("writing response:", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
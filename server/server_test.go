@@ -0,0 +1,345 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lwayneh/dem-replay/match"
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+const (
+	teamT  = int(common.TeamTerrorists)
+	teamCT = int(common.TeamCounterTerrorists)
+)
+
+// testDoc returns a match of 40 frames, 4 ticks apart starting at tick 100,
+// in which the bot Alpha kills the bot Bravo with a headshot at frame 20 and
+// wins the round at frame 30.
+func testDoc() match.JSONMatch {
+	alpha := match.JSONPlayerRef{Name: "Alpha", Team: teamT}
+	bravo := match.JSONPlayerRef{Name: "Bravo", Team: teamCT}
+	doc := match.JSONMatch{
+		Version:     match.JSONVersion,
+		Map:         "de_dust2",
+		TickRate:    64,
+		FrameRate:   16,
+		DemoFrames:  40,
+		HalfStarts:  []int{0},
+		RoundStarts: []int{0},
+		Rounds: []match.JSONRound{{
+			Number: 1, StartFrame: 0, FreezeEndFrame: 5, PlantFrame: match.JSONNever, EndFrame: 30, OfficialEndFrame: match.JSONNever,
+			Winner: teamT, EndReason: 1, ScoreT: 1,
+		}},
+		Kills: []match.JSONKill{{Frame: 20, Tick: 180, Killer: alpha, Victim: bravo, Weapon: "AK-47", Headshot: true}},
+		Damage: []match.JSONDamage{{
+			Frame: 20, Tick: 180, Attacker: alpha, Victim: bravo, Weapon: "AK-47", HitGroup: 1, Health: 112, HealthTaken: 100,
+		}},
+		Shots:          make([]match.JSONShot, 0),
+		Grenades:       make([]match.JSONGrenade, 0),
+		GrenadeEffects: make([]match.JSONGrenadeEffect, 0),
+		BombEvents:     make([]match.JSONBombEvent, 0),
+		Samples:        make([]match.JSONSample, 40),
+	}
+	for f := range doc.Samples {
+		players := []match.JSONPlayer{
+			{Name: "Alpha", IsBot: true, UserID: 1, Team: teamT, X: float32(f), Health: 100, Connected: true},
+			{Name: "Bravo", IsBot: true, UserID: 2, Team: teamCT, Health: 100, Connected: true},
+		}
+		if f >= 20 {
+			players[0].Kills = 1
+			players[1].Health = 0
+			players[1].Deaths = 1
+		}
+		doc.Samples[f] = match.JSONSample{Tick: 100 + f*4, Phase: 1, Players: players}
+		if f >= 30 {
+			doc.Samples[f].ScoreT = 1
+		}
+	}
+	return doc
+}
+
+// newTestServer returns a server of a directory with the JSON matches.
+func newTestServer(t *testing.T, names ...string) (*Server, string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	data, err := json.Marshal(testDoc())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return New(dir, dir, match.Options{}), dir
+}
+
+// get requests the path and decodes the JSON response into v, if it's not
+// nil.
+func get(t *testing.T, s *Server, path string, v interface{}) int {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	if v != nil && w.Code == http.StatusOK {
+		if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+			t.Fatalf("%v: %v", path, err)
+		}
+	}
+	return w.Code
+}
+
+func (s *Server) loaded() map[string]bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	loaded := make(map[string]bool)
+	for name := range s.matches {
+		loaded[name] = true
+	}
+	return loaded
+}
+
+func TestServerEvict(t *testing.T) {
+	names := make([]string, maxLoaded+2)
+	for i := range names {
+		names[i] = fmt.Sprintf("match%d.json", i)
+	}
+	s, _ := newTestServer(t, names...)
+
+	for _, name := range names[:maxLoaded] {
+		if code := get(t, s, apiPrefix+"/"+name, nil); code != http.StatusOK {
+			t.Fatalf("%v: got status %d", name, code)
+		}
+	}
+	// the first match is used again, so the second one is the oldest
+	get(t, s, apiPrefix+"/"+names[0], nil)
+	get(t, s, apiPrefix+"/"+names[maxLoaded], nil)
+	loaded := s.loaded()
+	if len(loaded) != maxLoaded {
+		t.Fatalf("got %d loaded matches, want %d", len(loaded), maxLoaded)
+	}
+	if !loaded[names[maxLoaded]] {
+		t.Errorf("evicted the match that was just loaded")
+	}
+	if !loaded[names[0]] || loaded[names[1]] {
+		t.Errorf("got loaded matches %v, want %v evicted", loaded, names[1])
+	}
+
+	get(t, s, apiPrefix+"/"+names[maxLoaded+1], nil)
+	loaded = s.loaded()
+	if !loaded[names[maxLoaded+1]] || loaded[names[2]] {
+		t.Errorf("got loaded matches %v, want %v evicted", loaded, names[2])
+	}
+}
+
+func TestServerReload(t *testing.T) {
+	s, dir := newTestServer(t, "a.json")
+	first, err := s.load(context.Background(), "a.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := s.load(context.Background(), "a.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != first {
+		t.Error("parsed the match again although the file didn't change")
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "a.json"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := s.load(context.Background(), "a.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed == first {
+		t.Error("didn't parse the match again after the file changed")
+	}
+}
+
+func TestServerList(t *testing.T) {
+	s, dir := newTestServer(t, "b.json", "a.json")
+	if err := ioutil.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	get(t, s, apiPrefix+"/b.json", nil)
+
+	var demos []demoInfo
+	if code := get(t, s, apiPrefix, &demos); code != http.StatusOK {
+		t.Fatalf("got status %d", code)
+	}
+	if len(demos) != 2 || demos[0].Name != "a.json" || demos[1].Name != "b.json" {
+		t.Fatalf("got demos %+v", demos)
+	}
+	if demos[0].Loaded || !demos[1].Loaded {
+		t.Errorf("got loaded %v and %v, want false and true", demos[0].Loaded, demos[1].Loaded)
+	}
+}
+
+func TestServerEndpoints(t *testing.T) {
+	s, _ := newTestServer(t, "a.json")
+	path := apiPrefix + "/a.json"
+
+	var h header
+	if code := get(t, s, path, &h); code != http.StatusOK {
+		t.Fatalf("header: got status %d", code)
+	}
+	want := header{
+		Name: "a.json", Version: match.JSONVersion, Map: "de_dust2", TickRate: 64, FrameRate: 16,
+		Frames: 40, FirstTick: 100, LastTick: 256, DurationMs: 2437, Rounds: 1, ScoreT: 1,
+	}
+	if h != want {
+		t.Errorf("got header %+v, want %+v", h, want)
+	}
+
+	var rounds []match.JSONRound
+	if code := get(t, s, path+"/rounds", &rounds); code != http.StatusOK || len(rounds) != 1 || rounds[0].EndFrame != 30 {
+		t.Errorf("rounds: got status %d and %+v", code, rounds)
+	}
+
+	var state stateResponse
+	if code := get(t, s, path+"/state?tick=121", &state); code != http.StatusOK {
+		t.Fatalf("state: got status %d", code)
+	}
+	if state.Frame != 6 || state.Sample.Tick != 124 || len(state.Sample.Players) != 2 || state.Sample.Players[0].X != 6 {
+		t.Errorf("got state %+v, want frame 6", state)
+	}
+
+	var events match.JSONMatch
+	if code := get(t, s, path+"/events?from=160&to=200", &events); code != http.StatusOK {
+		t.Fatalf("events: got status %d", code)
+	}
+	if len(events.Kills) != 1 || events.Kills[0].Frame != 20 || len(events.Damage) != 1 || len(events.Samples) != 0 {
+		t.Errorf("got events %+v, want the kill and damage at frame 20", events)
+	}
+	if code := get(t, s, path+"/events?from=100&to=160", &events); code != http.StatusOK || len(events.Damage) != 0 {
+		t.Errorf("events before the kill: got status %d and damage %+v", code, events.Damage)
+	}
+
+	var stats []playerStats
+	if code := get(t, s, path+"/players", &stats); code != http.StatusOK {
+		t.Fatalf("players: got status %d", code)
+	}
+	wantStats := []playerStats{
+		{Name: "Alpha", Team: teamT, Kills: 1, Headshots: 1, ADR: 100, Damage: 100},
+		{Name: "Bravo", Team: teamCT, Deaths: 1},
+	}
+	if len(stats) != len(wantStats) || stats[0] != wantStats[0] || stats[1] != wantStats[1] {
+		t.Errorf("got stats %+v, want %+v", stats, wantStats)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	s, _ := newTestServer(t, "a.json")
+	tests := []struct {
+		method, path string
+		code         int
+	}{
+		{http.MethodPost, apiPrefix, http.StatusMethodNotAllowed},
+		{http.MethodGet, "/other", http.StatusNotFound},
+		{http.MethodGet, apiPrefix + "/missing.json", http.StatusNotFound},
+		{http.MethodGet, apiPrefix + "/notes.txt", http.StatusNotFound},
+		{http.MethodGet, apiPrefix + "/..%2fa.json", http.StatusNotFound},
+		{http.MethodGet, apiPrefix + "/a.json/unknown", http.StatusNotFound},
+		{http.MethodGet, apiPrefix + "/a.json/state/1", http.StatusNotFound},
+		{http.MethodGet, apiPrefix + "/a.json/state", http.StatusBadRequest},
+		{http.MethodGet, apiPrefix + "/a.json/state?tick=x", http.StatusBadRequest},
+		{http.MethodGet, apiPrefix + "/a.json/events?from=200&to=100", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+		if w.Code != test.code {
+			t.Errorf("%v %v: got status %d, want %d", test.method, test.path, w.Code, test.code)
+		}
+	}
+}
+
+func TestServerPlayersLeft(t *testing.T) {
+	s, dir := newTestServer(t)
+	doc := testDoc()
+	// the bot Charlie damages Bravo and leaves after frame 9
+	charlie := match.JSONPlayerRef{Name: "Charlie", Team: teamT}
+	doc.Damage = append(doc.Damage, match.JSONDamage{
+		Frame: 5, Tick: 120, Attacker: charlie, Victim: doc.Kills[0].Victim, Weapon: "Glock-18", HitGroup: 2, Health: 30, HealthTaken: 30,
+	})
+	for f := 0; f < 10; f++ {
+		player := match.JSONPlayer{Name: "Charlie", IsBot: true, UserID: 3, Team: teamT, Health: 100, Connected: true}
+		if f >= 5 {
+			player.Assists = 1
+		}
+		doc.Samples[f].Players = append(doc.Samples[f].Players, player)
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stats []playerStats
+	if code := get(t, s, apiPrefix+"/a.json/players", &stats); code != http.StatusOK {
+		t.Fatalf("got status %d", code)
+	}
+	want := []playerStats{
+		{Name: "Alpha", Team: teamT, Kills: 1, Headshots: 1, ADR: 100, Damage: 100},
+		{Name: "Charlie", Team: teamT, Assists: 1, ADR: 30, Damage: 30},
+		{Name: "Bravo", Team: teamCT, Deaths: 1},
+	}
+	if len(stats) != len(want) {
+		t.Fatalf("got stats %+v, want %+v", stats, want)
+	}
+	for i := range want {
+		if stats[i] != want[i] {
+			t.Errorf("got stats %+v, want %+v", stats[i], want[i])
+		}
+	}
+}
+
+func TestServerParseError(t *testing.T) {
+	s, dir := newTestServer(t)
+	path := filepath.Join(dir, "a.json")
+	if err := ioutil.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.load(context.Background(), "a.json"); err == nil {
+		t.Fatal("loaded a broken match")
+	}
+	if s.loaded()["a.json"] {
+		t.Error("kept the match that failed to parse")
+	}
+
+	// fixed without changing the modification time
+	data, err := json.Marshal(testDoc())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.load(context.Background(), "a.json"); err != nil {
+		t.Errorf("got %v after fixing the match", err)
+	}
+}
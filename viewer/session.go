@@ -0,0 +1,266 @@
+// Package viewer holds the state of a replay viewer independent of how it is
+// drawn. Input is handled as abstract commands, so a session can be driven by
+// a window, a test or a remote client alike.
+package viewer
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	ocom "github.com/lwayneh/dem-replay/common"
+	"github.com/lwayneh/dem-replay/match"
+	"github.com/lwayneh/dem-replay/playback"
+)
+
+// Command is an input to a session.
+type Command int
+
+// Commands handled by Session.Handle.
+const (
+	TogglePause Command = iota
+	Faster
+	Slower
+	ToggleReverse
+	StepForward
+	StepBackward
+	SeekForward
+	SeekBackward
+	SeekForwardLong
+	SeekBackwardLong
+	NextRound
+	PreviousRound
+	NextHalf
+	PreviousHalf
+	// FastForward and Rewind seek by the seek step of the session, they are
+	// sent for as long as their control is held.
+	FastForward
+	Rewind
+	ToggleGrenadeArcs
+	// ToggleControls pins the playback controls, so they stay visible when
+	// the mouse leaves them.
+	ToggleControls
+)
+
+// Control is a button of the playback controls.
+type Control int
+
+// Controls of the playback controls.
+const (
+	ControlPlay Control = iota
+	ControlRewind
+	ControlFastForward
+	ControlMenu
+)
+
+const (
+	// DefaultSeekStep is how far FastForward and Rewind seek.
+	DefaultSeekStep = 1200 * time.Millisecond
+
+	seekDuration     = 5 * time.Second
+	seekDurationLong = 10 * time.Second
+
+	// restartDuration is how long after the start of a round PreviousRound
+	// goes back to the previous round instead of restarting the current one.
+	restartDuration = 500 * time.Millisecond
+)
+
+// Session is the state of a replay viewer: the playback position, the state
+// of the match shown at it and the state of the controls. Session is safe for
+// concurrent use.
+type Session struct {
+	mu       sync.Mutex
+	match    *match.Match
+	playhead *playback.Controller
+
+	// how far FastForward and Rewind seek
+	seekStep time.Duration
+
+	frame           int
+	state           ocom.OverviewState
+	showGrenadeArcs bool
+	controlsHovered bool
+	controlsPinned  bool
+	playPressed     bool
+	// controls held since the last update and the ones shown as held
+	held      map[Control]bool
+	shownHeld map[Control]bool
+}
+
+// NewSession returns a session of the match, played back by the playhead.
+func NewSession(m *match.Match, playhead *playback.Controller) *Session {
+	s := &Session{
+		match:     m,
+		playhead:  playhead,
+		seekStep:  DefaultSeekStep,
+		held:      make(map[Control]bool),
+		shownHeld: make(map[Control]bool),
+	}
+	s.Update()
+	return s
+}
+
+// Match returns the match of the session.
+func (s *Session) Match() *match.Match {
+	return s.match
+}
+
+// Playhead returns the playback position of the session.
+func (s *Session) Playhead() *playback.Controller {
+	return s.playhead
+}
+
+// Update moves the session to the current playback position. Frame, State
+// and Selected keep returning the same values until the next update, so a
+// frame is drawn from a consistent view of the session.
+func (s *Session) Update() {
+	frame, fraction := s.playhead.FramePosition()
+	state := s.match.InterpolatedState(frame, fraction)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.frame = frame
+	s.state = state
+	s.shownHeld = s.held
+	s.held = make(map[Control]bool)
+}
+
+// Frame returns the frame at the playback position.
+func (s *Session) Frame() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.frame
+}
+
+// State returns the state of the match at the playback position.
+func (s *Session) State() ocom.OverviewState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// Paused reports whether playback is paused.
+func (s *Session) Paused() bool {
+	return s.playhead.Paused()
+}
+
+// ShowGrenadeArcs reports whether the arcs of all grenades of the round are
+// shown instead of only the ones in flight.
+func (s *Session) ShowGrenadeArcs() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.showGrenadeArcs
+}
+
+// SetControlsHovered sets whether the mouse is on the playback controls.
+func (s *Session) SetControlsHovered(hovered bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.controlsHovered = hovered
+}
+
+// ControlsVisible reports whether the playback controls are shown.
+func (s *Session) ControlsVisible() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.controlsHovered || s.controlsPinned
+}
+
+// Selected reports whether the control is shown as selected.
+func (s *Session) Selected(c Control) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch c {
+	case ControlPlay:
+		return s.playPressed
+	case ControlMenu:
+		return s.controlsPinned
+	}
+	return s.shownHeld[c]
+}
+
+// Handle applies the command to the session.
+func (s *Session) Handle(cmd Command) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch cmd {
+	case TogglePause:
+		s.playPressed = true
+		s.playhead.Toggle()
+	case Faster:
+		s.playhead.Faster()
+	case Slower:
+		s.playhead.Slower()
+	case ToggleReverse:
+		s.playhead.SetReverse(!s.playhead.Reverse())
+	case StepForward:
+		s.playhead.Step(1)
+	case StepBackward:
+		s.playhead.Step(-1)
+	case SeekForward:
+		s.playhead.SeekBy(seekDuration)
+	case SeekBackward:
+		s.playhead.SeekBy(-seekDuration)
+	case SeekForwardLong:
+		s.playhead.SeekBy(seekDurationLong)
+	case SeekBackwardLong:
+		s.playhead.SeekBy(-seekDurationLong)
+	case NextRound:
+		s.playhead.SeekFrame(nextStart(s.match.RoundStarts, s.playhead.Frame()))
+	case PreviousRound:
+		s.playhead.SeekFrame(s.previousStart(s.match.RoundStarts))
+	case NextHalf:
+		s.playhead.SeekFrame(nextStart(s.match.HalfStarts, s.playhead.Frame()))
+	case PreviousHalf:
+		s.playhead.SeekFrame(s.previousStart(s.match.HalfStarts))
+	case FastForward:
+		s.held[ControlFastForward] = true
+		s.playhead.SeekBy(s.seekStep)
+	case Rewind:
+		s.held[ControlRewind] = true
+		s.playhead.SeekBy(-s.seekStep)
+	case ToggleGrenadeArcs:
+		s.showGrenadeArcs = !s.showGrenadeArcs
+	case ToggleControls:
+		s.controlsPinned = !s.controlsPinned
+	}
+}
+
+// SeekFraction moves the playback position to the fraction of the match,
+// from 0 at the first frame to 1 at the last one.
+func (s *Session) SeekFraction(fraction float64) {
+	if fraction < 0 {
+		fraction = 0
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+	s.playhead.SeekFrame(int(fraction * float64(s.match.TotalFrames)))
+}
+
+// previousStart returns the start of the round or half the playback position
+// is in, or the one before if it started less than restartDuration ago.
+func (s *Session) previousStart(starts []int) int {
+	frame := s.playhead.Frame()
+	restart := s.match.Timeline().Frames(restartDuration)
+	// index of the first start after the frame
+	i := sort.SearchInts(starts, frame+1)
+	if i == 0 {
+		return 0
+	}
+	if i > 1 && frame < starts[i-1]+restart {
+		return starts[i-2]
+	}
+	return starts[i-1]
+}
+
+// nextStart returns the first start after the frame, or the frame if there
+// is none.
+func nextStart(starts []int, frame int) int {
+	i := sort.SearchInts(starts, frame+1)
+	if i == len(starts) {
+		return frame
+	}
+	return starts[i]
+}
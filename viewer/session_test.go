@@ -0,0 +1,152 @@
+package viewer
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/lwayneh/dem-replay/match"
+	"github.com/lwayneh/dem-replay/playback"
+)
+
+const (
+	testFrames    = 160
+	testFrameRate = 16
+	// testTickRate puts 4 ticks between two frames
+	testTickRate = 64
+)
+
+// testRoundStarts are the starts of the rounds of the test match, at 0, 3 and
+// 7 seconds.
+var testRoundStarts = []int{0, 48, 112}
+
+// newTestMatch returns a match of 10 seconds with three rounds and no
+// players.
+func newTestMatch(t *testing.T) *match.Match {
+	t.Helper()
+	doc := match.JSONMatch{
+		Version:     match.JSONVersion,
+		Map:         "de_test",
+		TickRate:    testTickRate,
+		FrameRate:   testFrameRate,
+		DemoFrames:  testFrames,
+		HalfStarts:  []int{0},
+		RoundStarts: testRoundStarts,
+		Samples:     make([]match.JSONSample, testFrames),
+	}
+	for i := range doc.Samples {
+		doc.Samples[i] = match.JSONSample{Tick: i * testTickRate / testFrameRate}
+	}
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(doc); err != nil {
+		t.Fatal(err)
+	}
+	m, err := match.ReadJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// fakeClock is a clock that only moves when told to.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestSession(t *testing.T) (*Session, *fakeClock) {
+	m := newTestMatch(t)
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	return NewSession(m, playback.NewControllerClock(m.Timeline(), clock.Now)), clock
+}
+
+func checkFrame(t *testing.T, s *Session, want int) {
+	t.Helper()
+	s.Update()
+	if got := s.Frame(); got != want {
+		t.Errorf("got frame %d, want %d", got, want)
+	}
+}
+
+func TestSessionTogglePause(t *testing.T) {
+	s, clock := newTestSession(t)
+	if !s.Paused() {
+		t.Fatal("new session is playing")
+	}
+	clock.Advance(time.Second)
+	checkFrame(t, s, 0)
+
+	s.Handle(TogglePause)
+	if s.Paused() {
+		t.Error("TogglePause didn't start playback")
+	}
+	if !s.Selected(ControlPlay) {
+		t.Error("play control isn't shown as pressed")
+	}
+	clock.Advance(time.Second)
+	checkFrame(t, s, testFrameRate)
+
+	s.Handle(TogglePause)
+	if !s.Paused() {
+		t.Error("TogglePause didn't pause playback")
+	}
+	clock.Advance(time.Second)
+	checkFrame(t, s, testFrameRate)
+}
+
+func TestSessionNextRound(t *testing.T) {
+	s, _ := newTestSession(t)
+	for _, want := range []int{48, 112, 112} {
+		s.Handle(NextRound)
+		checkFrame(t, s, want)
+	}
+}
+
+func TestSessionPreviousRound(t *testing.T) {
+	s, clock := newTestSession(t)
+	s.playhead.SeekFrame(140)
+	// a while into the round, PreviousRound restarts it
+	s.Handle(PreviousRound)
+	checkFrame(t, s, 112)
+	// right at the start, it goes back to the round before
+	s.Handle(PreviousRound)
+	checkFrame(t, s, 48)
+
+	// shortly after the start still counts as the start
+	s.Handle(TogglePause)
+	clock.Advance(restartDuration / 2)
+	s.Handle(PreviousRound)
+	checkFrame(t, s, 0)
+	s.Handle(PreviousRound)
+	checkFrame(t, s, 0)
+}
+
+func TestSessionSeekFraction(t *testing.T) {
+	s, _ := newTestSession(t)
+	tests := []struct {
+		fraction float64
+		want     int
+	}{
+		{.5, testFrames / 2},
+		{.3, 48},
+		{0, 0},
+		{1, testFrames - 1},
+		{-1, 0},
+		{2, testFrames - 1},
+	}
+	for _, test := range tests {
+		s.SeekFraction(test.fraction)
+		s.Update()
+		if got := s.Frame(); got != test.want {
+			t.Errorf("SeekFraction(%v): got frame %d, want %d", test.fraction, got, test.want)
+		}
+	}
+}